@@ -0,0 +1,71 @@
+package archives
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+)
+
+var (
+	ErrPasswordUnavailable = errors.New("archive password can't be decrypted, it was sealed with another secret")
+	ErrPasswordsDisabled   = errors.New("archive passwords are disabled, ARCHIVE_PASSWORD_SECRET is not set")
+)
+
+func ArePasswordsEnabled() bool {
+	return config.Config.ArchivePasswordSecret != ""
+}
+
+// Archive passwords are needed until the batch is processed in the background, so they are kept encrypted
+// with ARCHIVE_PASSWORD_SECRET (AES-256-GCM) and cleared once the batch is done
+func SealPassword(password string) ([]byte, error) {
+	aead, err := newPasswordAead()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return aead.Seal(nonce, nonce, []byte(password), nil), nil
+}
+
+func OpenPassword(sealedPassword []byte) (string, error) {
+	aead, err := newPasswordAead()
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealedPassword) < aead.NonceSize() {
+		return "", ErrPasswordUnavailable
+	}
+
+	nonce, ciphertext := sealedPassword[:aead.NonceSize()], sealedPassword[aead.NonceSize():]
+	password, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", ErrPasswordUnavailable
+	}
+
+	return string(password), nil
+}
+
+func newPasswordAead() (cipher.AEAD, error) {
+	if !ArePasswordsEnabled() {
+		return nil, ErrPasswordsDisabled
+	}
+
+	key := sha256.Sum256([]byte(config.Config.ArchivePasswordSecret))
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
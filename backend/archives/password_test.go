@@ -0,0 +1,109 @@
+package archives
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+)
+
+func setArchivePasswordSecret(t *testing.T, secret string) {
+	t.Helper()
+	previousSecret := config.Config.ArchivePasswordSecret
+	config.Config.ArchivePasswordSecret = secret
+	t.Cleanup(func() { config.Config.ArchivePasswordSecret = previousSecret })
+}
+
+func TestSealPasswordRoundTrip(t *testing.T) {
+	setArchivePasswordSecret(t, "test-secret")
+
+	for _, password := range []string{"password", "pässwörd 🔒", string(bytes.Repeat([]byte("p"), 128))} {
+		sealedPassword, err := SealPassword(password)
+		if err != nil {
+			t.Fatalf("failed to seal password: %v", err)
+		}
+		if bytes.Contains(sealedPassword, []byte(password)) {
+			t.Errorf("expected sealed password not to contain the password")
+		}
+
+		openedPassword, err := OpenPassword(sealedPassword)
+		if err != nil {
+			t.Fatalf("failed to open password: %v", err)
+		}
+		if openedPassword != password {
+			t.Errorf("expected password %q, got %q", password, openedPassword)
+		}
+	}
+}
+
+func TestSealPasswordUsesRandomNonce(t *testing.T) {
+	setArchivePasswordSecret(t, "test-secret")
+
+	first, err := SealPassword("password")
+	if err != nil {
+		t.Fatalf("failed to seal password: %v", err)
+	}
+	second, err := SealPassword("password")
+	if err != nil {
+		t.Fatalf("failed to seal password: %v", err)
+	}
+
+	if bytes.Equal(first, second) {
+		t.Errorf("expected the same password to be sealed differently every time")
+	}
+}
+
+func TestOpenPasswordUnavailable(t *testing.T) {
+	setArchivePasswordSecret(t, "test-secret")
+
+	sealedPassword, err := SealPassword("password")
+	if err != nil {
+		t.Fatalf("failed to seal password: %v", err)
+	}
+
+	tampered := bytes.Clone(sealedPassword)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name           string
+		secret         string
+		sealedPassword []byte
+	}{
+		{"another secret", "another-secret", sealedPassword},
+		{"tampered", "test-secret", tampered},
+		{"truncated", "test-secret", sealedPassword[:len(sealedPassword)-1]},
+		{"shorter than nonce", "test-secret", sealedPassword[:4]},
+		{"empty", "test-secret", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setArchivePasswordSecret(t, test.secret)
+
+			if _, err := OpenPassword(test.sealedPassword); !errors.Is(err, ErrPasswordUnavailable) {
+				t.Errorf("expected ErrPasswordUnavailable, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPasswordsDisabledWithoutSecret(t *testing.T) {
+	setArchivePasswordSecret(t, "test-secret")
+	sealedPassword, err := SealPassword("password")
+	if err != nil {
+		t.Fatalf("failed to seal password: %v", err)
+	}
+
+	setArchivePasswordSecret(t, "")
+
+	if ArePasswordsEnabled() {
+		t.Errorf("expected passwords to be disabled")
+	}
+	if _, err := SealPassword("password"); !errors.Is(err, ErrPasswordsDisabled) {
+		t.Errorf("expected ErrPasswordsDisabled on seal, got %v", err)
+	}
+	if _, err := OpenPassword(sealedPassword); !errors.Is(err, ErrPasswordsDisabled) {
+		t.Errorf("expected ErrPasswordsDisabled on open, got %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+package archives
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+)
+
+const zipUtf8Flag = 0x800
+
+var ErrSourceFileChanged = errors.New("source file of the archive is missing or changed")
+
+// A file of a streamed zip, either from disk (the size and the checksum must be known in advance) or from memory
+type StreamedZipEntry struct {
+	Name     string
+	FilePath string
+	Size     int64
+	Crc32    uint32
+	Content  []byte
+}
+
+type streamedZipSegment struct {
+	offset   int64
+	size     int64
+	content  []byte
+	filePath string
+}
+
+// A zip in store mode that is assembled from the source files on every read instead of being written to disk.
+// Nothing is compressed and the checksums are known in advance, so the layout of the zip (the size and
+// what every byte is) is known before anything is read. This allows Content-Length and resuming from an offset.
+type StreamedZip struct {
+	segments []streamedZipSegment
+	size     int64
+}
+
+func NewStreamedZip(entries []StreamedZipEntry, modified time.Time) (*StreamedZip, error) {
+	recorder := &segmentRecorder{}
+	zipWriter := zip.NewWriter(recorder)
+	modifiedDate, modifiedTime := msDosTime(modified)
+
+	for _, entry := range entries {
+		if entry.FilePath == "" {
+			entry.Size = int64(len(entry.Content))
+			entry.Crc32 = crc32.ChecksumIEEE(entry.Content)
+		}
+
+		entryWriter, err := zipWriter.CreateRaw(&zip.FileHeader{
+			Name:               entry.Name,
+			Method:             zip.Store,
+			Flags:              zipUtf8Flag,
+			ModifiedDate:       modifiedDate,
+			ModifiedTime:       modifiedTime,
+			CRC32:              entry.Crc32,
+			CompressedSize64:   uint64(entry.Size),
+			UncompressedSize64: uint64(entry.Size),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zip entry: %w", err)
+		}
+
+		if err := zipWriter.Flush(); err != nil {
+			return nil, fmt.Errorf("failed to flush zip writer: %w", err)
+		}
+
+		// The zip writer has to count the data to get the offsets right, but only the placeholder is recorded
+		recorder.startFile(entry)
+		if _, err := io.CopyN(entryWriter, zeroReader{}, entry.Size); err != nil {
+			return nil, fmt.Errorf("failed to write zip entry: %w", err)
+		}
+		if err := zipWriter.Flush(); err != nil {
+			return nil, fmt.Errorf("failed to flush zip writer: %w", err)
+		}
+		recorder.endFile()
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close zip writer: %w", err)
+	}
+	recorder.endBytes()
+
+	return &StreamedZip{segments: recorder.segments, size: recorder.offset}, nil
+}
+
+func (z *StreamedZip) Size() int64 {
+	return z.size
+}
+
+// Checks that the source files are still there, so that a broken download can be refused before it starts
+func (z *StreamedZip) Validate() error {
+	for _, segment := range z.segments {
+		if segment.filePath == "" {
+			continue
+		}
+
+		info, err := os.Stat(segment.filePath)
+		if err != nil || info.Size() != segment.size {
+			return ErrSourceFileChanged
+		}
+	}
+
+	return nil
+}
+
+func (z *StreamedZip) WriteRange(writer io.Writer, offset int64, length int64) error {
+	end := offset + length
+
+	for _, segment := range z.segments {
+		segmentEnd := segment.offset + segment.size
+		if segmentEnd <= offset || segment.offset >= end {
+			continue
+		}
+
+		start := max(offset, segment.offset) - segment.offset
+		size := min(end, segmentEnd) - segment.offset - start
+
+		if segment.filePath == "" {
+			if _, err := writer.Write(segment.content[start : start+size]); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := copyFileRange(writer, segment, start, size); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func copyFileRange(writer io.Writer, segment streamedZipSegment, start int64, size int64) error {
+	file, err := os.Open(segment.filePath)
+	if err != nil {
+		return ErrSourceFileChanged
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err != nil || info.Size() != segment.size {
+		return ErrSourceFileChanged
+	}
+
+	_, err = io.Copy(writer, io.NewSectionReader(file, start, size))
+	return err
+}
+
+// Receives the output of the zip writer: headers are kept as is, the placeholder data of files is replaced by references
+type segmentRecorder struct {
+	segments []streamedZipSegment
+	offset   int64
+	pending  []byte
+	file     *StreamedZipEntry
+}
+
+func (r *segmentRecorder) Write(p []byte) (int, error) {
+	if r.file == nil {
+		r.pending = append(r.pending, p...)
+	}
+	r.offset += int64(len(p))
+	return len(p), nil
+}
+
+func (r *segmentRecorder) startFile(entry StreamedZipEntry) {
+	r.endBytes()
+	r.file = &entry
+}
+
+func (r *segmentRecorder) endFile() {
+	segment := streamedZipSegment{offset: r.offset - r.file.Size, size: r.file.Size}
+	if r.file.FilePath == "" {
+		segment.content = r.file.Content
+	} else {
+		segment.filePath = r.file.FilePath
+	}
+
+	r.segments = append(r.segments, segment)
+	r.file = nil
+}
+
+func (r *segmentRecorder) endBytes() {
+	if len(r.pending) == 0 {
+		return
+	}
+
+	r.segments = append(r.segments, streamedZipSegment{
+		offset:  r.offset - int64(len(r.pending)),
+		size:    int64(len(r.pending)),
+		content: r.pending,
+	})
+	r.pending = nil
+}
+
+// Raw entries don't get the timestamp converted by the zip writer
+func msDosTime(t time.Time) (uint16, uint16) {
+	t = t.UTC()
+	if t.Year() < 1980 {
+		t = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	date := uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	clock := uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return date, clock
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// Used to compute checksums of files before streaming them
+func ChecksumFile(filePath string) (uint32, int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	hash := crc32.NewIEEE()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return hash.Sum32(), size, nil
+}
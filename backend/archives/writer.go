@@ -0,0 +1,95 @@
+package archives
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+)
+
+// Writes files of a batch into an archive of the requested format
+type Writer interface {
+	// The size must be known in advance, tar headers go before the content
+	AddFile(name string, size int64, modified time.Time, content io.Reader) error
+	Close() error
+}
+
+func NewWriter(format models.BatchRequestArchiveFormat, output io.Writer, password string) (Writer, error) {
+	switch format {
+	case models.BatchRequestArchiveFormatZip:
+		return &zipArchiveWriter{zipWriter: zip.NewWriter(output)}, nil
+	case models.BatchRequestArchiveFormatTarGz:
+		gzipWriter := gzip.NewWriter(output)
+		return &tarGzArchiveWriter{gzipWriter: gzipWriter, tarWriter: tar.NewWriter(gzipWriter)}, nil
+	case models.BatchRequestArchiveFormatZipAes:
+		if password == "" {
+			return nil, fmt.Errorf("password is required for %s archives", format)
+		}
+		return &aesZipArchiveWriter{zipWriter: zip.NewWriter(output), password: password}, nil
+	default:
+		return nil, fmt.Errorf("unsupported archive format: %s", format)
+	}
+}
+
+type zipArchiveWriter struct {
+	zipWriter *zip.Writer
+}
+
+func (w *zipArchiveWriter) AddFile(name string, size int64, modified time.Time, content io.Reader) error {
+	entryWriter, err := w.zipWriter.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+		// Names are always UTF-8, tools that don't see the flag assume a legacy code page
+		Flags: zipUtf8Flag,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create zip entry: %w", err)
+	}
+
+	if _, err := io.Copy(entryWriter, content); err != nil {
+		return fmt.Errorf("failed to write file to zip: %w", err)
+	}
+
+	return nil
+}
+
+func (w *zipArchiveWriter) Close() error {
+	return w.zipWriter.Close()
+}
+
+type tarGzArchiveWriter struct {
+	gzipWriter *gzip.Writer
+	tarWriter  *tar.Writer
+}
+
+func (w *tarGzArchiveWriter) AddFile(name string, size int64, modified time.Time, content io.Reader) error {
+	// Non-ASCII names are written as PAX records automatically
+	err := w.tarWriter.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0o644,
+		ModTime:  modified,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write tar header: %w", err)
+	}
+
+	if _, err := io.CopyN(w.tarWriter, content, size); err != nil {
+		return fmt.Errorf("failed to write file to tar: %w", err)
+	}
+
+	return nil
+}
+
+func (w *tarGzArchiveWriter) Close() error {
+	if err := w.tarWriter.Close(); err != nil {
+		return err
+	}
+	return w.gzipWriter.Close()
+}
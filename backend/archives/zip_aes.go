@@ -0,0 +1,165 @@
+package archives
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"time"
+)
+
+// WinZip AE-2 (https://www.winzip.com/en/support/aes-encryption/), supported by 7-Zip, WinZip, libarchive, etc.
+const (
+	zipMethodAes          = 99
+	zipEncryptedFlag      = 0x1
+	zipDataDescriptorFlag = 0x8
+	zipAesExtraId         = 0x9901
+	zipAesVersion         = 2
+	zipAesStrength256     = 3
+	zipAesKeyLength       = 32
+	zipAesSaltLength      = 16
+	zipAesAuthCodeLength  = 10
+	zipAesIterations      = 1000
+)
+
+type aesZipArchiveWriter struct {
+	zipWriter *zip.Writer
+	password  string
+}
+
+// The content is deflated, then encrypted with AES-256 in the WinZip flavour of CTR mode and authenticated
+// with HMAC-SHA1. Every file gets its own salt, so its own keys.
+func (w *aesZipArchiveWriter) AddFile(name string, size int64, modified time.Time, content io.Reader) error {
+	salt := make([]byte, zipAesSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	keys, err := pbkdf2.Key(sha1.New, w.password, salt, zipAesIterations, 2*zipAesKeyLength+2)
+	if err != nil {
+		return fmt.Errorf("failed to derive keys: %w", err)
+	}
+	encryptionKey, authenticationKey, passwordVerifier := keys[:zipAesKeyLength], keys[zipAesKeyLength:2*zipAesKeyLength], keys[2*zipAesKeyLength:]
+
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	extra := make([]byte, 11)
+	binary.LittleEndian.PutUint16(extra[0:], zipAesExtraId)
+	binary.LittleEndian.PutUint16(extra[2:], 7)
+	binary.LittleEndian.PutUint16(extra[4:], zipAesVersion)
+	copy(extra[6:], "AE")
+	extra[8] = zipAesStrength256
+	binary.LittleEndian.PutUint16(extra[9:], zip.Deflate)
+
+	modifiedDate, modifiedTime := msDosTime(modified)
+	header := &zip.FileHeader{
+		Name:         name,
+		Method:       zipMethodAes,
+		Flags:        zipUtf8Flag | zipEncryptedFlag | zipDataDescriptorFlag,
+		ModifiedDate: modifiedDate,
+		ModifiedTime: modifiedTime,
+		Extra:        extra,
+	}
+
+	// The sizes are written to the data descriptor and the central directory, which read the header when the entry is closed
+	rawWriter, err := w.zipWriter.CreateRaw(header)
+	if err != nil {
+		return fmt.Errorf("failed to create zip entry: %w", err)
+	}
+
+	counter := &countingWriter{writer: rawWriter}
+	if _, err := counter.Write(append(salt, passwordVerifier...)); err != nil {
+		return fmt.Errorf("failed to write zip entry: %w", err)
+	}
+
+	mac := hmac.New(sha1.New, authenticationKey)
+	encrypter := &aesCtrWriter{block: block, mac: mac, writer: counter}
+
+	compressor, err := flate.NewWriter(encrypter, flate.DefaultCompression)
+	if err != nil {
+		return fmt.Errorf("failed to create compressor: %w", err)
+	}
+
+	uncompressedSize, err := io.Copy(compressor, content)
+	if err != nil {
+		return fmt.Errorf("failed to write file to zip: %w", err)
+	}
+	if err := compressor.Close(); err != nil {
+		return fmt.Errorf("failed to write file to zip: %w", err)
+	}
+
+	if _, err := counter.Write(mac.Sum(nil)[:zipAesAuthCodeLength]); err != nil {
+		return fmt.Errorf("failed to write zip entry: %w", err)
+	}
+
+	// AE-2 doesn't store the CRC, the authentication code replaces it
+	header.CRC32 = 0
+	header.CompressedSize64 = uint64(counter.count)
+	header.UncompressedSize64 = uint64(uncompressedSize)
+	// The data descriptor still reads the 32-bit sizes when they fit
+	header.CompressedSize = uint32(min(header.CompressedSize64, math.MaxUint32))
+	header.UncompressedSize = uint32(min(header.UncompressedSize64, math.MaxUint32))
+
+	return nil
+}
+
+func (w *aesZipArchiveWriter) Close() error {
+	return w.zipWriter.Close()
+}
+
+// Unlike the standard CTR mode, the counter is little-endian and starts from 1
+type aesCtrWriter struct {
+	block   cipher.Block
+	mac     hash.Hash
+	writer  io.Writer
+	counter uint64
+	stream  [aes.BlockSize]byte
+	used    int
+}
+
+func (w *aesCtrWriter) Write(p []byte) (int, error) {
+	encrypted := make([]byte, len(p))
+
+	for i, b := range p {
+		if w.counter == 0 || w.used == aes.BlockSize {
+			w.counter++
+			var counterBlock [aes.BlockSize]byte
+			binary.LittleEndian.PutUint64(counterBlock[:], w.counter)
+			w.block.Encrypt(w.stream[:], counterBlock[:])
+			w.used = 0
+		}
+
+		encrypted[i] = b ^ w.stream[w.used]
+		w.used++
+	}
+
+	w.mac.Write(encrypted)
+	if _, err := w.writer.Write(encrypted); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.count += int64(n)
+	return n, err
+}
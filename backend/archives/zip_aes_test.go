@@ -0,0 +1,242 @@
+package archives
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+)
+
+const testArchivePassword = "secret-password"
+
+func mustDecodeHex(t *testing.T, value string) []byte {
+	t.Helper()
+	decoded, err := hex.DecodeString(value)
+	if err != nil {
+		t.Fatalf("invalid hex %q: %v", value, err)
+	}
+	return decoded
+}
+
+// Derives the keys like AddFile, returns the encryption key, the authentication key and the password verifier
+func deriveTestKeys(t *testing.T, password string, salt []byte) ([]byte, []byte, []byte) {
+	t.Helper()
+	keys, err := pbkdf2.Key(sha1.New, password, salt, zipAesIterations, 2*zipAesKeyLength+2)
+	if err != nil {
+		t.Fatalf("failed to derive keys: %v", err)
+	}
+	return keys[:zipAesKeyLength], keys[zipAesKeyLength : 2*zipAesKeyLength], keys[2*zipAesKeyLength:]
+}
+
+// The keystream doesn't depend on the data, so encrypting the ciphertext again decrypts it
+func applyAesCtr(t *testing.T, encryptionKey []byte, authenticationKey []byte, data []byte) ([]byte, []byte) {
+	t.Helper()
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		t.Fatalf("failed to create cipher: %v", err)
+	}
+
+	output := &bytes.Buffer{}
+	mac := hmac.New(sha1.New, authenticationKey)
+	writer := &aesCtrWriter{block: block, mac: mac, writer: output}
+	// Uneven writes cross the block boundaries in the middle of a write
+	for len(data) > 0 {
+		n := min(len(data), 7)
+		if _, err := writer.Write(data[:n]); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+		data = data[n:]
+	}
+
+	return output.Bytes(), mac.Sum(nil)[:zipAesAuthCodeLength]
+}
+
+// Verified with libarchive (bsdtar --passphrase password) as a stored AE-1 entry
+func TestAesCtrWriterKnownVector(t *testing.T) {
+	salt := mustDecodeHex(t, "000102030405060708090a0b0c0d0e0f")
+	plaintext := []byte("The quick brown fox jumps over the lazy dog")
+
+	encryptionKey, authenticationKey, passwordVerifier := deriveTestKeys(t, "password", salt)
+	if expected := mustDecodeHex(t, "256b"); !bytes.Equal(passwordVerifier, expected) {
+		t.Errorf("expected password verifier %x, got %x", expected, passwordVerifier)
+	}
+
+	ciphertext, authCode := applyAesCtr(t, encryptionKey, authenticationKey, plaintext)
+
+	expectedCiphertext := mustDecodeHex(t, "dfbcaf7ba944fec02667f6f2d4d256664b0889e9a6ac9e9167bacc9b49c1e8e61e09a497a2cc0060c96b30")
+	if !bytes.Equal(ciphertext, expectedCiphertext) {
+		t.Errorf("expected ciphertext %x, got %x", expectedCiphertext, ciphertext)
+	}
+	if expected := mustDecodeHex(t, "5f6e226c8ac068ff7f73"); !bytes.Equal(authCode, expected) {
+		t.Errorf("expected authentication code %x, got %x", expected, authCode)
+	}
+}
+
+type testArchiveFile struct {
+	name    string
+	content []byte
+}
+
+func writeAesZip(t *testing.T, modified time.Time, files []testArchiveFile) []byte {
+	t.Helper()
+	output := &bytes.Buffer{}
+
+	writer, err := NewWriter(models.BatchRequestArchiveFormatZipAes, output, testArchivePassword)
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+	for _, file := range files {
+		if err := writer.AddFile(file.name, int64(len(file.content)), modified, bytes.NewReader(file.content)); err != nil {
+			t.Fatalf("failed to add file %s: %v", file.name, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close writer: %v", err)
+	}
+
+	return output.Bytes()
+}
+
+func expectedAesExtra() []byte {
+	extra := []byte{0x01, 0x99, 0x07, 0x00, 0x02, 0x00, 'A', 'E', 0x03, 0x00, 0x00}
+	binary.LittleEndian.PutUint16(extra[9:], zip.Deflate)
+	return extra
+}
+
+func TestAesZipWriter(t *testing.T) {
+	modified := time.Date(2025, 6, 2, 10, 7, 30, 0, time.UTC)
+	files := []testArchiveFile{
+		{"dir/ünï.txt", []byte(strings.Repeat("hello world ", 1000))},
+		{"same.txt", []byte(strings.Repeat("hello world ", 1000))},
+		{"empty.txt", []byte{}},
+	}
+	archive := writeAesZip(t, modified, files)
+
+	zipReader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("failed to read zip: %v", err)
+	}
+	if len(zipReader.File) != len(files) {
+		t.Fatalf("expected %d files, got %d", len(files), len(zipReader.File))
+	}
+
+	salts := map[string]bool{}
+	for i, file := range zipReader.File {
+		expected := files[i]
+
+		t.Run(expected.name, func(t *testing.T) {
+			// The central directory
+			if file.Name != expected.name {
+				t.Errorf("expected name %q, got %q", expected.name, file.Name)
+			}
+			if file.Method != zipMethodAes {
+				t.Errorf("expected method %d, got %d", zipMethodAes, file.Method)
+			}
+			if expectedFlags := uint16(zipUtf8Flag | zipEncryptedFlag | zipDataDescriptorFlag); file.Flags != expectedFlags {
+				t.Errorf("expected flags %#x, got %#x", expectedFlags, file.Flags)
+			}
+			if file.CRC32 != 0 {
+				t.Errorf("expected no CRC for AE-2, got %#x", file.CRC32)
+			}
+			if file.UncompressedSize64 != uint64(len(expected.content)) {
+				t.Errorf("expected uncompressed size %d, got %d", len(expected.content), file.UncompressedSize64)
+			}
+			if !file.Modified.Equal(modified) {
+				t.Errorf("expected modified %s, got %s", modified, file.Modified)
+			}
+			if !bytes.Equal(file.Extra, expectedAesExtra()) {
+				t.Errorf("expected central AES extra field %x, got %x", expectedAesExtra(), file.Extra)
+			}
+
+			// The local header
+			dataOffset, err := file.DataOffset()
+			if err != nil {
+				t.Fatalf("failed to get data offset: %v", err)
+			}
+			localHeader := archive[dataOffset-int64(30+len(file.Name)+len(expectedAesExtra())) : dataOffset]
+			if signature := binary.LittleEndian.Uint32(localHeader[0:]); signature != 0x04034b50 {
+				t.Fatalf("expected local header signature, got %#x", signature)
+			}
+			if flags := binary.LittleEndian.Uint16(localHeader[6:]); flags != file.Flags {
+				t.Errorf("expected local flags %#x, got %#x", file.Flags, flags)
+			}
+			if method := binary.LittleEndian.Uint16(localHeader[8:]); method != zipMethodAes {
+				t.Errorf("expected local method %d, got %d", zipMethodAes, method)
+			}
+			// Known only after the content, so they are in the data descriptor
+			if crcAndSizes := localHeader[14:26]; !bytes.Equal(crcAndSizes, make([]byte, 12)) {
+				t.Errorf("expected no CRC and sizes in local header, got %x", crcAndSizes)
+			}
+			nameLength := binary.LittleEndian.Uint16(localHeader[26:])
+			if name := string(localHeader[30 : 30+nameLength]); name != expected.name {
+				t.Errorf("expected local name %q, got %q", expected.name, name)
+			}
+			if extra := localHeader[30+nameLength:]; !bytes.Equal(extra, expectedAesExtra()) {
+				t.Errorf("expected local AES extra field %x, got %x", expectedAesExtra(), extra)
+			}
+
+			// The salt, the password verifier, the encrypted content and the authentication code
+			rawReader, err := file.OpenRaw()
+			if err != nil {
+				t.Fatalf("failed to open raw entry: %v", err)
+			}
+			raw, err := io.ReadAll(rawReader)
+			if err != nil {
+				t.Fatalf("failed to read raw entry: %v", err)
+			}
+			if uint64(len(raw)) != file.CompressedSize64 {
+				t.Errorf("expected compressed size %d, got %d", len(raw), file.CompressedSize64)
+			}
+			if len(raw) < zipAesSaltLength+2+zipAesAuthCodeLength {
+				t.Fatalf("entry is too short: %d bytes", len(raw))
+			}
+
+			salt := raw[:zipAesSaltLength]
+			passwordVerifier := raw[zipAesSaltLength : zipAesSaltLength+2]
+			ciphertext := raw[zipAesSaltLength+2 : len(raw)-zipAesAuthCodeLength]
+			authCode := raw[len(raw)-zipAesAuthCodeLength:]
+
+			if salts[string(salt)] {
+				t.Errorf("expected every file to have its own salt")
+			}
+			salts[string(salt)] = true
+
+			encryptionKey, authenticationKey, expectedPasswordVerifier := deriveTestKeys(t, testArchivePassword, salt)
+			if !bytes.Equal(passwordVerifier, expectedPasswordVerifier) {
+				t.Errorf("expected password verifier %x, got %x", expectedPasswordVerifier, passwordVerifier)
+			}
+
+			mac := hmac.New(sha1.New, authenticationKey)
+			mac.Write(ciphertext)
+			if expectedAuthCode := mac.Sum(nil)[:zipAesAuthCodeLength]; !bytes.Equal(authCode, expectedAuthCode) {
+				t.Errorf("expected authentication code %x, got %x", expectedAuthCode, authCode)
+			}
+
+			compressed, _ := applyAesCtr(t, encryptionKey, authenticationKey, ciphertext)
+			content, err := io.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+			if err != nil {
+				t.Fatalf("failed to inflate content: %v", err)
+			}
+			if !bytes.Equal(content, expected.content) {
+				t.Errorf("expected content of %d bytes, got %d bytes", len(expected.content), len(content))
+			}
+		})
+	}
+}
+
+func TestAesZipWriterRequiresPassword(t *testing.T) {
+	if _, err := NewWriter(models.BatchRequestArchiveFormatZipAes, io.Discard, ""); err == nil {
+		t.Errorf("expected an error without password")
+	}
+}
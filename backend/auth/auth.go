@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"strings"
 	"time"
@@ -8,27 +9,43 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofrs/uuid/v5"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
 )
 
-var jwtSecret = []byte("word_to_pdf_secret")
+// API keys don't have users, the user ID is derived from the key, so that the key sees its own requests
+var apiKeyUserIdNamespace = uuid.Must(uuid.FromString("6f0b5d0e-93c1-4d3a-9a59-3c2f5d1e8b47"))
 
-func GenerateJWT() (string, error) {
+func GenerateJWT(priority models.Priority) (string, error) {
 	id, err := uuid.NewV7()
 	if err != nil {
 		return "", err
 	}
 
 	claims := jwt.MapClaims{
-		"id":  id.String(),
-		"exp": time.Now().Add(time.Hour * 24 * 365 * 100).Unix(),
+		"id":       id.String(),
+		"priority": priority.String(),
+		"exp":      time.Now().Add(time.Hour * 24 * 365 * 100).Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return token.SignedString([]byte(config.Config.JwtSecret))
 }
 
+// Locals of authenticated requests
+const (
+	UserIdLocal   = "userId"
+	PriorityLocal = "priority"
+	AdminLocal    = "admin"
+)
+
+// Accepts access tokens in the Authorization header and API keys (API_KEYS) in the X-Api-Key header
 func JWTMiddleware() fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		if apiKey := c.Get("X-Api-Key"); apiKey != "" {
+			return authenticateApiKey(c, apiKey)
+		}
+
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -47,7 +64,7 @@ func JWTMiddleware() fiber.Handler {
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, fiber.ErrUnauthorized
 			}
-			return jwtSecret, nil
+			return []byte(config.Config.JwtSecret), nil
 		})
 
 		if err != nil || !jwtToken.Valid {
@@ -63,7 +80,60 @@ func JWTMiddleware() fiber.Handler {
 			})
 		}
 
-		c.Locals("userId", jwtTokenClaims["id"])
+		// Tokens issued before priorities have none
+		priority := models.PriorityNormal
+		if priorityClaim, ok := jwtTokenClaims["priority"].(string); ok {
+			if priority, err = models.ParsePriority(priorityClaim); err != nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": fmt.Sprintf("Invalid access token claims: %s", err),
+				})
+			}
+		}
+
+		c.Locals(UserIdLocal, jwtTokenClaims["id"])
+		c.Locals(PriorityLocal, priority)
 		return c.Next()
 	}
 }
+
+func authenticateApiKey(c *fiber.Ctx, apiKey string) error {
+	for _, configuredApiKey := range config.Config.ApiKeys {
+		if subtle.ConstantTimeCompare([]byte(configuredApiKey.Key), []byte(apiKey)) != 1 {
+			continue
+		}
+
+		priority, err := models.ParsePriority(configuredApiKey.Priority)
+		if err != nil {
+			return fmt.Errorf("invalid priority of API key: %w", err)
+		}
+
+		c.Locals(UserIdLocal, uuid.NewV5(apiKeyUserIdNamespace, apiKey).String())
+		c.Locals(PriorityLocal, priority)
+		c.Locals(AdminLocal, configuredApiKey.Admin)
+		return c.Next()
+	}
+
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error": "Invalid API key",
+	})
+}
+
+// Lets through only API keys marked as admin in API_KEYS, must be used after JWTMiddleware
+func AdminMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if admin, ok := c.Locals(AdminLocal).(bool); !ok || !admin {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Admin API key required",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+func Priority(c *fiber.Ctx) models.Priority {
+	if priority, ok := c.Locals(PriorityLocal).(models.Priority); ok {
+		return priority
+	}
+	return models.PriorityNormal
+}
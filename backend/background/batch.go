@@ -1,20 +1,22 @@
 package background
 
 import (
-	"archive/zip"
 	"context"
-	"encoding/json"
+	"database/sql"
 	"fmt"
-	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"time"
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/jmoiron/sqlx"
+	"github.com/karpov-kir/word-to-pdf/backend/archives"
 	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/converters"
 	"github.com/karpov-kir/word-to-pdf/backend/database"
 	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/karpov-kir/word-to-pdf/backend/naming"
 	"github.com/karpov-kir/word-to-pdf/backend/utils"
 	"github.com/sirupsen/logrus"
 )
@@ -25,6 +27,14 @@ func ProcessBatchRequests(taskPool *utils.TaskPool) {
 	for {
 		time.Sleep(config.Config.PollBatchRequestsInterval)
 
+		if IsProcessorPaused(BatchProcessor) {
+			continue
+		}
+
+		if err := queueReadyWaitingBatchRequests(); err != nil {
+			logrus.Errorf("Failed to queue waiting batch requests: %v", err)
+		}
+
 		if taskPool.LeftSlots() == 0 {
 			continue
 		}
@@ -50,8 +60,7 @@ func ProcessBatchRequests(taskPool *utils.TaskPool) {
 
 		for _, queuedBatchRequestId := range queuedBatchRequests {
 			if !taskPool.AddTask(func(ctx context.Context) {
-				err := createZipFromBatchRequest(queuedBatchRequestId)
-				updateBatchRequestStatus(queuedBatchRequestId, err)
+				processQueuedBatchRequest(ctx, queuedBatchRequestId)
 			}, queuedBatchRequestId) {
 				logrus.Warnf("Could not add task to process batch request with id: %s, no available slots or token already occupied", queuedBatchRequestId)
 			}
@@ -71,11 +80,18 @@ func fetchQueuedBatchRequests(batchRequestsInProgress []string, limit int) ([]st
 	}
 	whereClause := `
     WHERE status = :status
-      AND created_at >= NOW() - INTERVAL '12 HOURS'
+      AND ` + DueAt + ` >= NOW() - INTERVAL '12 HOURS'
+      AND (not_before IS NULL OR not_before <= NOW())
+      AND ` + NotPickedUp + `
       AND id NOT IN (:batchRequestsInProgress)
   `
+	// Merged batches wait while Gotenberg is unavailable
+	if !converters.IsMergeAvailable() {
+		namedArgs["mergedOutputType"] = models.BatchRequestOutputTypePdf
+		whereClause += " AND output_type != :mergedOutputType"
+	}
 	query, args, err := sqlx.Named(
-		`SELECT id FROM batch_request `+whereClause+` ORDER BY created_at DESC LIMIT :limit`,
+		`SELECT id FROM batch_request `+whereClause+` `+schedulingOrder()+` LIMIT :limit`,
 		namedArgs,
 	)
 	if err != nil {
@@ -124,77 +140,250 @@ func fetchQueuedBatchRequests(batchRequestsInProgress []string, limit int) ([]st
 	return queuedBatchRequestIds, totalQueuedBatchRequestCount, nil
 }
 
-func createZipFromBatchRequest(batchRequestId string) error {
+type batchRequestToProcess struct {
+	OutputType      models.BatchRequestOutputType    `db:"output_type"`
+	ConvertRequests models.BatchRequestMembers       `db:"convert_requests"`
+	NamingTemplate  *string                          `db:"naming_template"`
+	CreatedAt       time.Time                        `db:"created_at"`
+	ArchiveFormat   models.BatchRequestArchiveFormat `db:"archive_format"`
+	// Sealed, see archives.SealPassword
+	ArchivePassword []byte `db:"archive_password"`
+}
+
+// Waiting batch requests are queued when none of their convert requests is in progress anymore
+// or when they have been waiting for too long since they are due (then only the finished convert requests are batched).
+// Streamed batch requests have nothing to process, so they are done right away.
+func queueReadyWaitingBatchRequests() error {
+	query, args, err := sqlx.Named(
+		fmt.Sprintf(`
+      UPDATE batch_request
+      SET
+        status = CASE WHEN streamed
+          THEN CAST(:doneStatus AS batch_request_status_enum)
+          ELSE CAST(:queuedStatus AS batch_request_status_enum)
+        END,
+        batched_at = CASE WHEN streamed THEN NOW() ELSE batched_at END
+      WHERE status = :waitingStatus
+        AND (
+          `+DueAt+` < NOW() - INTERVAL '%d SECONDS'
+          OR NOT EXISTS (
+            SELECT 1 FROM convert_requests
+            WHERE convert_requests.id IN (
+                SELECT CAST(member->>'id' AS UUID) FROM jsonb_array_elements(batch_request.convert_requests) AS member
+              )
+              AND convert_requests.status NOT IN (:finishedStatuses)
+          )
+        )
+    `, int(config.Config.BatchWaitTimeout.Seconds())),
+		map[string]interface{}{
+			"queuedStatus":  models.BatchRequestStatusQueued,
+			"doneStatus":    models.BatchRequestStatusDone,
+			"waitingStatus": models.BatchRequestStatusWaiting,
+			"finishedStatuses": []models.ConvertRequestStatus{
+				models.ConvertRequestStatusDone,
+				models.ConvertRequestStatusError,
+				models.ConvertRequestStatusCancelled,
+			},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	query, args, err = sqlx.In(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to build in clause in query: %w", err)
+	}
+
+	query = database.Connection.Rebind(query)
+
+	result, err := database.Connection.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update waiting batch requests: %w", err)
+	}
+
+	if queuedCount, _ := result.RowsAffected(); queuedCount > 0 {
+		logrus.Infof("Queued %d waiting batch requests", queuedCount)
+	}
+
+	return nil
+}
+
+func processQueuedBatchRequest(ctx context.Context, batchRequestId string) {
+	if err := pickUp("batch_request", batchRequestId, string(models.BatchRequestStatusQueued)); err != nil {
+		logrus.Infof("Skipping batch request with id: %s: %s", batchRequestId, err)
+		return
+	}
+	defer release("batch_request", batchRequestId)
+
+	manifest, err := processBatchRequest(ctx, batchRequestId)
+	updateBatchRequestStatus(batchRequestId, manifest, err)
+}
+
+// Returns the manifest of the batch, which tells what convert requests are included in the output
+func processBatchRequest(ctx context.Context, batchRequestId string) (models.BatchRequestManifest, error) {
 	logrus.Infof("Processing batch request with id: %s", batchRequestId)
 
-	query := `SELECT convert_requests FROM batch_request WHERE id = $1`
-	var convertRequestsJSON []byte
-	if err := database.Connection.QueryRow(query, batchRequestId).Scan(
-		&convertRequestsJSON,
+	var batchRequest batchRequestToProcess
+	if err := database.Connection.Get(
+		&batchRequest,
+		`
+      SELECT output_type, convert_requests, naming_template, created_at, archive_format, archive_password
+      FROM batch_request WHERE id = $1
+    `,
+		batchRequestId,
 	); err != nil {
-		return fmt.Errorf("failed to fetch batch convert requests: %w", err)
+		return nil, fmt.Errorf("failed to fetch batch convert requests: %w", err)
+	}
+
+	// Files of unfinished convert requests may be incomplete, so only done ones are batched
+	manifest, err := BuildBatchRequestManifest(batchRequest.ConvertRequests, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if batchRequest.OutputType == models.BatchRequestOutputTypePdf {
+		err = createMergedPdfFromBatchRequest(ctx, batchRequestId, manifest)
+	} else {
+		err = createArchiveFromBatchRequest(batchRequestId, manifest, batchRequest)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	var batchRequest struct {
-		ConvertRequests []struct {
-			Id       string `json:"id"`
-			FileName string `json:"file_name"`
+	includedCount := countIncludedManifestEntries(manifest)
+	if skippedCount := len(manifest) - includedCount; skippedCount > 0 {
+		logrus.Warnf("Skipped %d convert requests of batch request %s that are not done", skippedCount, batchRequestId)
+	}
+
+	logrus.Infof("Batch request %s processed successfully, %d files batched", batchRequestId, includedCount)
+	return manifest, nil
+}
+
+func createMergedPdfFromBatchRequest(ctx context.Context, batchRequestId string, manifest models.BatchRequestManifest) error {
+	filePaths := []string{}
+	for i, entry := range manifest {
+		if entry.Status != models.ConvertRequestStatusDone {
+			continue
 		}
+		// The files are kept until the batch is processed, a missing one would make the PDF silently incomplete
+		if entry.OutputSize == nil {
+			return fmt.Errorf("converted file of convert request %s is missing", entry.ConvertRequestId)
+		}
+
+		filePaths = append(filePaths, filepath.Join(config.Config.UploadsFolderAbsolutePath, fmt.Sprintf("%s_converted", entry.ConvertRequestId)))
+		manifest[i].Included = true
+	}
+
+	if len(filePaths) == 0 {
+		return fmt.Errorf("no converted files to merge")
+	}
+
+	return converters.MergePdfs(ctx, filePaths, filepath.Join(config.Config.UploadsFolderAbsolutePath, fmt.Sprintf("%s.pdf", batchRequestId)))
+}
+
+func newBatchNamer(namingTemplate *string, createdAt time.Time, count int) *naming.Namer {
+	// Validated when the batch is created
+	template := naming.Template(naming.DefaultTemplate)
+	if namingTemplate != nil {
+		template = naming.Template(*namingTemplate)
+	}
+	return naming.NewNamer(template, createdAt, count)
+}
+
+// Batches created from archives mirror the folder structure of the archive
+func nameBatchEntry(namer *naming.Namer, index int, member models.BatchRequestMember) string {
+	directory, originalName := "", member.FileName
+	if member.SourcePath != nil {
+		directory, originalName = path.Split(*member.SourcePath)
 	}
-	if err := json.Unmarshal(convertRequestsJSON, &batchRequest.ConvertRequests); err != nil {
-		return fmt.Errorf("failed to unmarshal batch convert requests: %w", err)
+	return namer.Name(index+1, directory, originalName, ".pdf")
+}
+
+func createArchiveFromBatchRequest(batchRequestId string, manifest models.BatchRequestManifest, batchRequest batchRequestToProcess) error {
+	password := ""
+	if batchRequest.ArchivePassword != nil {
+		var err error
+		if password, err = archives.OpenPassword(batchRequest.ArchivePassword); err != nil {
+			return err
+		}
 	}
 
-	zipFilePath := filepath.Join(config.Config.UploadsFolderAbsolutePath, fmt.Sprintf("%s.zip", batchRequestId))
-	zipFile, err := os.Create(zipFilePath)
+	extension := models.BatchFileExtension(batchRequest.OutputType, batchRequest.ArchiveFormat)
+	archiveFile, err := os.Create(filepath.Join(config.Config.UploadsFolderAbsolutePath, batchRequestId+extension))
 	if err != nil {
-		return fmt.Errorf("failed to create zip file: %w", err)
+		return fmt.Errorf("failed to create archive file: %w", err)
 	}
-	defer zipFile.Close()
+	defer archiveFile.Close()
 
-	zipWriter := zip.NewWriter(zipFile)
+	archiveWriter, err := archives.NewWriter(batchRequest.ArchiveFormat, archiveFile, password)
+	if err != nil {
+		return err
+	}
 
-	for _, convertRequest := range batchRequest.ConvertRequests {
-		filePath := filepath.Join(config.Config.UploadsFolderAbsolutePath, fmt.Sprintf("%s_converted", convertRequest.Id))
-		file, err := os.Open(filePath)
-		if os.IsNotExist(err) {
-			fmt.Printf("File to batch %s does not exist, skipping\n", filePath)
+	namer := newBatchNamer(batchRequest.NamingTemplate, batchRequest.CreatedAt, len(manifest))
+	modified := time.Now()
+
+	for i, entry := range manifest {
+		if entry.Status != models.ConvertRequestStatusDone {
 			continue
 		}
+
+		filePath := filepath.Join(config.Config.UploadsFolderAbsolutePath, fmt.Sprintf("%s_converted", entry.ConvertRequestId))
+		// The files are kept until the batch is processed, a missing one would make the archive silently incomplete
+		file, err := os.Open(filePath)
 		if err != nil {
-			return fmt.Errorf("failed to open file: %w", err)
+			return fmt.Errorf("failed to open file of convert request %s: %w", entry.ConvertRequestId, err)
 		}
-		defer file.Close()
 
-		zipFileWriter, err := zipWriter.Create(fmt.Sprintf("%s.pdf", convertRequest.FileName))
+		entryName := nameBatchEntry(namer, i, batchRequest.ConvertRequests[i])
+		err = addFileToArchive(archiveWriter, entryName, modified, file)
+		file.Close()
 		if err != nil {
-			return fmt.Errorf("failed to create zip entry: %w", err)
+			return err
 		}
 
-		if _, err := io.Copy(zipFileWriter, file); err != nil {
-			return fmt.Errorf("failed to write file to zip: %w", err)
-		}
+		manifest[i].EntryName = &entryName
+		manifest[i].Included = true
+	}
+
+	if err := writeManifestToArchive(archiveWriter, batchRequestId, manifest, modified); err != nil {
+		return err
 	}
 
-	if err := zipWriter.Close(); err != nil {
-		return fmt.Errorf("failed to close zip writer: %w", err)
+	if err := archiveWriter.Close(); err != nil {
+		return fmt.Errorf("failed to close archive writer: %w", err)
 	}
 
-	logrus.Infof("Batch request %s processed successfully", batchRequestId)
 	return nil
 }
 
-func updateBatchRequestStatus(batchRequestId string, err error) {
+func addFileToArchive(archiveWriter archives.Writer, entryName string, modified time.Time, file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	return archiveWriter.AddFile(entryName, info.Size(), modified, file)
+}
+
+// Only queued batch requests are updated, e.g. the ones cancelled by an admin in the meantime stay cancelled
+func updateBatchRequestStatus(batchRequestId string, manifest models.BatchRequestManifest, err error) {
 	if err == nil {
-		_, err := database.Connection.Exec(
-			"UPDATE batch_request SET status = $1, batched_at = $2 WHERE id = $3",
+		result, err := database.Connection.Exec(
+			`
+        UPDATE batch_request
+        SET status = $1, batched_at = $2, batched_file_count = $3, manifest = $4, archive_password = NULL
+        WHERE id = $5 AND status = $6
+      `,
 			models.BatchRequestStatusDone,
 			"NOW()",
+			countIncludedManifestEntries(manifest),
+			manifest,
 			batchRequestId,
+			models.BatchRequestStatusQueued,
 		)
-		if err != nil {
-			logrus.Errorf("Failed to update status of batch request with id: %s, error: %s\n", batchRequestId, err)
-		}
+		logBatchRequestStatusUpdate(batchRequestId, result, err)
 		return
 	}
 
@@ -205,14 +394,23 @@ func updateBatchRequestStatus(batchRequestId string, err error) {
 		errorMessage = errorMessage[:1000]
 	}
 
-	_, err = database.Connection.Exec(
-		"UPDATE batch_request SET status = $1, error = $2 WHERE id = $3",
+	result, err := database.Connection.Exec(
+		"UPDATE batch_request SET status = $1, error = $2, archive_password = NULL WHERE id = $3 AND status = $4",
 		models.BatchRequestStatusError,
 		errorMessage,
 		batchRequestId,
+		models.BatchRequestStatusQueued,
 	)
+	logBatchRequestStatusUpdate(batchRequestId, result, err)
+}
 
+func logBatchRequestStatusUpdate(batchRequestId string, result sql.Result, err error) {
 	if err != nil {
 		logrus.Errorf("Failed to update status of batch request with id: %s, error: %s\n", batchRequestId, err)
+		return
+	}
+
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		logrus.Warnf("Batch request with id: %s is not queued anymore, its status is not updated", batchRequestId)
 	}
 }
@@ -0,0 +1,194 @@
+package background
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/jmoiron/sqlx"
+	"github.com/karpov-kir/word-to-pdf/backend/archives"
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/database"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/karpov-kir/word-to-pdf/backend/pdf"
+)
+
+// Builds the manifest from the current state of the convert requests, in the order of the batch.
+// Page counts are recorded on conversion, reading the converted files for older convert requests is optional.
+func BuildBatchRequestManifest(members []models.BatchRequestMember, withPageCounts bool) (models.BatchRequestManifest, error) {
+	manifest := make(models.BatchRequestManifest, 0, len(members))
+	if len(members) == 0 {
+		return manifest, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(members))
+	for _, member := range members {
+		ids = append(ids, member.Id)
+	}
+
+	query, args, err := sqlx.In(`SELECT id, status, error, error_code, page_count FROM convert_requests WHERE id IN (?)`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build in clause in query: %w", err)
+	}
+	query = database.Connection.Rebind(query)
+
+	convertRequests := []struct {
+		Id        uuid.UUID                       `db:"id"`
+		Status    models.ConvertRequestStatus     `db:"status"`
+		Error     *string                         `db:"error"`
+		ErrorCode *models.ConvertRequestErrorCode `db:"error_code"`
+		PageCount *int                            `db:"page_count"`
+	}{}
+	if err := database.Connection.Select(&convertRequests, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to fetch convert requests of batch: %w", err)
+	}
+
+	convertRequestsById := make(map[uuid.UUID]int, len(convertRequests))
+	for i, convertRequest := range convertRequests {
+		convertRequestsById[convertRequest.Id] = i
+	}
+
+	for _, member := range members {
+		entry := models.BatchRequestManifestEntry{
+			ConvertRequestId: member.Id,
+			FileName:         member.FileName,
+			// Convert requests can't be deleted at the moment, but it's better to be safe
+			Status: models.ConvertRequestStatusCancelled,
+		}
+		if member.SourcePath != nil {
+			entry.FileName = *member.SourcePath
+		}
+
+		if i, ok := convertRequestsById[member.Id]; ok {
+			entry.Status = convertRequests[i].Status
+			entry.Error = convertRequests[i].Error
+			entry.ErrorCode = convertRequests[i].ErrorCode
+			entry.PageCount = convertRequests[i].PageCount
+		}
+
+		if entry.Status == models.ConvertRequestStatusDone {
+			convertedFilePath := filepath.Join(config.Config.UploadsFolderAbsolutePath, fmt.Sprintf("%s_converted", member.Id))
+
+			if info, err := os.Stat(convertedFilePath); err == nil {
+				outputSize := info.Size()
+				entry.OutputSize = &outputSize
+			}
+
+			if withPageCounts && entry.OutputSize != nil && entry.PageCount == nil {
+				if pageCount, err := pdf.CountPagesInFile(convertedFilePath); err == nil {
+					entry.PageCount = &pageCount
+				}
+			}
+		}
+
+		manifest = append(manifest, entry)
+	}
+
+	return manifest, nil
+}
+
+func countIncludedManifestEntries(manifest models.BatchRequestManifest) int {
+	includedCount := 0
+	for _, entry := range manifest {
+		if entry.Included {
+			includedCount++
+		}
+	}
+	return includedCount
+}
+
+const (
+	batchManifestFileName = "manifest.json"
+	batchReportFileName   = "report.txt"
+)
+
+// The manifest is for machines and the report is for people, both list skipped and failed documents too
+func renderBatchManifestFiles(batchRequestId string, manifest models.BatchRequestManifest, generatedAt time.Time) ([]byte, []byte, error) {
+	manifestJSON, err := json.MarshalIndent(struct {
+		BatchRequestId string                      `json:"batchRequestId"`
+		Members        models.BatchRequestManifest `json:"members"`
+	}{batchRequestId, manifest}, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	var report bytes.Buffer
+	if err := writeBatchReport(&report, batchRequestId, manifest, generatedAt); err != nil {
+		return nil, nil, fmt.Errorf("failed to write report: %w", err)
+	}
+
+	return manifestJSON, report.Bytes(), nil
+}
+
+func writeManifestToArchive(archiveWriter archives.Writer, batchRequestId string, manifest models.BatchRequestManifest, generatedAt time.Time) error {
+	manifestJSON, report, err := renderBatchManifestFiles(batchRequestId, manifest, generatedAt)
+	if err != nil {
+		return err
+	}
+
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{batchManifestFileName, manifestJSON},
+		{batchReportFileName, report},
+	}
+
+	for _, file := range files {
+		if err := archiveWriter.AddFile(file.name, int64(len(file.content)), generatedAt, bytes.NewReader(file.content)); err != nil {
+			return fmt.Errorf("failed to write %s to archive: %w", file.name, err)
+		}
+	}
+
+	return nil
+}
+
+func writeBatchReport(writer io.Writer, batchRequestId string, manifest models.BatchRequestManifest, generatedAt time.Time) error {
+	includedCount := countIncludedManifestEntries(manifest)
+
+	fmt.Fprintf(writer, "Batch %s\n", batchRequestId)
+	fmt.Fprintf(writer, "Generated at %s\n", generatedAt.UTC().Format(time.RFC1123))
+	fmt.Fprintf(writer, "Included %d of %d documents\n\n", includedCount, len(manifest))
+
+	tabWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tabWriter, "File\tStatus\tOutput\tPages\tSize\tError")
+
+	for _, entry := range manifest {
+		output, pages, size, errorMessage := "-", "-", "-", ""
+		if entry.EntryName != nil {
+			output = *entry.EntryName
+		}
+		if entry.PageCount != nil {
+			pages = fmt.Sprint(*entry.PageCount)
+		}
+		if entry.OutputSize != nil {
+			size = formatFileSize(*entry.OutputSize)
+		}
+		if entry.Error != nil {
+			errorMessage = *entry.Error
+		} else if !entry.Included && entry.Status != models.ConvertRequestStatusDone {
+			errorMessage = "Not converted in time"
+		}
+
+		fmt.Fprintf(tabWriter, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.FileName, entry.Status, output, pages, size, errorMessage)
+	}
+
+	return tabWriter.Flush()
+}
+
+func formatFileSize(size int64) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(size)/1024/1024)
+	case size >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
@@ -0,0 +1,128 @@
+package background
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/karpov-kir/word-to-pdf/backend/archives"
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/database"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/sirupsen/logrus"
+)
+
+type streamedBatchRequest struct {
+	ConvertRequests models.BatchRequestMembers  `db:"convert_requests"`
+	NamingTemplate  *string                     `db:"naming_template"`
+	CreatedAt       time.Time                   `db:"created_at"`
+	BatchedAt       *time.Time                  `db:"batched_at"`
+	Manifest        models.BatchRequestManifest `db:"manifest"`
+}
+
+// Streamed batches are not processed in the background. Instead, the manifest (with the names and the checksums
+// of the files) is built on the first download and stored, so that every download, including resumed ones,
+// gets exactly the same zip.
+func OpenStreamedBatchZip(batchRequestId string) (*archives.StreamedZip, error) {
+	batchRequest, err := fetchStreamedBatchRequest(batchRequestId)
+	if err != nil {
+		return nil, err
+	}
+
+	if batchRequest.Manifest == nil {
+		manifest, err := buildStreamedBatchManifest(batchRequest)
+		if err != nil {
+			return nil, err
+		}
+
+		// Concurrent first downloads build the same manifest, only one of them is stored
+		_, err = database.Connection.Exec(
+			"UPDATE batch_request SET manifest = $1, batched_file_count = $2 WHERE id = $3 AND manifest IS NULL",
+			manifest,
+			countIncludedManifestEntries(manifest),
+			batchRequestId,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store manifest of streamed batch request: %w", err)
+		}
+
+		if batchRequest, err = fetchStreamedBatchRequest(batchRequestId); err != nil {
+			return nil, err
+		}
+	}
+
+	modified := batchRequest.CreatedAt
+	if batchRequest.BatchedAt != nil {
+		modified = *batchRequest.BatchedAt
+	}
+
+	manifestJSON, report, err := renderBatchManifestFiles(batchRequestId, batchRequest.Manifest, modified)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []archives.StreamedZipEntry{}
+	for _, entry := range batchRequest.Manifest {
+		if !entry.Included || entry.EntryName == nil || entry.OutputSize == nil || entry.Crc32 == nil {
+			continue
+		}
+
+		entries = append(entries, archives.StreamedZipEntry{
+			Name:     *entry.EntryName,
+			FilePath: filepath.Join(config.Config.UploadsFolderAbsolutePath, fmt.Sprintf("%s_converted", entry.ConvertRequestId)),
+			Size:     *entry.OutputSize,
+			Crc32:    *entry.Crc32,
+		})
+	}
+	entries = append(
+		entries,
+		archives.StreamedZipEntry{Name: batchManifestFileName, Content: manifestJSON},
+		archives.StreamedZipEntry{Name: batchReportFileName, Content: report},
+	)
+
+	return archives.NewStreamedZip(entries, modified)
+}
+
+func fetchStreamedBatchRequest(batchRequestId string) (streamedBatchRequest, error) {
+	var batchRequest streamedBatchRequest
+	err := database.Connection.Get(
+		&batchRequest,
+		`SELECT convert_requests, naming_template, created_at, batched_at, manifest FROM batch_request WHERE id = $1`,
+		batchRequestId,
+	)
+	if err != nil {
+		return batchRequest, fmt.Errorf("failed to fetch streamed batch request: %w", err)
+	}
+
+	return batchRequest, nil
+}
+
+func buildStreamedBatchManifest(batchRequest streamedBatchRequest) (models.BatchRequestManifest, error) {
+	manifest, err := BuildBatchRequestManifest(batchRequest.ConvertRequests, true)
+	if err != nil {
+		return nil, err
+	}
+
+	namer := newBatchNamer(batchRequest.NamingTemplate, batchRequest.CreatedAt, len(manifest))
+
+	for i, entry := range manifest {
+		if entry.Status != models.ConvertRequestStatusDone || entry.OutputSize == nil {
+			continue
+		}
+
+		filePath := filepath.Join(config.Config.UploadsFolderAbsolutePath, fmt.Sprintf("%s_converted", entry.ConvertRequestId))
+		checksum, size, err := archives.ChecksumFile(filePath)
+		if err != nil {
+			logrus.Warnf("Failed to checksum file to stream %s, skipping: %v", filePath, err)
+			continue
+		}
+
+		entryName := nameBatchEntry(namer, i, batchRequest.ConvertRequests[i])
+		manifest[i].EntryName = &entryName
+		manifest[i].OutputSize = &size
+		manifest[i].Crc32 = &checksum
+		manifest[i].Included = true
+	}
+
+	return manifest, nil
+}
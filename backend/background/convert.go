@@ -2,18 +2,17 @@ package background
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"io"
-	"mime/multipart"
-	"net/http"
-	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/jmoiron/sqlx"
 
+	"github.com/karpov-kir/word-to-pdf/backend/cache"
 	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/converters"
 	"github.com/karpov-kir/word-to-pdf/backend/database"
 	"github.com/karpov-kir/word-to-pdf/backend/models"
 	"github.com/karpov-kir/word-to-pdf/backend/utils"
@@ -26,7 +25,7 @@ func ProcessQueuedConvertRequests(taskPool *utils.TaskPool) {
 	for {
 		time.Sleep(config.Config.PollQueuedConvertRequestsInterval)
 
-		if taskPool.LeftSlots() == 0 {
+		if IsProcessorPaused(ConvertProcessor) || taskPool.LeftSlots() == 0 {
 			continue
 		}
 
@@ -50,33 +49,108 @@ func ProcessQueuedConvertRequests(taskPool *utils.TaskPool) {
 
 		logrus.Infof("Fetched %d queued convert requests out of %d total queued convert requests", len(queuedConvertRequests), totalQueuedConvertRequestCount)
 
-		const maxRetries = 2
-		const retryDelay = 2 * time.Second
-
 		for _, queuedConvertRequest := range queuedConvertRequests {
 			queuedConvertRequestId := queuedConvertRequest.Id.String()
-			if !taskPool.AddTask(func(ctx context.Context) {
-				var err error
-				for i := range maxRetries {
-					err = convertWordToPdfWithGotenberg(queuedConvertRequestId, queuedConvertRequest.FileName)
-					if err == nil {
-						break
-					}
-					logrus.Warnf("Failed to process convertRequest with id: %s, error: %s, retrying... (%d/%d)", queuedConvertRequestId, err, i+1, maxRetries)
-					time.Sleep(retryDelay)
-				}
-				updateConvertRequestStatus(queuedConvertRequestId, err)
-			}, queuedConvertRequestId) {
+			if !taskPool.AddWeightedTask(func(ctx context.Context) {
+				processConvertRequest(ctx, queuedConvertRequest)
+			}, queuedConvertRequestId, ConvertRequestWeight(queuedConvertRequest.FileSize)) {
 				logrus.Warnf("Could not add task to process convert request with id: %s, no available slots or token already occupied", queuedConvertRequestId)
 			}
 		}
 	}
 }
 
-func fetchQueuedConvertRequests(convertRequestsInProgress []string, limit int) ([]struct {
-	Id       uuid.UUID `db:"id"`
-	FileName string    `db:"file_name"`
-}, int, error) {
+// Large files take more of the weight budget of the task pool, so that a few of them can't take all the capacity
+// of the conversion services. The size of files from source URLs is not known before they are fetched.
+func ConvertRequestWeight(fileSize int64) int {
+	return 1 + int(fileSize/config.Config.ConvertWeightUnitSize)
+}
+
+// Converts a single convert request right away, e.g. for synchronous conversions. The caller is responsible
+// for running it in the task pool, so that it counts against the concurrency limit.
+func ProcessConvertRequest(ctx context.Context, convertRequestId string) error {
+	var convertRequest queuedConvertRequest
+	err := database.Connection.Get(
+		&convertRequest,
+		"SELECT id, user_id, file_name, file_size, mime_type, conversion_options, cache_key, source_url, attempt_count FROM convert_requests WHERE id = $1",
+		convertRequestId,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to fetch convert request: %w", err)
+	}
+
+	return processConvertRequest(ctx, convertRequest)
+}
+
+// Makes a single attempt and returns the conversion error. The status of the convert request is updated either way,
+// failed attempts are queued again when they can be retried.
+func processConvertRequest(ctx context.Context, convertRequest queuedConvertRequest) error {
+	convertRequestId := convertRequest.Id.String()
+	if err := pickUp("convert_requests", convertRequestId, string(models.ConvertRequestStatusQueued)); err != nil {
+		logrus.Infof("Skipping convert request with id: %s: %s", convertRequestId, err)
+		return err
+	}
+	defer release("convert_requests", convertRequestId)
+
+	job := converters.Job{
+		ConvertRequestId: convertRequestId,
+		FileName:         convertRequest.FileName,
+		MimeType:         convertRequest.MimeType,
+		Options:          convertRequest.ConversionOptions,
+	}
+
+	attempt := convertRequest.AttemptCount + 1
+	startedAt := time.Now()
+
+	if convertRequest.SourceUrl != nil {
+		cacheKey, restoredOutput, err := fetchConvertRequestSource(ctx, convertRequest)
+		if err != nil {
+			finishConvertRequestAttempt(convertRequestId, attempt, fetchAttemptEngineName, startedAt, converters.Output{}, err)
+			return err
+		}
+		if restoredOutput != nil {
+			finishConvertRequestAttempt(convertRequestId, attempt, cacheAttemptEngineName, startedAt, *restoredOutput, nil)
+			return nil
+		}
+		convertRequest.CacheKey = &cacheKey
+	}
+
+	// The engine became unavailable after the convert request was picked up, it stays queued without using an attempt
+	engine, err := converters.SelectEngine(job.MimeType)
+	if err != nil {
+		logrus.Warnf("Convert request with id: %s waits for the conversion engine: %s", convertRequestId, err)
+		return err
+	}
+
+	output, err := converters.Convert(ctx, engine, job)
+	if errors.Is(err, converters.ErrBreakerOpen) {
+		logrus.Warnf("Convert request with id: %s waits for the conversion engine: %s", convertRequestId, err)
+		return err
+	}
+	finishConvertRequestAttempt(convertRequestId, attempt, engine.Name(), startedAt, output, err)
+
+	if err == nil && convertRequest.CacheKey != nil {
+		if err := cache.Store(*convertRequest.CacheKey, job.OutputFilePath()); err != nil {
+			logrus.Errorf("Failed to cache converted file of convert request with id: %s, error: %s", convertRequestId, err)
+		}
+	}
+
+	return err
+}
+
+type queuedConvertRequest struct {
+	Id                uuid.UUID                `db:"id"`
+	UserId            string                   `db:"user_id"`
+	FileName          string                   `db:"file_name"`
+	FileSize          int64                    `db:"file_size"`
+	MimeType          string                   `db:"mime_type"`
+	ConversionOptions models.ConversionOptions `db:"conversion_options"`
+	CacheKey          *string                  `db:"cache_key"`
+	SourceUrl         *string                  `db:"source_url"`
+	AttemptCount      int                      `db:"attempt_count"`
+}
+
+func fetchQueuedConvertRequests(convertRequestsInProgress []string, limit int) ([]queuedConvertRequest, int, error) {
 	namedArgs := map[string]interface{}{
 		"status":                    models.ConvertRequestStatusQueued,
 		"convertRequestsInProgress": convertRequestsInProgress,
@@ -84,14 +158,29 @@ func fetchQueuedConvertRequests(convertRequestsInProgress []string, limit int) (
 	}
 	whereClause := `
     WHERE status = :status
-      AND created_at >= NOW() - INTERVAL '12 HOURS'
+      AND ` + DueAt + ` >= NOW() - INTERVAL '12 HOURS'
+      AND (not_before IS NULL OR not_before <= NOW())
+      AND ` + NotPickedUp + `
   `
 	if len(convertRequestsInProgress) > 0 {
 		whereClause += " AND id NOT IN (:convertRequestsInProgress)"
 	}
 
+	// Convert requests wait while the breakers of their engines are open
+	availableMimeTypes, unavailableMimeTypes, defaultEngineAvailable := converters.MimeTypesByAvailability()
+	if !defaultEngineAvailable {
+		if len(availableMimeTypes) == 0 {
+			return []queuedConvertRequest{}, 0, nil
+		}
+		namedArgs["availableMimeTypes"] = availableMimeTypes
+		whereClause += " AND mime_type IN (:availableMimeTypes)"
+	} else if len(unavailableMimeTypes) > 0 {
+		namedArgs["unavailableMimeTypes"] = unavailableMimeTypes
+		whereClause += " AND mime_type NOT IN (:unavailableMimeTypes)"
+	}
+
 	query, args, err := sqlx.Named(
-		`SELECT id, file_name FROM convert_requests `+whereClause+` ORDER BY created_at DESC LIMIT :limit`,
+		`SELECT id, file_name, file_size, mime_type, conversion_options, cache_key, source_url, attempt_count FROM convert_requests `+whereClause+` `+schedulingOrder()+` LIMIT :limit`,
 		namedArgs,
 	)
 	if err != nil {
@@ -107,10 +196,7 @@ func fetchQueuedConvertRequests(convertRequestsInProgress []string, limit int) (
 
 	logrus.WithField("args", args).WithField("query", query).Debug("Selecting queued convert requests")
 
-	queuedConvertRequests := []struct {
-		Id       uuid.UUID `db:"id"`
-		FileName string    `db:"file_name"`
-	}{}
+	queuedConvertRequests := []queuedConvertRequest{}
 	err = database.Connection.Select(&queuedConvertRequests, query, args...)
 
 	if err != nil {
@@ -138,164 +224,63 @@ func fetchQueuedConvertRequests(convertRequestsInProgress []string, limit int) (
 	return queuedConvertRequests, totalQueuedConvertRequestCount, nil
 }
 
-func convertWordToPdfWithDocxToPdf(convertRequestId string) error {
-	logrus.Infof("Processing convertRequest with id: %s using docx-to-pdf", convertRequestId)
-
-	originalFilePath := filepath.Join(config.Config.UploadsFolderAbsolutePath, convertRequestId)
-	originalFile, err := os.Open(originalFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
-	}
-	defer originalFile.Close()
-
-	pipeRead, pipeWrite := io.Pipe()
-	multipartWriter := multipart.NewWriter(pipeWrite)
-
-	go func() {
-		defer pipeWrite.Close()
-		defer multipartWriter.Close()
-
-		multipartFileWriter, err := multipartWriter.CreateFormFile("document", "dummy-file-name")
-		if err != nil {
-			pipeWrite.CloseWithError(fmt.Errorf("failed to start transferring data form file: %w", err))
-			return
-		}
-
-		_, err = io.Copy(multipartFileWriter, originalFile)
-		if err != nil {
-			pipeWrite.CloseWithError(fmt.Errorf("failed to transfer file content: %w", err))
-			return
-		}
-	}()
-
-	docxToPdfRequest, err := http.NewRequest("POST", config.Config.DocxToPdfApiUrl+"/pdf", pipeRead)
-	if err != nil {
-		return fmt.Errorf("failed to create DOCX to PDF request: %w", err)
-	}
-	docxToPdfRequest.Header.Set("Content-Type", multipartWriter.FormDataContentType())
-
-	httpClient := &http.Client{}
-	resp, err := httpClient.Do(docxToPdfRequest)
-	if err != nil {
-		return fmt.Errorf("failed to send DOCX to PDF request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to convert file, status code: %d", resp.StatusCode)
-	}
-
-	convertedFilePath := filepath.Join(config.Config.UploadsFolderAbsolutePath, fmt.Sprintf("%s_converted", convertRequestId))
-	convertedFile, err := os.Create(convertedFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
-	}
-	defer convertedFile.Close()
-
-	_, err = io.Copy(convertedFile, resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to save converted file: %w", err)
-	}
-
-	logrus.Infof("File from convert request %s converted successfully using docx-to-pdf", convertRequestId)
-
-	return nil
-}
-
-func convertWordToPdfWithGotenberg(convertRequestId string, fileName string) error {
-	logrus.Infof("Processing convertRequest with id: %s using Gotenberg", convertRequestId)
-
-	originalFilePath := filepath.Join(config.Config.UploadsFolderAbsolutePath, convertRequestId)
-	originalFile, err := os.Open(originalFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
-	}
-	defer originalFile.Close()
-
-	pipeRead, pipeWrite := io.Pipe()
-	multipartWriter := multipart.NewWriter(pipeWrite)
-
-	go func() {
-		defer pipeWrite.Close()
-		defer multipartWriter.Close()
-
-		logrus.Infof("Creating form file with name: %s", fileName)
-		multipartFileWriter, err := multipartWriter.CreateFormFile("files", fileName)
-		if err != nil {
-			pipeWrite.CloseWithError(fmt.Errorf("failed to start transferring data form file: %w", err))
-			return
-		}
-
-		_, err = io.Copy(multipartFileWriter, originalFile)
-		if err != nil {
-			pipeWrite.CloseWithError(fmt.Errorf("failed to transfer file content: %w", err))
-			return
-		}
-	}()
-
-	gotenbergToPdfRequest, err := http.NewRequest("POST", config.Config.GotenbergApiUrl+"/forms/libreoffice/convert", pipeRead)
-	if err != nil {
-		return fmt.Errorf("failed to create Gotenberg request: %w", err)
-	}
-	gotenbergToPdfRequest.Header.Set("Content-Type", multipartWriter.FormDataContentType())
-
-	httpClient := &http.Client{}
-	resp, err := httpClient.Do(gotenbergToPdfRequest)
-	if err != nil {
-		return fmt.Errorf("failed to send Gotenberg request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to convert file, status code: %d", resp.StatusCode)
-	}
+// Attempts that are not converting a file are recorded under these names
+const (
+	fetchAttemptEngineName = "fetch"
+	cacheAttemptEngineName = "cache"
+)
 
-	convertedFilePath := filepath.Join(config.Config.UploadsFolderAbsolutePath, fmt.Sprintf("%s_converted", convertRequestId))
-	convertedFile, err := os.Create(convertedFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
-	}
-	defer convertedFile.Close()
+func finishConvertRequestAttempt(convertRequestId string, attempt int, engine string, startedAt time.Time, output converters.Output, convertError error) {
+	recordConvertRequestAttempt(convertRequestId, attempt, engine, startedAt, convertError)
 
-	_, err = io.Copy(convertedFile, resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to save converted file: %w", err)
+	if convertError != nil && shouldRetry(attempt, convertError) {
+		scheduleConvertRequestRetry(convertRequestId, attempt, convertError)
+		return
 	}
 
-	logrus.Infof("File from convert request %s converted successfully using Gotenberg", convertRequestId)
-
-	return nil
+	updateConvertRequestStatus(convertRequestId, attempt, output, convertError)
 }
 
-func updateConvertRequestStatus(convertRequestId string, convertError error) {
+// The output is recorded only for done convert requests. Only queued convert requests are updated, e.g. the ones
+// cancelled by an admin in the meantime stay cancelled.
+func updateConvertRequestStatus(convertRequestId string, attempt int, output converters.Output, convertError error) {
 	if convertError == nil {
-		_, err := database.Connection.Exec(
-			"UPDATE convert_requests SET status = $1, converted_at = $2 WHERE id = $3",
+		result, err := database.Connection.Exec(
+			"UPDATE convert_requests SET status = $1, converted_at = $2, page_count = $3, output_size = $4, attempt_count = $5 WHERE id = $6 AND status = $7",
 			models.ConvertRequestStatusDone,
 			"NOW()",
+			output.PageCount,
+			output.Size,
+			attempt,
 			convertRequestId,
+			models.ConvertRequestStatusQueued,
 		)
-		if err != nil {
-			logrus.Errorf("Failed to update status of convert request with id: %s, error: %s\n", convertRequestId, err)
-		}
+		logConvertRequestStatusUpdate(convertRequestId, result, err)
 		return
 	}
 
-	logrus.Errorf("Failed to process convertRequest with id: %s, error: %s\n", convertRequestId, convertError)
+	errorCode := converters.ErrorCodeOf(convertError)
+	logrus.Errorf("Failed to process convertRequest with id: %s, error (%s): %s\n", convertRequestId, errorCode, convertError)
 
-	convertErrorMessage := convertError.Error()
-	if len(convertErrorMessage) > 1000 {
-		convertErrorMessage = convertErrorMessage[:1000]
-	}
-
-	_, err := database.Connection.Exec(
-		"UPDATE convert_requests SET status = $1, error = $2 WHERE id = $3",
+	result, err := database.Connection.Exec(
+		"UPDATE convert_requests SET status = $1, error = $2, error_code = $3, attempt_count = $4 WHERE id = $5 AND status = $6",
 		models.ConvertRequestStatusError,
-		convertErrorMessage,
+		truncateConvertError(convertError),
+		errorCode,
+		attempt,
 		convertRequestId,
+		models.ConvertRequestStatusQueued,
 	)
+	logConvertRequestStatusUpdate(convertRequestId, result, err)
+}
 
+func logConvertRequestStatusUpdate(convertRequestId string, result sql.Result, err error) {
 	if err != nil {
 		logrus.Errorf("Failed to update status of convert request with id: %s, error: %s\n", convertRequestId, err)
+		return
+	}
+
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		logrus.Warnf("Convert request with id: %s is not queued anymore, its status is not updated", convertRequestId)
 	}
 }
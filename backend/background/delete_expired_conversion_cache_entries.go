@@ -0,0 +1,59 @@
+package background
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/karpov-kir/word-to-pdf/backend/cache"
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/database"
+	"github.com/sirupsen/logrus"
+)
+
+// Cache entries follow CONVERSION_CACHE_TTL instead of DELETE_OLD_FILES_THRESHOLD. When the cache is disabled,
+// all entries left from before are deleted.
+func StartDeletingExpiredConversionCacheEntries() {
+	ttlSeconds := int(config.Config.ConversionCacheTtl.Seconds())
+
+	logrus.Infof(
+		"Deleting conversion cache entries that are older than %s every %s",
+		config.Config.ConversionCacheTtl,
+		config.Config.DeleteOldFilesInterval,
+	)
+
+	for {
+		time.Sleep(config.Config.DeleteOldFilesInterval)
+
+		expiredCacheKeys := []string{}
+		err := database.Connection.Select(
+			&expiredCacheKeys,
+			fmt.Sprintf("SELECT cache_key FROM conversion_cache WHERE created_at < NOW() - INTERVAL '%d SECONDS' LIMIT 1000", ttlSeconds),
+		)
+		if err != nil {
+			logrus.Errorf("Failed to fetch expired conversion cache entries: %v", err)
+			continue
+		}
+
+		// Just to not spam logs
+		if len(expiredCacheKeys) == 0 {
+			continue
+		}
+
+		logrus.Infof("Fetched %d expired conversion cache entries", len(expiredCacheKeys))
+
+		for _, cacheKey := range expiredCacheKeys {
+			if !deleteFiles([]string{cache.FilePath(cacheKey)}) {
+				continue
+			}
+
+			// The entry could be stored again in the meantime, then it's kept (a missing file is a cache miss)
+			_, err := database.Connection.Exec(
+				fmt.Sprintf("DELETE FROM conversion_cache WHERE cache_key = $1 AND created_at < NOW() - INTERVAL '%d SECONDS'", ttlSeconds),
+				cacheKey,
+			)
+			if err != nil {
+				logrus.Errorf("Failed to delete conversion cache entry %s: %v", cacheKey, err)
+			}
+		}
+	}
+}
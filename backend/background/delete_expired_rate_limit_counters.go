@@ -0,0 +1,32 @@
+package background
+
+import (
+	"time"
+
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/database"
+	"github.com/sirupsen/logrus"
+)
+
+// Counters of the postgres rate limit store are not needed after their window ends
+func StartDeletingExpiredRateLimitCounters() {
+	if config.Config.RateLimitStore != "postgres" {
+		return
+	}
+
+	logrus.Infof("Deleting expired rate limit counters every %s", config.Config.DeleteOldFilesInterval)
+
+	for {
+		time.Sleep(config.Config.DeleteOldFilesInterval)
+
+		result, err := database.Connection.Exec("DELETE FROM rate_limit_counters WHERE expires_at < $1", time.Now().UTC())
+		if err != nil {
+			logrus.Errorf("Failed to delete expired rate limit counters: %v", err)
+			continue
+		}
+
+		if deletedCount, _ := result.RowsAffected(); deletedCount > 0 {
+			logrus.Infof("Deleted %d expired rate limit counters", deletedCount)
+		}
+	}
+}
@@ -2,7 +2,6 @@ package background
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 	"time"
 
@@ -42,7 +41,7 @@ func StartDeletingOldBatchRequestFiles() {
             status = :errorStatus
           )
           OR (
-            created_at < NOW() - INTERVAL '24 HOURS'
+            `+DueAt+` < NOW() - INTERVAL '24 HOURS'
             AND status = :queuedStatus
           )
         )
@@ -91,17 +90,12 @@ func StartDeletingOldBatchRequestFiles() {
 		logrus.Infof("Fetched %d batch requests to delete old files out of %d", len(batchRequestsToDeleteFiles), totalBatchRequestsToDeleteFiles)
 
 		for _, batchRequestToDeleteFile := range batchRequestsToDeleteFiles {
-			zipFilePath := filepath.Join(config.Config.UploadsFolderAbsolutePath, fmt.Sprintf("%s.zip", batchRequestToDeleteFile.Id))
+			filePaths := batchRequestFilePaths(batchRequestToDeleteFile.Id)
 
-			logrus.Infof("Deleting file %s", zipFilePath)
+			logrus.Infof("Deleting files %v", filePaths)
 
-			if err := os.Remove(zipFilePath); err != nil {
-				if os.IsNotExist(err) {
-					logrus.Infof("File to delete %s does not exist, ignoring: %v", zipFilePath, err)
-				} else {
-					logrus.Errorf("Failed to delete file %s (will be retried): %v", zipFilePath, err)
-					continue
-				}
+			if !deleteFiles(filePaths) {
+				continue
 			}
 
 			_, err := database.Connection.Exec(
@@ -121,3 +115,11 @@ func StartDeletingOldBatchRequestFiles() {
 		logrus.Infof("Tried to clean up files from %d batch requests", len(batchRequestsToDeleteFiles))
 	}
 }
+
+func batchRequestFilePaths(batchRequestId string) []string {
+	return []string{
+		filepath.Join(config.Config.UploadsFolderAbsolutePath, fmt.Sprintf("%s.zip", batchRequestId)),
+		filepath.Join(config.Config.UploadsFolderAbsolutePath, fmt.Sprintf("%s.pdf", batchRequestId)),
+		filepath.Join(config.Config.UploadsFolderAbsolutePath, fmt.Sprintf("%s.tar.gz", batchRequestId)),
+	}
+}
@@ -26,9 +26,10 @@ func StartDeletingOldConvertRequestFiles() {
 		time.Sleep(config.Config.DeleteOldFilesInterval)
 
 		namedArgs := map[string]interface{}{
-			"doneStatus":   models.ConvertRequestStatusDone,
-			"errorStatus":  models.ConvertRequestStatusError,
-			"queuedStatus": models.ConvertRequestStatusQueued,
+			"doneStatus":      models.ConvertRequestStatusDone,
+			"errorStatus":     models.ConvertRequestStatusError,
+			"cancelledStatus": models.ConvertRequestStatusCancelled,
+			"queuedStatus":    models.ConvertRequestStatusQueued,
 		}
 
 		whereClause := fmt.Sprintf(`
@@ -42,11 +43,16 @@ func StartDeletingOldConvertRequestFiles() {
             status = :errorStatus
           )
           OR (
-            created_at < NOW() - INTERVAL '24 HOURS'
+            status = :cancelledStatus
+            AND `+NotPickedUp+`
+          )
+          OR (
+            `+DueAt+` < NOW() - INTERVAL '24 HOURS'
             AND status = :queuedStatus
           )
         )
         AND is_file_deleted = FALSE
+        AND NOT `+neededByBatches()+`
     `, thresholdMinutes)
 
 		query, args, err := sqlx.Named(
@@ -91,27 +97,12 @@ func StartDeletingOldConvertRequestFiles() {
 		logrus.Infof("Fetched %d convert requests to delete old files out of %d", len(convertRequestsToDeleteFiles), totalConvertRequestsToDeleteFiles)
 
 		for _, convertRequestToDeleteFile := range convertRequestsToDeleteFiles {
-			uploadedFilePath := filepath.Join(config.Config.UploadsFolderAbsolutePath, convertRequestToDeleteFile.Id)
-			convertedFilePath := filepath.Join(config.Config.UploadsFolderAbsolutePath, convertRequestToDeleteFile.Id+"_converted")
-
-			logrus.Infof("Deleting files %s and %s", uploadedFilePath, convertedFilePath)
-
-			if err := os.Remove(uploadedFilePath); err != nil {
-				if os.IsNotExist(err) {
-					logrus.Infof("File to delete %s does not exist, ignoring: %v", uploadedFilePath, err)
-				} else {
-					logrus.Errorf("Failed to delete file %s (will be retried): %v", uploadedFilePath, err)
-					continue
-				}
-			}
+			filePaths := convertRequestFilePaths(convertRequestToDeleteFile.Id)
+
+			logrus.Infof("Deleting files %v", filePaths)
 
-			if err := os.Remove(convertedFilePath); err != nil {
-				if os.IsNotExist(err) {
-					logrus.Infof("File to delete %s does not exist, ignoring: %v", convertedFilePath, err)
-				} else {
-					logrus.Errorf("Failed to delete file %s (will be retried): %v", convertedFilePath, err)
-					continue
-				}
+			if !deleteFiles(filePaths) {
+				continue
 			}
 
 			_, err := database.Connection.Exec(
@@ -131,3 +122,60 @@ func StartDeletingOldConvertRequestFiles() {
 		logrus.Infof("Tried to clean up files from %d convert requests", len(convertRequestsToDeleteFiles))
 	}
 }
+
+// Batches read the converted files of their convert requests when they are processed (waiting batches can wait
+// for a long time for the last convert request) and streamed batches on every download, so the files are kept until
+// the batch is processed or, for streamed batches, deleted. Queued batches that are not picked up anymore don't count.
+// The same goes for the convert requests that a batch schedule collects on its next run.
+func neededByBatches() string {
+	return fmt.Sprintf(`
+    (
+      EXISTS (
+        SELECT 1 FROM batch_request
+        WHERE batch_request.convert_requests @> jsonb_build_array(jsonb_build_object('id', convert_requests.id))
+          AND (
+            batch_request.status = '%s'
+            OR (
+              batch_request.status = '%s'
+              AND COALESCE(batch_request.not_before, batch_request.created_at) >= NOW() - INTERVAL '12 HOURS'
+            )
+            OR (
+              batch_request.streamed
+              AND batch_request.status = '%s'
+              AND batch_request.is_batch_deleted = FALSE
+            )
+          )
+      )
+      OR EXISTS (
+        SELECT 1 FROM batch_schedules
+        WHERE batch_schedules.user_id = convert_requests.user_id
+          AND convert_requests.tags @> ARRAY[batch_schedules.tag]::TEXT[]
+          AND convert_requests.created_at > COALESCE(batch_schedules.last_run_at, batch_schedules.created_at)
+      )
+    )
+  `, models.BatchRequestStatusWaiting, models.BatchRequestStatusQueued, models.BatchRequestStatusDone)
+}
+
+func convertRequestFilePaths(convertRequestId string) []string {
+	return []string{
+		filepath.Join(config.Config.UploadsFolderAbsolutePath, convertRequestId),
+		filepath.Join(config.Config.UploadsFolderAbsolutePath, convertRequestId+"_assets"),
+		filepath.Join(config.Config.UploadsFolderAbsolutePath, convertRequestId+"_converted"),
+	}
+}
+
+// Returns false if at least one of the files could not be deleted, missing files are ignored
+func deleteFiles(filePaths []string) bool {
+	for _, filePath := range filePaths {
+		if err := os.Remove(filePath); err != nil {
+			if os.IsNotExist(err) {
+				logrus.Debugf("File to delete %s does not exist, ignoring: %v", filePath, err)
+			} else {
+				logrus.Errorf("Failed to delete file %s (will be retried): %v", filePath, err)
+				return false
+			}
+		}
+	}
+
+	return true
+}
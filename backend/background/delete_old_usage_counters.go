@@ -0,0 +1,29 @@
+package background
+
+import (
+	"time"
+
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/database"
+	"github.com/sirupsen/logrus"
+)
+
+// Quotas reset by themselves as new days and months get new counters, the past ones are kept for a while
+// to look into the usage
+func StartDeletingOldUsageCounters() {
+	logrus.Infof("Deleting usage counters that are older than 3 months every %s", config.Config.DeleteOldFilesInterval)
+
+	for {
+		time.Sleep(config.Config.DeleteOldFilesInterval)
+
+		result, err := database.Connection.Exec("DELETE FROM usage_counters WHERE period_start < $1", time.Now().UTC().AddDate(0, -3, 0))
+		if err != nil {
+			logrus.Errorf("Failed to delete old usage counters: %v", err)
+			continue
+		}
+
+		if deletedCount, _ := result.RowsAffected(); deletedCount > 0 {
+			logrus.Infof("Deleted %d old usage counters", deletedCount)
+		}
+	}
+}
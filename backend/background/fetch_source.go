@@ -0,0 +1,93 @@
+package background
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/karpov-kir/word-to-pdf/backend/cache"
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/converters"
+	"github.com/karpov-kir/word-to-pdf/backend/database"
+	"github.com/karpov-kir/word-to-pdf/backend/quota"
+	"github.com/karpov-kir/word-to-pdf/backend/remote"
+	"github.com/sirupsen/logrus"
+)
+
+// Downloads the file of a convert request created from a URL. The content is known only now, so the cache key
+// is calculated here and the converted file is restored from the conversion cache when possible (the output is returned then).
+func fetchConvertRequestSource(ctx context.Context, convertRequest queuedConvertRequest) (string, *converters.Output, error) {
+	convertRequestId := convertRequest.Id.String()
+	job := converters.Job{ConvertRequestId: convertRequestId}
+
+	// Already fetched before a failed conversion
+	if convertRequest.CacheKey != nil {
+		if _, err := os.Stat(job.InputFilePath()); err == nil {
+			return *convertRequest.CacheKey, nil, nil
+		}
+	}
+
+	// The size is known only after the download, so the download is capped by what is left of the upload quota
+	remainingUploadBytes, uploadBytesQuota, err := quota.RemainingUploadBytes(database.Connection, convertRequest.UserId)
+	if err != nil {
+		return "", nil, err
+	}
+	maxFileSize := min(config.Config.SourceUrlMaxFileSize, remainingUploadBytes)
+
+	logrus.Infof("Fetching file of convert request %s from %s", convertRequestId, *convertRequest.SourceUrl)
+
+	fetchedFile, err := remote.Fetch(ctx, *convertRequest.SourceUrl, convertRequest.MimeType, job.InputFilePath(), maxFileSize)
+	if errors.Is(err, remote.ErrFileTooLarge) && maxFileSize < config.Config.SourceUrlMaxFileSize {
+		return "", nil, uploadBytesQuota
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to fetch source URL: %w", err)
+	}
+
+	logrus.Infof("Fetched file of convert request %s, %d bytes", convertRequestId, fetchedFile.Size)
+
+	cacheKey, err := cache.Key(fetchedFile.ContentHash, "", convertRequest.MimeType, convertRequest.ConversionOptions)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Counted along with the cache key, which marks the file as fetched. Concurrent fetches of the user could have used
+	// the quota in the meantime, the file is fetched again on the next attempt then.
+	if err := countFetchedBytes(convertRequest.UserId, convertRequestId, fetchedFile, cacheKey); err != nil {
+		os.Remove(job.InputFilePath())
+		return "", nil, err
+	}
+
+	if output, restored := cache.Restore(cacheKey, job); restored {
+		logrus.Infof("Converted file of convert request %s is restored from cache entry %s", convertRequestId, cacheKey)
+		return cacheKey, &output, nil
+	}
+
+	return cacheKey, nil, nil
+}
+
+func countFetchedBytes(userId string, convertRequestId string, fetchedFile remote.FetchedFile, cacheKey string) error {
+	tx, err := database.Connection.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := quota.Consume(tx, userId, quota.Usage{UploadedBytes: fetchedFile.Size}); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE convert_requests SET file_size = $1, content_hash = $2, cache_key = $3 WHERE id = $4",
+		fetchedFile.Size,
+		fetchedFile.ContentHash,
+		cacheKey,
+		convertRequestId,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update fetched convert request: %w", err)
+	}
+
+	return tx.Commit()
+}
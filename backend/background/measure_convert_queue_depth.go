@@ -0,0 +1,36 @@
+package background
+
+import (
+	"time"
+
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/database"
+	"github.com/karpov-kir/word-to-pdf/backend/metrics"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/sirupsen/logrus"
+)
+
+// Publishes the backlog for the upload backpressure (ratelimit.Backpressure). Delayed convert requests that are
+// not due yet are not a backlog.
+func StartMeasuringConvertQueueDepth() {
+	for {
+		var queueDepth int64
+		err := database.Connection.Get(
+			&queueDepth,
+			`
+        SELECT COUNT(*) FROM convert_requests
+        WHERE status = $1
+          AND `+DueAt+` >= NOW() - INTERVAL '12 HOURS'
+          AND (not_before IS NULL OR not_before <= NOW())
+      `,
+			models.ConvertRequestStatusQueued,
+		)
+		if err != nil {
+			logrus.Errorf("Failed to measure convert queue depth: %v", err)
+		} else {
+			metrics.ConvertQueueDepth.Set(queueDepth)
+		}
+
+		time.Sleep(config.Config.PollQueuedConvertRequestsInterval)
+	}
+}
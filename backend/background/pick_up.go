@@ -0,0 +1,41 @@
+package background
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/karpov-kir/word-to-pdf/backend/database"
+	"github.com/sirupsen/logrus"
+)
+
+// Requests picked up by a processor of any instance are left alone by processors of other instances and by admin
+// operations. Requests of instances that died while processing them are released after an hour.
+const NotPickedUp = "(picked_up_at IS NULL OR picked_up_at < NOW() - INTERVAL '1 HOUR')"
+
+var errNotPickedUp = errors.New("not queued anymore or picked up by another instance")
+
+// Marks the queued request as picked up. Fails with errNotPickedUp when it's not queued anymore (e.g. cancelled
+// by an admin) or another instance works on it.
+func pickUp(table string, id string, queuedStatus string) error {
+	result, err := database.Connection.Exec(
+		`UPDATE `+table+` SET picked_up_at = NOW() WHERE id = $1 AND status = $2 AND `+NotPickedUp,
+		id,
+		queuedStatus,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to pick up %s: %w", id, err)
+	}
+
+	if pickedUp, err := result.RowsAffected(); err != nil || pickedUp == 0 {
+		return fmt.Errorf("%s: %w", id, errNotPickedUp)
+	}
+
+	return nil
+}
+
+// Called once the processor is done with the request, whatever the outcome
+func release(table string, id string) {
+	if _, err := database.Connection.Exec(`UPDATE `+table+` SET picked_up_at = NULL WHERE id = $1`, id); err != nil {
+		logrus.Errorf("Failed to release %s: %v", id, err)
+	}
+}
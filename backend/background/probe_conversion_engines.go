@@ -0,0 +1,24 @@
+package background
+
+import (
+	"context"
+	"time"
+
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/converters"
+	"github.com/sirupsen/logrus"
+)
+
+// Open breakers are closed only through successful probes, closed ones are opened by failed probes before
+// any convert request fails
+func StartProbingConversionEngines(ctx context.Context) {
+	logrus.Infof("Probing health of %d conversion service endpoints every %s", len(converters.Breakers()), config.Config.ConversionEngineProbeInterval)
+
+	for {
+		time.Sleep(config.Config.ConversionEngineProbeInterval)
+
+		for _, breaker := range converters.Breakers() {
+			breaker.Probe(ctx)
+		}
+	}
+}
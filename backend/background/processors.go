@@ -0,0 +1,89 @@
+package background
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/database"
+	"github.com/sirupsen/logrus"
+)
+
+// Names of the processors that can be paused through the admin API
+const (
+	ConvertProcessor = "convert"
+	BatchProcessor   = "batch"
+)
+
+var ErrUnknownProcessor = errors.New("unknown processor")
+
+// Paused processors don't pick up queued requests, the tasks in flight are finished. The state is stored in
+// the paused_processors table, so it's shared by all instances, every instance keeps a copy that is synced
+// by StartSyncingPausedProcessors.
+var pausedProcessors = map[string]*atomic.Bool{
+	ConvertProcessor: {},
+	BatchProcessor:   {},
+}
+
+func SetProcessorPaused(name string, paused bool) error {
+	pausedProcessor, ok := pausedProcessors[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownProcessor, name)
+	}
+
+	var err error
+	if paused {
+		_, err = database.Connection.Exec(
+			"INSERT INTO paused_processors (name, paused_at) VALUES ($1, NOW()) ON CONFLICT (name) DO NOTHING",
+			name,
+		)
+	} else {
+		_, err = database.Connection.Exec("DELETE FROM paused_processors WHERE name = $1", name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store paused state of processor %s: %w", name, err)
+	}
+
+	setPaused(name, pausedProcessor, paused)
+	return nil
+}
+
+func IsProcessorPaused(name string) bool {
+	return pausedProcessors[name].Load()
+}
+
+// Other instances see a pause or a resume within a poll interval
+func StartSyncingPausedProcessors() {
+	for {
+		if err := syncPausedProcessors(); err != nil {
+			logrus.Errorf("Failed to sync paused processors: %v", err)
+		}
+
+		time.Sleep(config.Config.PollQueuedConvertRequestsInterval)
+	}
+}
+
+func syncPausedProcessors() error {
+	pausedNames := []string{}
+	if err := database.Connection.Select(&pausedNames, "SELECT name FROM paused_processors"); err != nil {
+		return err
+	}
+
+	for name, pausedProcessor := range pausedProcessors {
+		paused := false
+		for _, pausedName := range pausedNames {
+			paused = paused || pausedName == name
+		}
+		setPaused(name, pausedProcessor, paused)
+	}
+
+	return nil
+}
+
+func setPaused(name string, pausedProcessor *atomic.Bool, paused bool) {
+	if pausedProcessor.Swap(paused) != paused {
+		logrus.Infof("Processor %s is paused: %t", name, paused)
+	}
+}
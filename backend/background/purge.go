@@ -0,0 +1,80 @@
+package background
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/karpov-kir/word-to-pdf/backend/database"
+	"github.com/sirupsen/logrus"
+)
+
+// Deletes the rows of the convert requests, including their attempts, and then their files. Convert requests
+// picked up by a processor of any instance are kept.
+func PurgeConvertRequests(convertRequestIds []string) (int64, error) {
+	tx, err := database.Connection.Beginx()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	purgedIds, err := deleteNotPickedUp(tx, "convert_requests", convertRequestIds)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete convert requests: %w", err)
+	}
+
+	if len(purgedIds) > 0 {
+		query, args, err := sqlx.In("DELETE FROM convert_request_attempts WHERE convert_request_id IN (?)", purgedIds)
+		if err != nil {
+			return 0, fmt.Errorf("failed to build in clause in query: %w", err)
+		}
+		if _, err := tx.Exec(tx.Rebind(query), args...); err != nil {
+			return 0, fmt.Errorf("failed to delete convert request attempts: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	// The rows are gone, so files that fail to be deleted are not retried by the cleanup jobs
+	for _, convertRequestId := range purgedIds {
+		if !deleteFiles(convertRequestFilePaths(convertRequestId)) {
+			logrus.Errorf("Failed to delete files of purged convert request %s", convertRequestId)
+		}
+	}
+
+	logrus.Infof("Purged %d convert requests", len(purgedIds))
+	return int64(len(purgedIds)), nil
+}
+
+// Deletes the rows of the batch requests and then their files, the convert requests of the batches are kept.
+// Batch requests picked up by a processor of any instance are kept.
+func PurgeBatchRequests(batchRequestIds []string) (int64, error) {
+	purgedIds, err := deleteNotPickedUp(database.Connection, "batch_request", batchRequestIds)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete batch requests: %w", err)
+	}
+
+	for _, batchRequestId := range purgedIds {
+		if !deleteFiles(batchRequestFilePaths(batchRequestId)) {
+			logrus.Errorf("Failed to delete files of purged batch request %s", batchRequestId)
+		}
+	}
+
+	logrus.Infof("Purged %d batch requests", len(purgedIds))
+	return int64(len(purgedIds)), nil
+}
+
+func deleteNotPickedUp(db sqlx.Ext, table string, ids []string) ([]string, error) {
+	query, args, err := sqlx.In(`DELETE FROM `+table+` WHERE id IN (?) AND `+NotPickedUp+` RETURNING id`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build in clause in query: %w", err)
+	}
+
+	deletedIds := []string{}
+	if err := sqlx.Select(db, &deletedIds, db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+
+	return deletedIds, nil
+}
@@ -0,0 +1,107 @@
+package background
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/converters"
+	"github.com/karpov-kir/word-to-pdf/backend/database"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/sirupsen/logrus"
+)
+
+// The delay doubles with every failed attempt up to CONVERT_RETRY_MAX_DELAY. Half of it is random, so convert
+// requests failed together (e.g. while Gotenberg is restarting) are not retried at the same moment.
+func retryDelay(failedAttempts int) time.Duration {
+	delay := config.Config.ConvertRetryMaxDelay
+	if failedAttempts <= 30 {
+		delay = min(config.Config.ConvertRetryBaseDelay<<(failedAttempts-1), config.Config.ConvertRetryMaxDelay)
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	return delay/2 + rand.N(delay/2+1)
+}
+
+func shouldRetry(attempt int, err error) bool {
+	return attempt < config.Config.ConvertRetryMaxAttempts && converters.IsRetryable(err)
+}
+
+// Queues the convert request again instead of waiting in the slot, it's picked up once the delay has passed
+func scheduleConvertRequestRetry(convertRequestId string, attempt int, convertError error) {
+	delay := retryDelay(attempt)
+	errorCode := converters.ErrorCodeOf(convertError)
+
+	logrus.Warnf(
+		"Failed to process convertRequest with id: %s, error (%s): %s, retrying in %s (%d/%d)",
+		convertRequestId,
+		errorCode,
+		convertError,
+		delay.Round(time.Millisecond),
+		attempt,
+		config.Config.ConvertRetryMaxAttempts,
+	)
+
+	result, err := database.Connection.Exec(
+		fmt.Sprintf(
+			"UPDATE convert_requests SET status = $1, error = $2, error_code = $3, attempt_count = $4, not_before = NOW() + INTERVAL '%d MILLISECONDS' WHERE id = $5 AND status = $1",
+			delay.Milliseconds(),
+		),
+		models.ConvertRequestStatusQueued,
+		truncateConvertError(convertError),
+		errorCode,
+		attempt,
+		convertRequestId,
+	)
+	logConvertRequestStatusUpdate(convertRequestId, result, err)
+}
+
+// Every attempt is kept, including the ones that restored the output from the conversion cache
+func recordConvertRequestAttempt(convertRequestId string, attempt int, engine string, startedAt time.Time, convertError error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		logrus.Errorf("Failed to generate id of attempt %d of convert request with id: %s, error: %s\n", attempt, convertRequestId, err)
+		return
+	}
+
+	var convertErrorMessage *string
+	var errorCode *models.ConvertRequestErrorCode
+	if convertError != nil {
+		message := truncateConvertError(convertError)
+		code := converters.ErrorCodeOf(convertError)
+		convertErrorMessage = &message
+		errorCode = &code
+	}
+
+	_, err = database.Connection.Exec(
+		`
+      INSERT INTO convert_request_attempts (id, convert_request_id, attempt, engine, started_at, duration_ms, error, error_code)
+      VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+    `,
+		id,
+		convertRequestId,
+		attempt,
+		engine,
+		startedAt,
+		time.Since(startedAt).Milliseconds(),
+		convertErrorMessage,
+		errorCode,
+	)
+	if err != nil {
+		logrus.Errorf("Failed to record attempt %d of convert request with id: %s, error: %s\n", attempt, convertRequestId, err)
+	}
+}
+
+func truncateConvertError(convertError error) string {
+	convertErrorMessage := convertError.Error()
+	if len(convertErrorMessage) > 1000 {
+		convertErrorMessage = convertErrorMessage[:1000]
+	}
+
+	return convertErrorMessage
+}
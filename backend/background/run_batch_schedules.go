@@ -0,0 +1,168 @@
+package background
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/cron"
+	"github.com/karpov-kir/word-to-pdf/backend/database"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/sirupsen/logrus"
+)
+
+// The same limit as for batch requests created through the API
+const maxScheduledBatchSize = 200
+
+type dueBatchSchedule struct {
+	models.BatchSchedule
+	UserId uuid.UUID `db:"user_id"`
+	// Sealed, see archives.SealPassword
+	ArchivePassword []byte `db:"archive_password"`
+}
+
+func StartRunningBatchSchedules() {
+	logrus.Infof("Polling due batch schedules from DB every %s", config.Config.PollBatchSchedulesInterval)
+
+	for {
+		time.Sleep(config.Config.PollBatchSchedulesInterval)
+
+		if err := runDueBatchSchedules(); err != nil {
+			logrus.Errorf("Failed to run due batch schedules: %v", err)
+		}
+	}
+}
+
+// All times of a run come from the clock of the DB, which also sets created_at of convert requests, so that
+// runs are neither early nor late and every convert request falls into exactly one run
+func runDueBatchSchedules() error {
+	now, err := database.Now()
+	if err != nil {
+		return err
+	}
+
+	dueBatchSchedules := []dueBatchSchedule{}
+	if err := database.Connection.Select(
+		&dueBatchSchedules,
+		`
+      SELECT
+        id, user_id, cron_expression, tag, output_type, naming_template, archive_format, archive_password, priority, next_run_at, last_run_at,
+        last_batch_request_id, created_at
+      FROM batch_schedules WHERE next_run_at <= $1 ORDER BY next_run_at LIMIT 100
+    `,
+		now,
+	); err != nil {
+		return fmt.Errorf("failed to select due batch schedules: %w", err)
+	}
+
+	for _, batchSchedule := range dueBatchSchedules {
+		if err := runBatchSchedule(batchSchedule, now); err != nil {
+			logrus.Errorf("Failed to run batch schedule %s: %v", batchSchedule.Id, err)
+		}
+	}
+
+	return nil
+}
+
+// Runs that were missed (e.g. while the server was down) are not caught up, the schedule runs once and moves
+// to the next run from now on
+func runBatchSchedule(batchSchedule dueBatchSchedule, runAt time.Time) error {
+	schedule, err := cron.Parse(batchSchedule.CronExpression)
+	if err != nil {
+		return fmt.Errorf("invalid cron expression: %w", err)
+	}
+
+	// Claimed by moving the next run, so that another instance doesn't run it too
+	result, err := database.Connection.Exec(
+		"UPDATE batch_schedules SET next_run_at = $1 WHERE id = $2 AND next_run_at = $3",
+		schedule.Next(runAt),
+		batchSchedule.Id,
+		batchSchedule.NextRunAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to claim batch schedule: %w", err)
+	}
+	if claimedCount, err := result.RowsAffected(); err != nil || claimedCount == 0 {
+		return err
+	}
+
+	// Convert requests uploaded since the previous successful run, a failed run leaves them to the next one
+	since := batchSchedule.CreatedAt
+	if batchSchedule.LastRunAt != nil {
+		since = *batchSchedule.LastRunAt
+	}
+
+	members := models.BatchRequestMembers{}
+	if err := database.Connection.Select(
+		&members,
+		`
+      SELECT id, file_name, source_path FROM convert_requests
+      WHERE user_id = $1 AND tags @> ARRAY[$2]::TEXT[] AND created_at > $3 AND created_at <= $4 AND status != $5
+      ORDER BY created_at DESC LIMIT $6
+    `,
+		batchSchedule.UserId,
+		batchSchedule.Tag,
+		since,
+		runAt,
+		models.ConvertRequestStatusCancelled,
+		maxScheduledBatchSize,
+	); err != nil {
+		return fmt.Errorf("failed to select convert requests of tag %s: %w", batchSchedule.Tag, err)
+	}
+
+	if len(members) == 0 {
+		logrus.Infof("No new convert requests of tag %s for batch schedule %s, skipping the run", batchSchedule.Tag, batchSchedule.Id)
+		return nil
+	}
+	// Only the latest are batched when more were uploaded
+	if len(members) == maxScheduledBatchSize {
+		logrus.Warnf("Batch schedule %s has at least %d new convert requests, batching the latest ones", batchSchedule.Id, maxScheduledBatchSize)
+	}
+
+	// In the upload order
+	slices.Reverse(members)
+
+	batchRequestId, err := uuid.NewV7()
+	if err != nil {
+		return fmt.Errorf("failed to generate UUID: %w", err)
+	}
+
+	// Waits for the convert requests that are still in progress like any other batch request
+	if _, err := database.Connection.NamedExec(
+		`
+      INSERT INTO batch_request (
+        id, convert_requests, output_type, naming_template, streamed, archive_format, archive_password, priority, status, created_at, user_id
+      )
+      VALUES (
+        :id, :convert_requests, :output_type, :naming_template, FALSE, :archive_format, :archive_password, :priority, :status, NOW(), :user_id
+      )
+    `,
+		map[string]interface{}{
+			"id":               batchRequestId,
+			"convert_requests": members,
+			"output_type":      batchSchedule.OutputType,
+			"naming_template":  batchSchedule.NamingTemplate,
+			"archive_format":   batchSchedule.ArchiveFormat,
+			"archive_password": batchSchedule.ArchivePassword,
+			"priority":         batchSchedule.Priority,
+			"status":           models.BatchRequestStatusWaiting,
+			"user_id":          batchSchedule.UserId,
+		},
+	); err != nil {
+		return fmt.Errorf("failed to insert batch request: %w", err)
+	}
+
+	if _, err := database.Connection.Exec(
+		"UPDATE batch_schedules SET last_run_at = $1, last_batch_request_id = $2 WHERE id = $3",
+		runAt,
+		batchRequestId,
+		batchSchedule.Id,
+	); err != nil {
+		return fmt.Errorf("failed to update last run of batch schedule: %w", err)
+	}
+
+	logrus.Infof("Batch schedule %s created batch request %s with %d convert requests", batchSchedule.Id, batchRequestId, len(members))
+	return nil
+}
@@ -0,0 +1,21 @@
+package background
+
+import (
+	"fmt"
+
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+)
+
+// When a request can be picked up, delayed requests (and retries) wait from their not_before
+const DueAt = "COALESCE(not_before, created_at)"
+
+// Higher priorities go first, a waiting request is raised a level per PRIORITY_AGING_INTERVAL without a cap, so
+// low priority requests are eventually served even while high priority ones keep coming. Within a level the
+// earliest deadline goes first, requests without one go after and the newest first as before (the popup waits for them).
+func schedulingOrder() string {
+	return fmt.Sprintf(
+		"ORDER BY priority + FLOOR(EXTRACT(EPOCH FROM NOW() - %s) / %d) DESC, needed_by ASC NULLS LAST, created_at DESC",
+		DueAt,
+		int(config.Config.PriorityAgingInterval.Seconds()),
+	)
+}
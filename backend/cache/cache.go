@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/converters"
+	"github.com/karpov-kir/word-to-pdf/backend/database"
+	"github.com/karpov-kir/word-to-pdf/backend/metrics"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/karpov-kir/word-to-pdf/backend/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const folderName = "cache"
+
+// The same content converted with the same options gives the same PDF. Engine and stylesheet changes are not
+// part of the key, outdated outputs are dropped by the TTL (CONVERSION_CACHE_TTL).
+func Key(contentHash string, assetsHash string, mimeType string, options models.ConversionOptions) (string, error) {
+	// Options are marshaled in the field order with the empty ones omitted, so equal options give equal JSON
+	normalized, err := json.Marshal(struct {
+		ContentHash string                   `json:"contentHash"`
+		AssetsHash  string                   `json:"assetsHash,omitempty"`
+		MimeType    string                   `json:"mimeType"`
+		Options     models.ConversionOptions `json:"options"`
+	}{contentHash, assetsHash, mimeType, options})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal cache key: %w", err)
+	}
+
+	sum := sha256.Sum256(normalized)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func IsEnabled() bool {
+	return config.Config.ConversionCacheTtl > 0
+}
+
+func FilePath(key string) string {
+	return filepath.Join(config.Config.UploadsFolderAbsolutePath, folderName, key)
+}
+
+// Links the cached output of the key to the output file of the job. Returns false on a miss, including expired entries
+// and entries whose file is gone or doesn't pass the verification.
+func Restore(key string, job converters.Job) (converters.Output, bool) {
+	if !IsEnabled() {
+		return converters.Output{}, false
+	}
+
+	var fileSize int64
+	err := database.Connection.Get(
+		&fileSize,
+		fmt.Sprintf(
+			"SELECT file_size FROM conversion_cache WHERE cache_key = $1 AND created_at >= NOW() - INTERVAL '%d SECONDS'",
+			int(config.Config.ConversionCacheTtl.Seconds()),
+		),
+		key,
+	)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			logrus.Errorf("Failed to look up conversion cache entry %s: %v", key, err)
+		}
+		metrics.ConversionCacheMisses.Add(1)
+		return converters.Output{}, false
+	}
+
+	if fileInfo, err := os.Stat(FilePath(key)); err != nil || fileInfo.Size() != fileSize {
+		logrus.Warnf("File of conversion cache entry %s is missing or changed, ignoring the entry", key)
+		metrics.ConversionCacheMisses.Add(1)
+		return converters.Output{}, false
+	}
+
+	if err := utils.LinkOrCopyFile(FilePath(key), job.OutputFilePath()); err != nil {
+		logrus.Errorf("Failed to restore conversion cache entry %s: %v", key, err)
+		os.Remove(job.OutputFilePath())
+		metrics.ConversionCacheMisses.Add(1)
+		return converters.Output{}, false
+	}
+
+	output, err := converters.VerifyOutput(job)
+	if err != nil {
+		logrus.Errorf("Conversion cache entry %s is invalid, ignoring the entry: %v", key, err)
+		os.Remove(job.OutputFilePath())
+		metrics.ConversionCacheMisses.Add(1)
+		return converters.Output{}, false
+	}
+
+	_, err = database.Connection.Exec(
+		"UPDATE conversion_cache SET hit_count = hit_count + 1, last_hit_at = NOW() WHERE cache_key = $1",
+		key,
+	)
+	if err != nil {
+		logrus.Errorf("Failed to update hits of conversion cache entry %s: %v", key, err)
+	}
+
+	metrics.ConversionCacheHits.Add(1)
+	return output, true
+}
+
+// Stores the converted output under the key. The entry starts its own retention, the output of the convert
+// request itself is deleted independently.
+func Store(key string, convertedFilePath string) error {
+	if !IsEnabled() {
+		return nil
+	}
+
+	fileInfo, err := os.Stat(convertedFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat converted file: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(FilePath(key)), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create cache folder: %w", err)
+	}
+
+	// Requests being restored from the entry at the same time see either the old or the new file, never a partial one
+	temporaryFilePath := FilePath(key) + ".tmp-" + filepath.Base(convertedFilePath)
+	if err := utils.LinkOrCopyFile(convertedFilePath, temporaryFilePath); err != nil {
+		return err
+	}
+	if err := os.Rename(temporaryFilePath, FilePath(key)); err != nil {
+		os.Remove(temporaryFilePath)
+		return fmt.Errorf("failed to move file to cache: %w", err)
+	}
+
+	_, err = database.Connection.Exec(
+		`
+      INSERT INTO conversion_cache (cache_key, file_size, created_at) VALUES ($1, $2, NOW())
+      ON CONFLICT (cache_key) DO UPDATE SET file_size = EXCLUDED.file_size, created_at = EXCLUDED.created_at
+    `,
+		key,
+		fileInfo.Size(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert conversion cache entry: %w", err)
+	}
+
+	return nil
+}
@@ -1,33 +1,142 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/netip"
 	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+type ServiceEndpoint struct {
+	Url string
+	// Requests sent to the endpoint at the same time, 0 is unlimited
+	MaxConcurrency int
+	// The share of requests relative to the other endpoints of the service
+	Weight int
+}
+
+type ApiKey struct {
+	Key string
+	// "low", "normal" or "high"
+	Priority string
+	// Allowed to use the admin API (/admin)
+	Admin bool
+}
+
+// At most Count requests per Window, 0 count disables the limit
+type Rate struct {
+	Count  int
+	Window time.Duration
+}
+
+type RateLimit struct {
+	PerUser Rate
+	PerIp   Rate
+}
+
+// Quotas of users, 0 means unlimited. Days and months are in UTC.
+type Plan struct {
+	DailyConversions   int   `json:"dailyConversions"`
+	MonthlyConversions int   `json:"monthlyConversions"`
+	DailyUploadBytes   int64 `json:"dailyUploadBytes"`
+	MonthlyUploadBytes int64 `json:"monthlyUploadBytes"`
+	DailyBatches       int   `json:"dailyBatches"`
+	MonthlyBatches     int   `json:"monthlyBatches"`
+	// Converted files that are not deleted yet (see DELETE_OLD_FILES_THRESHOLD)
+	RetainedOutputBytes int64 `json:"retainedOutputBytes"`
+}
+
 var Config = &struct {
 	UseStructuredLogging bool
 	LogLevel             logrus.Level
 
-	DocxToPdfApiUrl string
-	GotenbergApiUrl string
+	DocxToPdfApiUrl   string
+	DocxToPdfFailover bool
+	GotenbergApiUrl   string
+	// GotenbergApiUrl is used as the only endpoint when not set
+	GotenbergEndpoints []ServiceEndpoint
+
+	ConversionEngineFailureThreshold int
+	ConversionEngineProbeInterval    time.Duration
+
+	MarkdownStylesheetPath string
+
+	ApiKeys []ApiKey
+
+	// Waiting requests are raised a priority level per interval
+	PriorityAgingInterval time.Duration
 
 	PollQueuedConvertRequestsInterval time.Duration
 	ParallelConvertLimit              int
+	// The limit is adapted between these, starting at ParallelConvertLimit
+	ConvertConcurrencyMin              int
+	ConvertConcurrencyMax              int
+	ConvertConcurrencyLatencyThreshold time.Duration
+	// A conversion weighs 1 plus a unit per ConvertWeightUnitSize of the file, 0 budget disables weighting
+	ConvertWeightBudget            int
+	ConvertWeightUnitSize          int64
+	ConvertWeightStarvationTimeout time.Duration
+
+	ConvertRetryMaxAttempts    int
+	ConvertRetryBaseDelay      time.Duration
+	ConvertRetryMaxDelay       time.Duration
+	ConvertRetryableErrorCodes []string
+
+	SyncConvertMaxFileSize int64
+	SyncConvertTimeout     time.Duration
 
 	PollBatchRequestsInterval time.Duration
 	ParallelBatchLimit        int
+	BatchWaitTimeout          time.Duration
+	// Requests can be delayed at most this far ahead with notBefore
+	MaxScheduleDelay           time.Duration
+	PollBatchSchedulesInterval time.Duration
 
 	DeleteOldFilesInterval  time.Duration
 	DeleteOldFilesThreshold time.Duration
 
+	ConversionCacheTtl time.Duration
+
+	SourceUrlMaxFileSize     int64
+	SourceUrlTimeout         time.Duration
+	SourceUrlMaxRedirects    int
+	SourceUrlAllowedNetworks []netip.Prefix
+
+	ArchiveMaxEntries          int
+	ArchiveMaxUncompressedSize int64
+	ArchiveMaxCompressionRatio int64
+	ArchivePasswordSecret      string
+
+	// Signs access tokens, which carry the priority
+	JwtSecret string
+
+	// "memory" or "postgres", the latter holds the limits across replicas
+	RateLimitStore   string
+	UploadsRateLimit RateLimit
+	BatchesRateLimit RateLimit
+	// Tokens are minted before there is a user
+	TokensRateLimit RateLimit
+	// The header with the client IP set by the reverse proxy (e.g. X-Forwarded-For), the connection address when empty
+	ProxyHeader string
+	// IPs and CIDRs of the reverse proxies, ProxyHeader is only read from requests that come from them
+	TrustedProxies []string
+	// Uploads are rejected while more convert requests are queued, 0 disables backpressure
+	QueueBackpressureThreshold  int
+	QueueBackpressureRetryAfter time.Duration
+
+	// By name, users are on DefaultPlan unless assigned another one in the user_plans table
+	Plans       map[string]Plan
+	DefaultPlan string
+
 	DatabaseHost     string
 	DatabasePort     string
 	DatabaseUser     string
@@ -41,18 +150,94 @@ var Config = &struct {
 	UseStructuredLogging: false,
 	LogLevel:             logrus.InfoLevel,
 
-	DocxToPdfApiUrl: "http://localhost:8085",
-	GotenbergApiUrl: "http://localhost:8090",
+	DocxToPdfApiUrl:    "http://localhost:8085",
+	DocxToPdfFailover:  false,
+	GotenbergApiUrl:    "http://localhost:8090",
+	GotenbergEndpoints: []ServiceEndpoint{},
+
+	ConversionEngineFailureThreshold: 5,
+	ConversionEngineProbeInterval:    10 * time.Second,
+
+	MarkdownStylesheetPath: "",
+
+	ApiKeys: []ApiKey{},
+
+	PriorityAgingInterval: 2 * time.Minute,
 
 	PollQueuedConvertRequestsInterval: 5 * time.Second,
 	ParallelConvertLimit:              15,
-
-	PollBatchRequestsInterval: 5 * time.Second,
-	ParallelBatchLimit:        15,
+	ConvertConcurrencyMin:             1,
+	// ParallelConvertLimit when not set
+	ConvertConcurrencyMax:              0,
+	ConvertConcurrencyLatencyThreshold: 30 * time.Second,
+	ConvertWeightBudget:                100,
+	ConvertWeightUnitSize:              1024 * 1024,
+	ConvertWeightStarvationTimeout:     1 * time.Minute,
+
+	ConvertRetryMaxAttempts: 3,
+	ConvertRetryBaseDelay:   5 * time.Second,
+	ConvertRetryMaxDelay:    5 * time.Minute,
+	// Invalid outputs are mostly truncated responses of the conversion services
+	ConvertRetryableErrorCodes: []string{"engine_unavailable", "timeout", "output_invalid"},
+
+	SyncConvertMaxFileSize: 10 * 1024 * 1024,
+	SyncConvertTimeout:     30 * time.Second,
+
+	PollBatchRequestsInterval:  5 * time.Second,
+	ParallelBatchLimit:         15,
+	BatchWaitTimeout:           30 * time.Minute,
+	MaxScheduleDelay:           7 * 24 * time.Hour,
+	PollBatchSchedulesInterval: 30 * time.Second,
 
 	DeleteOldFilesInterval:  30 * time.Second,
 	DeleteOldFilesThreshold: 1 * time.Minute,
 
+	ConversionCacheTtl: 24 * time.Hour,
+
+	SourceUrlMaxFileSize:     100 * 1024 * 1024,
+	SourceUrlTimeout:         1 * time.Minute,
+	SourceUrlMaxRedirects:    5,
+	SourceUrlAllowedNetworks: []netip.Prefix{},
+
+	ArchiveMaxEntries:          200,
+	ArchiveMaxUncompressedSize: 500 * 1024 * 1024,
+	ArchiveMaxCompressionRatio: 100,
+	ArchivePasswordSecret:      "",
+
+	JwtSecret: "",
+
+	RateLimitStore: "memory",
+	UploadsRateLimit: RateLimit{
+		PerUser: Rate{Count: 60, Window: time.Minute},
+		// Users behind the same NAT share the address
+		PerIp: Rate{Count: 300, Window: time.Minute},
+	},
+	BatchesRateLimit: RateLimit{
+		PerUser: Rate{Count: 20, Window: time.Minute},
+		PerIp:   Rate{Count: 100, Window: time.Minute},
+	},
+	TokensRateLimit: RateLimit{
+		PerIp: Rate{Count: 20, Window: time.Hour},
+	},
+	ProxyHeader:                 "",
+	TrustedProxies:              []string{},
+	QueueBackpressureThreshold:  1000,
+	QueueBackpressureRetryAfter: 30 * time.Second,
+
+	Plans: map[string]Plan{
+		"free": {
+			DailyConversions:    200,
+			MonthlyConversions:  2000,
+			DailyUploadBytes:    1024 * 1024 * 1024,
+			MonthlyUploadBytes:  10 * 1024 * 1024 * 1024,
+			DailyBatches:        50,
+			MonthlyBatches:      500,
+			RetainedOutputBytes: 1024 * 1024 * 1024,
+		},
+		"unlimited": {},
+	},
+	DefaultPlan: "free",
+
 	DatabaseHost:     "localhost",
 	DatabasePort:     "5432",
 	DatabaseUser:     "word-to-pdf",
@@ -85,10 +270,69 @@ func Init() {
 		Config.DocxToPdfApiUrl = os.Getenv("DOC_TO_PDF_API_URL")
 	}
 
+	// .docx files are converted by docx-to-pdf while Gotenberg is unavailable
+	Config.DocxToPdfFailover = os.Getenv("DOC_TO_PDF_FAILOVER") == "true"
+
 	if os.Getenv("GOTENBERG_API_URL") != "" {
 		Config.GotenbergApiUrl = os.Getenv("GOTENBERG_API_URL")
 	}
 
+	// Comma separated endpoints with optional concurrency limits and weights,
+	// e.g. "http://gotenberg-1:3000|4|2,http://gotenberg-2:3000|2"
+	if os.Getenv("GOTENBERG_ENDPOINTS") != "" {
+		for _, endpoint := range strings.Split(os.Getenv("GOTENBERG_ENDPOINTS"), ",") {
+			Config.GotenbergEndpoints = append(Config.GotenbergEndpoints, parseServiceEndpoint(endpoint, "GOTENBERG_ENDPOINTS"))
+		}
+	} else {
+		Config.GotenbergEndpoints = []ServiceEndpoint{{Url: Config.GotenbergApiUrl, Weight: 1}}
+	}
+
+	if os.Getenv("CONVERSION_ENGINE_FAILURE_THRESHOLD") != "" {
+		conversionEngineFailureThreshold, err := strconv.Atoi(os.Getenv("CONVERSION_ENGINE_FAILURE_THRESHOLD"))
+		if err != nil {
+			logrus.Panic("Invalid CONVERSION_ENGINE_FAILURE_THRESHOLD format")
+		}
+
+		Config.ConversionEngineFailureThreshold = conversionEngineFailureThreshold
+	}
+
+	if os.Getenv("CONVERSION_ENGINE_PROBE_INTERVAL") != "" {
+		conversionEngineProbeInterval, err := time.ParseDuration(os.Getenv("CONVERSION_ENGINE_PROBE_INTERVAL"))
+		if err != nil {
+			logrus.Panic("Invalid CONVERSION_ENGINE_PROBE_INTERVAL format")
+		}
+
+		Config.ConversionEngineProbeInterval = conversionEngineProbeInterval
+	}
+
+	if os.Getenv("MARKDOWN_STYLESHEET_PATH") != "" {
+		Config.MarkdownStylesheetPath = os.Getenv("MARKDOWN_STYLESHEET_PATH")
+	}
+
+	// Comma separated "key:priority" pairs, e.g. "backfill-key:low,partner-key:high"
+	if os.Getenv("API_KEYS") != "" {
+		for _, apiKey := range strings.Split(os.Getenv("API_KEYS"), ",") {
+			parts := strings.Split(strings.TrimSpace(apiKey), ":")
+			if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || !slices.Contains([]string{"low", "normal", "high"}, parts[1]) {
+				logrus.Panic("Invalid API_KEYS format")
+			}
+			if len(parts) == 3 && parts[2] != "admin" {
+				logrus.Panic("Invalid API_KEYS format")
+			}
+
+			Config.ApiKeys = append(Config.ApiKeys, ApiKey{Key: parts[0], Priority: parts[1], Admin: len(parts) == 3})
+		}
+	}
+
+	if os.Getenv("PRIORITY_AGING_INTERVAL") != "" {
+		priorityAgingInterval, err := time.ParseDuration(os.Getenv("PRIORITY_AGING_INTERVAL"))
+		if err != nil {
+			logrus.Panic("Invalid PRIORITY_AGING_INTERVAL format")
+		}
+
+		Config.PriorityAgingInterval = priorityAgingInterval
+	}
+
 	if os.Getenv("POLL_QUEUED_CONVERT_REQUESTS_INTERVAL") != "" {
 		pollQueuedFilesInterval, err := time.ParseDuration(os.Getenv("POLL_QUEUED_CONVERT_REQUESTS_INTERVAL"))
 		if err != nil {
@@ -107,6 +351,117 @@ func Init() {
 		Config.ParallelConvertLimit = parallelConvertLimit
 	}
 
+	if os.Getenv("CONVERT_CONCURRENCY_MIN") != "" {
+		convertConcurrencyMin, err := strconv.Atoi(os.Getenv("CONVERT_CONCURRENCY_MIN"))
+		if err != nil {
+			logrus.Panic("Invalid CONVERT_CONCURRENCY_MIN format")
+		}
+
+		Config.ConvertConcurrencyMin = convertConcurrencyMin
+	}
+
+	if os.Getenv("CONVERT_CONCURRENCY_MAX") != "" {
+		convertConcurrencyMax, err := strconv.Atoi(os.Getenv("CONVERT_CONCURRENCY_MAX"))
+		if err != nil {
+			logrus.Panic("Invalid CONVERT_CONCURRENCY_MAX format")
+		}
+
+		Config.ConvertConcurrencyMax = convertConcurrencyMax
+	} else {
+		Config.ConvertConcurrencyMax = Config.ParallelConvertLimit
+	}
+
+	if os.Getenv("CONVERT_CONCURRENCY_LATENCY_THRESHOLD") != "" {
+		convertConcurrencyLatencyThreshold, err := time.ParseDuration(os.Getenv("CONVERT_CONCURRENCY_LATENCY_THRESHOLD"))
+		if err != nil {
+			logrus.Panic("Invalid CONVERT_CONCURRENCY_LATENCY_THRESHOLD format")
+		}
+
+		Config.ConvertConcurrencyLatencyThreshold = convertConcurrencyLatencyThreshold
+	}
+
+	if os.Getenv("CONVERT_WEIGHT_BUDGET") != "" {
+		convertWeightBudget, err := strconv.Atoi(os.Getenv("CONVERT_WEIGHT_BUDGET"))
+		if err != nil {
+			logrus.Panic("Invalid CONVERT_WEIGHT_BUDGET format")
+		}
+
+		Config.ConvertWeightBudget = convertWeightBudget
+	}
+
+	if os.Getenv("CONVERT_WEIGHT_UNIT_SIZE") != "" {
+		convertWeightUnitSize, err := strconv.ParseInt(os.Getenv("CONVERT_WEIGHT_UNIT_SIZE"), 10, 64)
+		if err != nil || convertWeightUnitSize < 1 {
+			logrus.Panic("Invalid CONVERT_WEIGHT_UNIT_SIZE format")
+		}
+
+		Config.ConvertWeightUnitSize = convertWeightUnitSize
+	}
+
+	if os.Getenv("CONVERT_WEIGHT_STARVATION_TIMEOUT") != "" {
+		convertWeightStarvationTimeout, err := time.ParseDuration(os.Getenv("CONVERT_WEIGHT_STARVATION_TIMEOUT"))
+		if err != nil {
+			logrus.Panic("Invalid CONVERT_WEIGHT_STARVATION_TIMEOUT format")
+		}
+
+		Config.ConvertWeightStarvationTimeout = convertWeightStarvationTimeout
+	}
+
+	if os.Getenv("CONVERT_RETRY_MAX_ATTEMPTS") != "" {
+		convertRetryMaxAttempts, err := strconv.Atoi(os.Getenv("CONVERT_RETRY_MAX_ATTEMPTS"))
+		if err != nil {
+			logrus.Panic("Invalid CONVERT_RETRY_MAX_ATTEMPTS format")
+		}
+
+		Config.ConvertRetryMaxAttempts = convertRetryMaxAttempts
+	}
+
+	if os.Getenv("CONVERT_RETRY_BASE_DELAY") != "" {
+		convertRetryBaseDelay, err := time.ParseDuration(os.Getenv("CONVERT_RETRY_BASE_DELAY"))
+		if err != nil {
+			logrus.Panic("Invalid CONVERT_RETRY_BASE_DELAY format")
+		}
+
+		Config.ConvertRetryBaseDelay = convertRetryBaseDelay
+	}
+
+	if os.Getenv("CONVERT_RETRY_MAX_DELAY") != "" {
+		convertRetryMaxDelay, err := time.ParseDuration(os.Getenv("CONVERT_RETRY_MAX_DELAY"))
+		if err != nil {
+			logrus.Panic("Invalid CONVERT_RETRY_MAX_DELAY format")
+		}
+
+		Config.ConvertRetryMaxDelay = convertRetryMaxDelay
+	}
+
+	// Comma separated error codes, e.g. "engine_unavailable,timeout". "none" disables retries by error code.
+	if os.Getenv("CONVERT_RETRYABLE_ERROR_CODES") != "" {
+		Config.ConvertRetryableErrorCodes = []string{}
+		if os.Getenv("CONVERT_RETRYABLE_ERROR_CODES") != "none" {
+			for _, errorCode := range strings.Split(os.Getenv("CONVERT_RETRYABLE_ERROR_CODES"), ",") {
+				Config.ConvertRetryableErrorCodes = append(Config.ConvertRetryableErrorCodes, strings.TrimSpace(errorCode))
+			}
+		}
+	}
+
+	if os.Getenv("SYNC_CONVERT_MAX_FILE_SIZE") != "" {
+		syncConvertMaxFileSize, err := strconv.ParseInt(os.Getenv("SYNC_CONVERT_MAX_FILE_SIZE"), 10, 64)
+		if err != nil {
+			logrus.Panic("Invalid SYNC_CONVERT_MAX_FILE_SIZE format")
+		}
+
+		Config.SyncConvertMaxFileSize = syncConvertMaxFileSize
+	}
+
+	if os.Getenv("SYNC_CONVERT_TIMEOUT") != "" {
+		syncConvertTimeout, err := time.ParseDuration(os.Getenv("SYNC_CONVERT_TIMEOUT"))
+		if err != nil {
+			logrus.Panic("Invalid SYNC_CONVERT_TIMEOUT format")
+		}
+
+		Config.SyncConvertTimeout = syncConvertTimeout
+	}
+
 	if os.Getenv("POLL_BATCH_REQUESTS_INTERVAL") != "" {
 		pollBatchRequestsInterval, err := time.ParseDuration(os.Getenv("POLL_BATCH_REQUESTS_INTERVAL"))
 		if err != nil {
@@ -125,6 +480,33 @@ func Init() {
 		Config.ParallelBatchLimit = parallelBatchLimit
 	}
 
+	if os.Getenv("BATCH_WAIT_TIMEOUT") != "" {
+		batchWaitTimeout, err := time.ParseDuration(os.Getenv("BATCH_WAIT_TIMEOUT"))
+		if err != nil {
+			logrus.Panic("Invalid BATCH_WAIT_TIMEOUT format")
+		}
+
+		Config.BatchWaitTimeout = batchWaitTimeout
+	}
+
+	if os.Getenv("MAX_SCHEDULE_DELAY") != "" {
+		maxScheduleDelay, err := time.ParseDuration(os.Getenv("MAX_SCHEDULE_DELAY"))
+		if err != nil {
+			logrus.Panic("Invalid MAX_SCHEDULE_DELAY format")
+		}
+
+		Config.MaxScheduleDelay = maxScheduleDelay
+	}
+
+	if os.Getenv("POLL_BATCH_SCHEDULES_INTERVAL") != "" {
+		pollBatchSchedulesInterval, err := time.ParseDuration(os.Getenv("POLL_BATCH_SCHEDULES_INTERVAL"))
+		if err != nil {
+			logrus.Panic("Invalid POLL_BATCH_SCHEDULES_INTERVAL format")
+		}
+
+		Config.PollBatchSchedulesInterval = pollBatchSchedulesInterval
+	}
+
 	if os.Getenv("DELETE_OLD_FILES_INTERVAL") != "" {
 		deleteOldFilesInterval, err := time.ParseDuration(os.Getenv("DELETE_OLD_FILES_INTERVAL"))
 		if err != nil {
@@ -143,6 +525,159 @@ func Init() {
 		Config.DeleteOldFilesThreshold = deleteOldFilesThreshold
 	}
 
+	if os.Getenv("CONVERSION_CACHE_TTL") != "" {
+		conversionCacheTtl, err := time.ParseDuration(os.Getenv("CONVERSION_CACHE_TTL"))
+		if err != nil {
+			logrus.Panic("Invalid CONVERSION_CACHE_TTL format")
+		}
+
+		Config.ConversionCacheTtl = conversionCacheTtl
+	}
+
+	if os.Getenv("SOURCE_URL_MAX_FILE_SIZE") != "" {
+		sourceUrlMaxFileSize, err := strconv.ParseInt(os.Getenv("SOURCE_URL_MAX_FILE_SIZE"), 10, 64)
+		if err != nil {
+			logrus.Panic("Invalid SOURCE_URL_MAX_FILE_SIZE format")
+		}
+
+		Config.SourceUrlMaxFileSize = sourceUrlMaxFileSize
+	}
+
+	if os.Getenv("SOURCE_URL_TIMEOUT") != "" {
+		sourceUrlTimeout, err := time.ParseDuration(os.Getenv("SOURCE_URL_TIMEOUT"))
+		if err != nil {
+			logrus.Panic("Invalid SOURCE_URL_TIMEOUT format")
+		}
+
+		Config.SourceUrlTimeout = sourceUrlTimeout
+	}
+
+	if os.Getenv("SOURCE_URL_MAX_REDIRECTS") != "" {
+		sourceUrlMaxRedirects, err := strconv.Atoi(os.Getenv("SOURCE_URL_MAX_REDIRECTS"))
+		if err != nil {
+			logrus.Panic("Invalid SOURCE_URL_MAX_REDIRECTS format")
+		}
+
+		Config.SourceUrlMaxRedirects = sourceUrlMaxRedirects
+	}
+
+	// Comma separated CIDRs, e.g. "10.1.0.0/16,192.168.10.5/32" for intranet file servers
+	if os.Getenv("SOURCE_URL_ALLOWED_NETWORKS") != "" {
+		for _, network := range strings.Split(os.Getenv("SOURCE_URL_ALLOWED_NETWORKS"), ",") {
+			prefix, err := netip.ParsePrefix(strings.TrimSpace(network))
+			if err != nil {
+				logrus.Panic("Invalid SOURCE_URL_ALLOWED_NETWORKS format")
+			}
+
+			Config.SourceUrlAllowedNetworks = append(Config.SourceUrlAllowedNetworks, prefix.Masked())
+		}
+	}
+
+	if os.Getenv("ARCHIVE_MAX_ENTRIES") != "" {
+		archiveMaxEntries, err := strconv.Atoi(os.Getenv("ARCHIVE_MAX_ENTRIES"))
+		if err != nil {
+			logrus.Panic("Invalid ARCHIVE_MAX_ENTRIES format")
+		}
+
+		Config.ArchiveMaxEntries = archiveMaxEntries
+	}
+
+	if os.Getenv("ARCHIVE_MAX_UNCOMPRESSED_SIZE") != "" {
+		archiveMaxUncompressedSize, err := strconv.ParseInt(os.Getenv("ARCHIVE_MAX_UNCOMPRESSED_SIZE"), 10, 64)
+		if err != nil {
+			logrus.Panic("Invalid ARCHIVE_MAX_UNCOMPRESSED_SIZE format")
+		}
+
+		Config.ArchiveMaxUncompressedSize = archiveMaxUncompressedSize
+	}
+
+	if os.Getenv("ARCHIVE_MAX_COMPRESSION_RATIO") != "" {
+		archiveMaxCompressionRatio, err := strconv.ParseInt(os.Getenv("ARCHIVE_MAX_COMPRESSION_RATIO"), 10, 64)
+		if err != nil {
+			logrus.Panic("Invalid ARCHIVE_MAX_COMPRESSION_RATIO format")
+		}
+
+		Config.ArchiveMaxCompressionRatio = archiveMaxCompressionRatio
+	}
+
+	// Queued zip-aes batches are processed by any instance, also after a restart, so all of them need the same secret.
+	// A random one would lose the passwords on restart, so encrypted archives are disabled instead.
+	if os.Getenv("ARCHIVE_PASSWORD_SECRET") != "" {
+		Config.ArchivePasswordSecret = os.Getenv("ARCHIVE_PASSWORD_SECRET")
+	} else {
+		logrus.Warn("ARCHIVE_PASSWORD_SECRET is not set, zip-aes archives are disabled")
+	}
+
+	if os.Getenv("JWT_SECRET") != "" {
+		Config.JwtSecret = os.Getenv("JWT_SECRET")
+	}
+
+	if os.Getenv("RATE_LIMIT_STORE") != "" {
+		Config.RateLimitStore = os.Getenv("RATE_LIMIT_STORE")
+	}
+
+	// "count/window", e.g. "60/1m", "0" disables the limit
+	for envName, rate := range map[string]*Rate{
+		"RATE_LIMIT_UPLOADS_PER_USER": &Config.UploadsRateLimit.PerUser,
+		"RATE_LIMIT_UPLOADS_PER_IP":   &Config.UploadsRateLimit.PerIp,
+		"RATE_LIMIT_BATCHES_PER_USER": &Config.BatchesRateLimit.PerUser,
+		"RATE_LIMIT_BATCHES_PER_IP":   &Config.BatchesRateLimit.PerIp,
+		"RATE_LIMIT_TOKENS_PER_IP":    &Config.TokensRateLimit.PerIp,
+	} {
+		if os.Getenv(envName) != "" {
+			*rate = parseRate(os.Getenv(envName), envName)
+		}
+	}
+
+	if os.Getenv("PROXY_HEADER") != "" {
+		Config.ProxyHeader = os.Getenv("PROXY_HEADER")
+	}
+
+	if os.Getenv("TRUSTED_PROXIES") != "" {
+		for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+			proxy = strings.TrimSpace(proxy)
+			if _, err := netip.ParsePrefix(proxy); err != nil {
+				if _, err := netip.ParseAddr(proxy); err != nil {
+					logrus.Panic("Invalid TRUSTED_PROXIES format")
+				}
+			}
+
+			Config.TrustedProxies = append(Config.TrustedProxies, proxy)
+		}
+	}
+
+	if os.Getenv("QUEUE_BACKPRESSURE_THRESHOLD") != "" {
+		queueBackpressureThreshold, err := strconv.Atoi(os.Getenv("QUEUE_BACKPRESSURE_THRESHOLD"))
+		if err != nil || queueBackpressureThreshold < 0 {
+			logrus.Panic("Invalid QUEUE_BACKPRESSURE_THRESHOLD format")
+		}
+
+		Config.QueueBackpressureThreshold = queueBackpressureThreshold
+	}
+
+	if os.Getenv("QUEUE_BACKPRESSURE_RETRY_AFTER") != "" {
+		queueBackpressureRetryAfter, err := time.ParseDuration(os.Getenv("QUEUE_BACKPRESSURE_RETRY_AFTER"))
+		if err != nil {
+			logrus.Panic("Invalid QUEUE_BACKPRESSURE_RETRY_AFTER format")
+		}
+
+		Config.QueueBackpressureRetryAfter = queueBackpressureRetryAfter
+	}
+
+	// JSON object of plans by name, e.g. {"free": {"dailyConversions": 100}, "pro": {"dailyConversions": 1000}}
+	if os.Getenv("PLANS") != "" {
+		plans := map[string]Plan{}
+		if err := json.Unmarshal([]byte(os.Getenv("PLANS")), &plans); err != nil || len(plans) == 0 {
+			logrus.Panic("Invalid PLANS format")
+		}
+
+		Config.Plans = plans
+	}
+
+	if os.Getenv("DEFAULT_PLAN") != "" {
+		Config.DefaultPlan = os.Getenv("DEFAULT_PLAN")
+	}
+
 	if os.Getenv("DATABASE_HOST") != "" {
 		Config.DatabaseHost = os.Getenv("DATABASE_HOST")
 	}
@@ -188,13 +723,102 @@ func Init() {
 		fmt.Println("Failed to create uploads folder:", err)
 	}
 
+	if _, ok := Config.Plans[Config.DefaultPlan]; !ok {
+		logrus.Panic("DefaultPlan should be one of Plans")
+	}
+
+	// Anyone could mint access tokens with a known secret
+	if Config.JwtSecret == "" {
+		logrus.Panic("JwtSecret should be set")
+	}
+
+	// Otherwise any client can pick the IP it is rate limited by
+	if Config.ProxyHeader != "" && len(Config.TrustedProxies) == 0 {
+		logrus.Panic("TrustedProxies should be set when ProxyHeader is set")
+	}
+
+	if Config.RateLimitStore != "memory" && Config.RateLimitStore != "postgres" {
+		logrus.Panic("RateLimitStore should be memory or postgres")
+	}
+
+	if Config.PriorityAgingInterval < time.Second {
+		logrus.Panic("PriorityAgingInterval should be at least 1 second")
+	}
+
+	if Config.ConvertConcurrencyMin < 1 || Config.ConvertConcurrencyMax < Config.ConvertConcurrencyMin {
+		logrus.Panic("ConvertConcurrencyMin should be at least 1 and at most ConvertConcurrencyMax")
+	}
+
+	if Config.ConversionEngineFailureThreshold < 1 {
+		logrus.Panic("ConversionEngineFailureThreshold should be at least 1")
+	}
+
+	if Config.ConvertRetryMaxAttempts < 1 {
+		logrus.Panic("ConvertRetryMaxAttempts should be at least 1")
+	}
+
 	if Config.DeleteOldFilesThreshold < time.Duration(1*time.Minute) {
 		logrus.Panic("DeleteOldFilesThreshold should be at least 1 minute")
 	}
 
+	// Queued batch requests older than 12 hours are not picked up anymore
+	if Config.BatchWaitTimeout > time.Duration(6*time.Hour) {
+		logrus.Panic("BatchWaitTimeout should be at most 6 hours")
+	}
+
 	logConfig(Config)
 }
 
+func parseServiceEndpoint(value string, envName string) ServiceEndpoint {
+	parts := strings.Split(strings.TrimSpace(value), "|")
+	if len(parts) > 3 || parts[0] == "" {
+		logrus.Panicf("Invalid %s format", envName)
+	}
+
+	endpoint := ServiceEndpoint{Url: strings.TrimSuffix(parts[0], "/"), Weight: 1}
+
+	if len(parts) > 1 {
+		maxConcurrency, err := strconv.Atoi(parts[1])
+		if err != nil || maxConcurrency < 0 {
+			logrus.Panicf("Invalid %s format", envName)
+		}
+		endpoint.MaxConcurrency = maxConcurrency
+	}
+
+	if len(parts) > 2 {
+		weight, err := strconv.Atoi(parts[2])
+		if err != nil || weight < 1 {
+			logrus.Panicf("Invalid %s format", envName)
+		}
+		endpoint.Weight = weight
+	}
+
+	return endpoint
+}
+
+func parseRate(value string, envName string) Rate {
+	if value == "0" {
+		return Rate{}
+	}
+
+	countPart, windowPart, ok := strings.Cut(value, "/")
+	if !ok {
+		logrus.Panicf("Invalid %s format", envName)
+	}
+
+	count, err := strconv.Atoi(countPart)
+	if err != nil || count < 0 {
+		logrus.Panicf("Invalid %s format", envName)
+	}
+
+	window, err := time.ParseDuration(windowPart)
+	if err != nil || window < time.Second {
+		logrus.Panicf("Invalid %s format", envName)
+	}
+
+	return Rate{Count: count, Window: window}
+}
+
 func logConfig(config interface{}) {
 	logFields := logrus.Fields{}
 	val := reflect.ValueOf(config).Elem()
@@ -209,6 +833,12 @@ func logConfig(config interface{}) {
 		if fieldName == "DatabasePassword" {
 			// fieldValue = "*****"
 		}
+		if fieldName == "ArchivePasswordSecret" || fieldName == "JwtSecret" {
+			fieldValue = "*****"
+		}
+		if fieldName == "ApiKeys" {
+			fieldValue = len(Config.ApiKeys)
+		}
 
 		logFields[fieldName] = fieldValue
 		logrus.Info(fieldName, ": ", fieldValue)
@@ -0,0 +1,225 @@
+package converters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/sirupsen/logrus"
+)
+
+const healthProbeTimeout = 5 * time.Second
+
+var ErrBreakerOpen = errors.New("circuit breaker is open")
+
+type BreakerState string
+
+const (
+	BreakerStateClosed BreakerState = "closed"
+	// The service is considered down, nothing is sent to it until a health probe succeeds
+	BreakerStateOpen BreakerState = "open"
+	// A health probe succeeded, a single trial conversion decides whether the breaker is closed or opened again,
+	// other conversions are rejected until then
+	BreakerStateHalfOpen BreakerState = "halfOpen"
+)
+
+// Guards an endpoint of a conversion service, an open breaker ejects the endpoint. The breaker opens after CONVERSION_ENGINE_FAILURE_THRESHOLD consecutive failures
+// of conversions and health probes, so queued convert requests wait for the service instead of failing one by one.
+type Breaker struct {
+	name      string
+	healthUrl string
+
+	mu                  sync.Mutex
+	state               BreakerState
+	consecutiveFailures int
+	// The trial conversion of the half-open breaker is running
+	inTrial bool
+	// Changes when the breaker is opened or half-opened, so that results of requests admitted before don't count
+	generation uint64
+	openedAt   *time.Time
+	lastError  string
+}
+
+type BreakerStatus struct {
+	Name                string       `json:"name"`
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutiveFailures"`
+	OpenedAt            *time.Time   `json:"openedAt,omitempty"`
+	LastError           string       `json:"lastError,omitempty"`
+}
+
+var breakers = []*Breaker{}
+
+func NewBreaker(name string, healthUrl string) *Breaker {
+	breaker := &Breaker{name: name, healthUrl: healthUrl, state: BreakerStateClosed}
+	breakers = append(breakers, breaker)
+	return breaker
+}
+
+func Breakers() []*Breaker {
+	return breakers
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+func (b *Breaker) IsAvailable() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.isAvailable()
+}
+
+// Must be called with the mutex locked
+func (b *Breaker) isAvailable() bool {
+	return b.state == BreakerStateClosed || (b.state == BreakerStateHalfOpen && !b.inTrial)
+}
+
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return BreakerStatus{
+		Name:                b.name,
+		State:               b.state,
+		ConsecutiveFailures: b.consecutiveFailures,
+		OpenedAt:            b.openedAt,
+		LastError:           b.lastError,
+	}
+}
+
+// Only failures of the service itself count, e.g. a corrupt document says nothing about the service, so the state
+// is not changed by it (a half-open breaker waits for another trial then). Requests admitted before the breaker was
+// opened or half-opened are ignored, e.g. a slow request sent while the service was up doesn't close the breaker,
+// in the half-open state only the trial is of the current generation.
+func (b *Breaker) record(generation uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	b.inTrial = false
+
+	// Cancelled by the caller, the service didn't get a chance to respond
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	code := ErrorCodeOf(err)
+	if err != nil && code != models.ConvertRequestErrorCodeEngineUnavailable && code != models.ConvertRequestErrorCodeTimeout {
+		return
+	}
+
+	if err == nil {
+		if b.state != BreakerStateClosed {
+			logrus.Infof("Conversion service endpoint %s is back, closing the circuit breaker", b.name)
+		}
+		b.state = BreakerStateClosed
+		b.consecutiveFailures = 0
+		b.openedAt = nil
+		return
+	}
+
+	b.recordFailure(err)
+}
+
+// Must be called with the mutex locked
+func (b *Breaker) recordFailure(err error) {
+	b.consecutiveFailures++
+	b.lastError = err.Error()
+	if b.state == BreakerStateHalfOpen || b.consecutiveFailures >= config.Config.ConversionEngineFailureThreshold {
+		b.open()
+	}
+}
+
+// Must be called with the mutex locked
+func (b *Breaker) open() {
+	if b.state == BreakerStateOpen {
+		return
+	}
+
+	logrus.Errorf("Conversion service endpoint %s is unavailable, opening the circuit breaker: %s", b.name, b.lastError)
+	now := time.Now()
+	b.state = BreakerStateOpen
+	b.openedAt = &now
+	b.inTrial = false
+	b.generation++
+}
+
+// An open breaker is half-opened by a successful probe. Failed probes count as consecutive failures, a single one
+// doesn't open a closed breaker, e.g. Gotenberg is unhealthy when only one of its modules is down.
+func (b *Breaker) Probe(ctx context.Context) {
+	err := b.checkHealth(ctx)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err != nil {
+		b.recordFailure(err)
+		return
+	}
+
+	if b.state == BreakerStateOpen {
+		logrus.Infof("Health probe of conversion service endpoint %s succeeded, half-opening the circuit breaker", b.name)
+		b.state = BreakerStateHalfOpen
+		b.generation++
+	}
+}
+
+func (b *Breaker) checkHealth(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, healthProbeTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, b.healthUrl, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create health request: %w", err)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("health probe failed: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("health probe failed, status code: %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// Runs a request to the service, failing fast while the breaker is open or the trial of the half-open breaker is running
+func (b *Breaker) run(request func() error) error {
+	generation, ok := b.admit()
+	if !ok {
+		return NewConversionError(models.ConvertRequestErrorCodeEngineUnavailable, fmt.Errorf("%s: %w", b.name, ErrBreakerOpen))
+	}
+
+	err := request()
+	b.record(generation, err)
+
+	return err
+}
+
+// The first request after the breaker is half-opened becomes the trial. Returns the generation the result of the request
+// is recorded for.
+func (b *Breaker) admit() (uint64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.isAvailable() {
+		return 0, false
+	}
+	if b.state == BreakerStateHalfOpen {
+		b.inTrial = true
+	}
+	return b.generation, true
+}
@@ -0,0 +1,141 @@
+package converters
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+)
+
+var errTestEngineUnavailable = NewConversionError(models.ConvertRequestErrorCodeEngineUnavailable, errors.New("connection refused"))
+
+func newTestBreaker(t *testing.T) *Breaker {
+	t.Helper()
+
+	previousThreshold := config.Config.ConversionEngineFailureThreshold
+	config.Config.ConversionEngineFailureThreshold = 1
+	t.Cleanup(func() { config.Config.ConversionEngineFailureThreshold = previousThreshold })
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(server.Close)
+
+	return &Breaker{name: "test", healthUrl: server.URL, state: BreakerStateClosed}
+}
+
+func admitTest(t *testing.T, b *Breaker) uint64 {
+	t.Helper()
+
+	generation, ok := b.admit()
+	if !ok {
+		t.Fatalf("expected the request to be admitted in the %s state", b.Status().State)
+	}
+	return generation
+}
+
+func expectBreakerState(t *testing.T, b *Breaker, state BreakerState) {
+	t.Helper()
+
+	if b.Status().State != state {
+		t.Errorf("expected the %s state, got %s", state, b.Status().State)
+	}
+}
+
+func TestBreakerTrial(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected BreakerState
+		// Whether the next request is admitted
+		available bool
+	}{
+		{"success closes", nil, BreakerStateClosed, true},
+		{"engine failure opens again", errTestEngineUnavailable, BreakerStateOpen, false},
+		{"timeout opens again", NewConversionError(models.ConvertRequestErrorCodeTimeout, errors.New("deadline exceeded")), BreakerStateOpen, false},
+		{"corrupt document waits for another trial", NewConversionError(models.ConvertRequestErrorCodeCorruptInput, errors.New("corrupt")), BreakerStateHalfOpen, true},
+		{"cancelled waits for another trial", context.Canceled, BreakerStateHalfOpen, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := newTestBreaker(t)
+			b.record(admitTest(t, b), errTestEngineUnavailable)
+			expectBreakerState(t, b, BreakerStateOpen)
+
+			b.Probe(context.Background())
+			expectBreakerState(t, b, BreakerStateHalfOpen)
+
+			trial := admitTest(t, b)
+			if b.IsAvailable() {
+				t.Fatalf("expected other requests to be rejected during the trial")
+			}
+
+			b.record(trial, test.err)
+			expectBreakerState(t, b, test.expected)
+			if b.IsAvailable() != test.available {
+				t.Errorf("expected available to be %t", test.available)
+			}
+		})
+	}
+}
+
+// Requests admitted before the breaker was opened can finish at any time later
+func TestBreakerIgnoresEarlierRequests(t *testing.T) {
+	t.Run("success while open", func(t *testing.T) {
+		b := newTestBreaker(t)
+		earlier := admitTest(t, b)
+		b.record(admitTest(t, b), errTestEngineUnavailable)
+
+		b.record(earlier, nil)
+		expectBreakerState(t, b, BreakerStateOpen)
+	})
+
+	t.Run("success during the trial", func(t *testing.T) {
+		b := newTestBreaker(t)
+		earlier := admitTest(t, b)
+		b.record(admitTest(t, b), errTestEngineUnavailable)
+		b.Probe(context.Background())
+		trial := admitTest(t, b)
+
+		b.record(earlier, nil)
+		expectBreakerState(t, b, BreakerStateHalfOpen)
+		if b.IsAvailable() {
+			t.Errorf("expected the trial to be still running")
+		}
+
+		b.record(trial, errTestEngineUnavailable)
+		expectBreakerState(t, b, BreakerStateOpen)
+	})
+
+	t.Run("failure after closing", func(t *testing.T) {
+		b := newTestBreaker(t)
+		earlier := admitTest(t, b)
+		b.record(admitTest(t, b), errTestEngineUnavailable)
+		b.Probe(context.Background())
+		b.record(admitTest(t, b), nil)
+
+		b.record(earlier, errTestEngineUnavailable)
+		expectBreakerState(t, b, BreakerStateClosed)
+		if b.Status().ConsecutiveFailures != 0 {
+			t.Errorf("expected no consecutive failures, got %d", b.Status().ConsecutiveFailures)
+		}
+	})
+}
+
+func TestBreakerFailedProbeEndsTrial(t *testing.T) {
+	b := newTestBreaker(t)
+	b.record(admitTest(t, b), errTestEngineUnavailable)
+	b.Probe(context.Background())
+	trial := admitTest(t, b)
+
+	b.healthUrl = "http://127.0.0.1:0/health"
+	b.Probe(context.Background())
+	expectBreakerState(t, b, BreakerStateOpen)
+
+	// The trial was sent to the half-open breaker that is open again
+	b.record(trial, nil)
+	expectBreakerState(t, b, BreakerStateOpen)
+}
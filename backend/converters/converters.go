@@ -0,0 +1,223 @@
+package converters
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	MimeTypeDoc      = "application/msword"
+	MimeTypeDocx     = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	MimeTypeHtml     = "text/html"
+	MimeTypeMarkdown = "text/markdown"
+	MimeTypeJpeg     = "image/jpeg"
+	MimeTypePng      = "image/png"
+	MimeTypeTiff     = "image/tiff"
+	MimeTypeEmail    = "message/rfc822"
+	MimeTypePdf      = "application/pdf"
+	MimeTypeUnknown  = "application/octet-stream"
+)
+
+var mimeTypesByExtension = map[string]string{
+	".doc":      MimeTypeDoc,
+	".docx":     MimeTypeDocx,
+	".html":     MimeTypeHtml,
+	".htm":      MimeTypeHtml,
+	".md":       MimeTypeMarkdown,
+	".markdown": MimeTypeMarkdown,
+	".jpg":      MimeTypeJpeg,
+	".jpeg":     MimeTypeJpeg,
+	".png":      MimeTypePng,
+	".tif":      MimeTypeTiff,
+	".tiff":     MimeTypeTiff,
+	".eml":      MimeTypeEmail,
+	".pdf":      MimeTypePdf,
+}
+
+type Job struct {
+	ConvertRequestId string
+	FileName         string
+	MimeType         string
+	Options          models.ConversionOptions
+}
+
+func (j Job) InputFilePath() string {
+	return filepath.Join(config.Config.UploadsFolderAbsolutePath, j.ConvertRequestId)
+}
+
+func (j Job) AssetsFilePath() string {
+	return filepath.Join(config.Config.UploadsFolderAbsolutePath, fmt.Sprintf("%s_assets", j.ConvertRequestId))
+}
+
+func (j Job) OutputFilePath() string {
+	return filepath.Join(config.Config.UploadsFolderAbsolutePath, fmt.Sprintf("%s_converted", j.ConvertRequestId))
+}
+
+type Engine interface {
+	Name() string
+	// Reads the input file of the job and writes the resulting PDF to the output file of the job
+	Convert(ctx context.Context, job Job) error
+}
+
+// Engines that send files to a conversion service, they can't convert anything while all its endpoints are ejected
+type serviceEngine interface {
+	Service() *Service
+}
+
+var (
+	enginesByMimeType = map[string]Engine{}
+	// Used while the breaker of the main engine is open
+	fallbackEnginesByMimeType = map[string]Engine{}
+	// Used for everything that is not registered explicitly, LibreOffice is able to handle most of the office formats
+	defaultEngine Engine
+
+	gotenberg *Service
+	docxToPdf *Service
+
+	// Followed by the task pool of convert requests, fed by the requests to the conversion services
+	Limiter *ConcurrencyLimiter
+)
+
+func Register(engine Engine, mimeTypes ...string) {
+	for _, mimeType := range mimeTypes {
+		enginesByMimeType[mimeType] = engine
+	}
+}
+
+func RegisterFallback(engine Engine, mimeTypes ...string) {
+	for _, mimeType := range mimeTypes {
+		fallbackEnginesByMimeType[mimeType] = engine
+	}
+}
+
+func Init() {
+	Limiter = NewConcurrencyLimiter(
+		config.Config.ParallelConvertLimit,
+		config.Config.ConvertConcurrencyMin,
+		config.Config.ConvertConcurrencyMax,
+		config.Config.ConvertConcurrencyLatencyThreshold,
+	)
+	gotenberg = NewService("gotenberg", config.Config.GotenbergEndpoints, "/health")
+
+	libreOffice := &GotenbergLibreOfficeEngine{}
+	chromium := &GotenbergChromiumEngine{}
+	images := &ImageEngine{}
+	email := &EmailEngine{}
+	passthrough := &PassthroughEngine{}
+
+	defaultEngine = libreOffice
+
+	Register(libreOffice, MimeTypeDoc, MimeTypeDocx)
+	Register(chromium, MimeTypeHtml, MimeTypeMarkdown)
+	Register(images, MimeTypeJpeg, MimeTypePng, MimeTypeTiff)
+	Register(email, MimeTypeEmail)
+	Register(passthrough, MimeTypePdf)
+
+	if config.Config.DocxToPdfFailover {
+		docxToPdf = NewService(
+			"docx-to-pdf",
+			[]config.ServiceEndpoint{{Url: config.Config.DocxToPdfApiUrl, Weight: 1}},
+			"/actuator/health",
+		)
+		RegisterFallback(&DocxToPdfEngine{}, MimeTypeDocx)
+	}
+
+	validateRetryableErrorCodes()
+
+	for mimeType, engine := range enginesByMimeType {
+		logrus.Infof("Registered conversion engine %s for %s", engine.Name(), mimeType)
+	}
+}
+
+func DetectMimeType(fileName string) string {
+	if mimeType, ok := mimeTypesByExtension[strings.ToLower(filepath.Ext(fileName))]; ok {
+		return mimeType
+	}
+
+	return MimeTypeUnknown
+}
+
+// Files with unknown extensions are still sent to the default engine when uploaded explicitly,
+// this is for cases when documents are picked automatically (e.g. from archives)
+func IsSupported(fileName string) bool {
+	return DetectMimeType(fileName) != MimeTypeUnknown
+}
+
+func EngineFor(mimeType string) Engine {
+	if engine, ok := enginesByMimeType[mimeType]; ok {
+		return engine
+	}
+
+	return defaultEngine
+}
+
+func isEngineAvailable(engine Engine) bool {
+	serviceEngine, ok := engine.(serviceEngine)
+	return !ok || serviceEngine.Service().IsAvailable()
+}
+
+// Picks the engine for the mime type, falling back to another engine while the breaker of the main one is open.
+// Fails with ErrBreakerOpen when neither is available.
+func SelectEngine(mimeType string) (Engine, error) {
+	engine := EngineFor(mimeType)
+	if isEngineAvailable(engine) {
+		return engine, nil
+	}
+
+	if fallbackEngine, ok := fallbackEnginesByMimeType[mimeType]; ok && isEngineAvailable(fallbackEngine) {
+		logrus.Warnf("Conversion engine %s is unavailable, falling back to %s for %s", engine.Name(), fallbackEngine.Name(), mimeType)
+		return fallbackEngine, nil
+	}
+
+	return nil, NewConversionError(
+		models.ConvertRequestErrorCodeEngineUnavailable,
+		fmt.Errorf("%s: %w", engine.Name(), ErrBreakerOpen),
+	)
+}
+
+func IsAvailable(mimeType string) bool {
+	_, err := SelectEngine(mimeType)
+	return err == nil
+}
+
+// Merging is done by Gotenberg
+func IsMergeAvailable() bool {
+	return gotenberg.IsAvailable()
+}
+
+// Registered mime types split by whether they can be converted right now. Everything else goes to the default engine.
+func MimeTypesByAvailability() (available []string, unavailable []string, defaultAvailable bool) {
+	for mimeType := range enginesByMimeType {
+		if IsAvailable(mimeType) {
+			available = append(available, mimeType)
+		} else {
+			unavailable = append(unavailable, mimeType)
+		}
+	}
+
+	return available, unavailable, isEngineAvailable(defaultEngine)
+}
+
+// The output of every engine is verified, a successful response of a conversion service doesn't guarantee a PDF
+func Convert(ctx context.Context, engine Engine, job Job) (Output, error) {
+	logrus.Infof("Processing convertRequest with id: %s (%s) using %s", job.ConvertRequestId, job.MimeType, engine.Name())
+
+	if err := engine.Convert(ctx, job); err != nil {
+		return Output{}, err
+	}
+
+	output, err := VerifyOutput(job)
+	if err != nil {
+		return Output{}, err
+	}
+
+	logrus.Infof("File from convert request %s converted successfully using %s, %d pages", job.ConvertRequestId, engine.Name(), output.PageCount)
+
+	return output, nil
+}
@@ -0,0 +1,38 @@
+package converters
+
+import (
+	"context"
+	"fmt"
+	"mime/multipart"
+	"os"
+)
+
+// Not registered by default, Gotenberg is used instead. Kept to be able to switch back quickly
+// and as the fallback for .docx files while Gotenberg is unavailable (DOC_TO_PDF_FAILOVER).
+type DocxToPdfEngine struct{}
+
+func (e *DocxToPdfEngine) Name() string {
+	return "docx-to-pdf"
+}
+
+func (e *DocxToPdfEngine) Service() *Service {
+	return docxToPdf
+}
+
+func (e *DocxToPdfEngine) Convert(ctx context.Context, job Job) error {
+	originalFile, err := os.Open(job.InputFilePath())
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer originalFile.Close()
+
+	return postMultipartForm(
+		ctx,
+		docxToPdf,
+		"/pdf",
+		job.OutputFilePath(),
+		func(multipartWriter *multipart.Writer) error {
+			return writeFormFile(multipartWriter, "document", "dummy-file-name", originalFile)
+		},
+	)
+}
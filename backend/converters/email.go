@@ -0,0 +1,264 @@
+package converters
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"strings"
+
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	maxEmailPartDepth   = 10
+	maxEmailAttachments = 20
+)
+
+type emailAttachment struct {
+	fileName string
+	content  []byte
+}
+
+type parsedEmail struct {
+	htmlBody    string
+	textBody    string
+	inlineParts map[string]string // Content-ID -> data URI
+	attachments []emailAttachment
+}
+
+// Renders an email with the header block to HTML and converts it with Chromium. Word attachments
+// are converted with their own engine and appended if requested.
+type EmailEngine struct{}
+
+func (e *EmailEngine) Name() string {
+	return "email"
+}
+
+func (e *EmailEngine) Service() *Service {
+	return gotenberg
+}
+
+func (e *EmailEngine) Convert(ctx context.Context, job Job) error {
+	emailFile, err := os.Open(job.InputFilePath())
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer emailFile.Close()
+
+	message, err := mail.ReadMessage(emailFile)
+	if err != nil {
+		return NewConversionError(models.ConvertRequestErrorCodeCorruptInput, fmt.Errorf("failed to parse email: %w", err))
+	}
+
+	email := &parsedEmail{inlineParts: map[string]string{}}
+	if err := email.readPart(textproto.MIMEHeader(message.Header), message.Body, 0); err != nil {
+		return err
+	}
+
+	if !job.Options.AppendAttachments || len(email.attachments) == 0 {
+		return ConvertHtml(ctx, renderEmail(message.Header, email), nil, job.Options, job.OutputFilePath())
+	}
+
+	emailJob := job
+	emailJob.ConvertRequestId = job.ConvertRequestId + "_email"
+	defer os.Remove(emailJob.OutputFilePath())
+
+	if err := ConvertHtml(ctx, renderEmail(message.Header, email), nil, job.Options, emailJob.OutputFilePath()); err != nil {
+		return err
+	}
+
+	pdfsToMerge := []string{emailJob.OutputFilePath()}
+	for i, attachment := range email.attachments {
+		attachmentPdfPath, err := convertEmailAttachment(ctx, job, i, attachment)
+		if attachmentPdfPath != "" {
+			defer os.Remove(attachmentPdfPath)
+		}
+		if err != nil {
+			logrus.Warnf("Failed to convert attachment %s of convert request %s, skipping: %v", attachment.fileName, job.ConvertRequestId, err)
+			continue
+		}
+		pdfsToMerge = append(pdfsToMerge, attachmentPdfPath)
+	}
+
+	return MergePdfs(ctx, pdfsToMerge, job.OutputFilePath())
+}
+
+// Goes through the regular engine of the attachment, as if it was uploaded separately
+func convertEmailAttachment(ctx context.Context, job Job, index int, attachment emailAttachment) (string, error) {
+	attachmentJob := Job{
+		ConvertRequestId: fmt.Sprintf("%s_attachment_%d", job.ConvertRequestId, index),
+		FileName:         attachment.fileName,
+		MimeType:         DetectMimeType(attachment.fileName),
+	}
+
+	if err := os.WriteFile(attachmentJob.InputFilePath(), attachment.content, 0o644); err != nil {
+		return "", fmt.Errorf("failed to save attachment: %w", err)
+	}
+	defer os.Remove(attachmentJob.InputFilePath())
+
+	engine, err := SelectEngine(attachmentJob.MimeType)
+	if err != nil {
+		return "", err
+	}
+
+	return attachmentJob.OutputFilePath(), engine.Convert(ctx, attachmentJob)
+}
+
+func (e *parsedEmail) readPart(header textproto.MIMEHeader, body io.Reader, depth int) error {
+	if depth > maxEmailPartDepth {
+		return fmt.Errorf("email is nested too deeply")
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		// RFC 2045 default
+		mediaType, params = "text/plain", map[string]string{"charset": "us-ascii"}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		multipartReader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := multipartReader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read email part: %w", err)
+			}
+
+			if err := e.readPart(part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	content, err := io.ReadAll(decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return fmt.Errorf("failed to decode email part: %w", err)
+	}
+
+	disposition, dispositionParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	fileName := decodeHeader(dispositionParams["filename"])
+	if fileName == "" {
+		fileName = decodeHeader(params["name"])
+	}
+	contentId := strings.Trim(header.Get("Content-Id"), "<>")
+
+	switch {
+	case disposition != "attachment" && mediaType == "text/html" && e.htmlBody == "":
+		e.htmlBody = decodeCharset(content, params["charset"])
+	case disposition != "attachment" && mediaType == "text/plain" && e.textBody == "":
+		e.textBody = decodeCharset(content, params["charset"])
+	case strings.HasPrefix(mediaType, "image/") && contentId != "":
+		e.inlineParts[contentId] = fmt.Sprintf("data:%s;base64,%s", mediaType, base64.StdEncoding.EncodeToString(content))
+	case fileName != "" && isWordDocument(fileName) && len(e.attachments) < maxEmailAttachments:
+		e.attachments = append(e.attachments, emailAttachment{fileName: fileName, content: content})
+	}
+
+	return nil
+}
+
+func isWordDocument(fileName string) bool {
+	mimeType := DetectMimeType(fileName)
+	return mimeType == MimeTypeDoc || mimeType == MimeTypeDocx
+}
+
+func decodeTransferEncoding(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &newlineSkippingReader{reader: body})
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
+
+// Base64 bodies are split into lines, which the standard decoder does not tolerate in streaming mode
+type newlineSkippingReader struct {
+	reader io.Reader
+}
+
+func (r *newlineSkippingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	kept := 0
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' {
+			p[kept] = b
+			kept++
+		}
+	}
+	return kept, err
+}
+
+// Only Latin-1 needs converting besides UTF-8 in practice, other charsets are passed through as is
+func decodeCharset(content []byte, charset string) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "windows-1252":
+		runes := make([]rune, len(content))
+		for i, b := range content {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	default:
+		return string(content)
+	}
+}
+
+func decodeHeader(value string) string {
+	decoded, err := new(mime.WordDecoder).DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+func renderEmail(header mail.Header, email *parsedEmail) []byte {
+	var document bytes.Buffer
+
+	document.WriteString("<!doctype html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<style>\n")
+	document.WriteString("body { font-family: Helvetica, Arial, sans-serif; font-size: 11pt; }\n")
+	document.WriteString(".email-header { border-bottom: 1px solid #ccc; margin-bottom: 16px; padding-bottom: 8px; }\n")
+	document.WriteString(".email-header th { text-align: left; padding-right: 12px; color: #555; vertical-align: top; }\n")
+	document.WriteString(".email-body-text { white-space: pre-wrap; font-family: inherit; }\n")
+	document.WriteString("</style>\n</head>\n<body>\n<table class=\"email-header\">\n")
+
+	for _, name := range []string{"From", "To", "Cc", "Date", "Subject"} {
+		value := decodeHeader(header.Get(name))
+		if name == "Date" {
+			if date, err := header.Date(); err == nil {
+				value = date.Format("Mon, 02 Jan 2006 15:04:05 -0700")
+			}
+		}
+		if value == "" {
+			continue
+		}
+		fmt.Fprintf(&document, "<tr><th>%s</th><td>%s</td></tr>\n", name, html.EscapeString(value))
+	}
+
+	document.WriteString("</table>\n")
+
+	if email.htmlBody != "" {
+		body := email.htmlBody
+		for contentId, dataUri := range email.inlineParts {
+			body = strings.ReplaceAll(body, "cid:"+contentId, dataUri)
+		}
+		document.WriteString(body)
+	} else {
+		fmt.Fprintf(&document, "<pre class=\"email-body-text\">%s</pre>", html.EscapeString(email.textBody))
+	}
+
+	document.WriteString("\n</body>\n</html>\n")
+
+	return document.Bytes()
+}
@@ -0,0 +1,121 @@
+package converters
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/sirupsen/logrus"
+)
+
+// A failure classified with an error code. The sentinels below match any error of their code with errors.Is,
+// e.g. errors.Is(err, ErrEncryptedInput).
+type ConversionError struct {
+	Code models.ConvertRequestErrorCode
+	Err  error
+}
+
+var (
+	ErrCorruptInput      = &ConversionError{Code: models.ConvertRequestErrorCodeCorruptInput}
+	ErrEncryptedInput    = &ConversionError{Code: models.ConvertRequestErrorCodeEncryptedInput}
+	ErrUnsupportedFormat = &ConversionError{Code: models.ConvertRequestErrorCodeUnsupportedFormat}
+	ErrEngineUnavailable = &ConversionError{Code: models.ConvertRequestErrorCodeEngineUnavailable}
+	ErrTimeout           = &ConversionError{Code: models.ConvertRequestErrorCodeTimeout}
+	ErrOutputInvalid     = &ConversionError{Code: models.ConvertRequestErrorCodeOutputInvalid}
+	ErrInternal          = &ConversionError{Code: models.ConvertRequestErrorCodeInternal}
+)
+
+var errorCodes = []models.ConvertRequestErrorCode{
+	models.ConvertRequestErrorCodeCorruptInput,
+	models.ConvertRequestErrorCodeEncryptedInput,
+	models.ConvertRequestErrorCodeUnsupportedFormat,
+	models.ConvertRequestErrorCodeEngineUnavailable,
+	models.ConvertRequestErrorCodeTimeout,
+	models.ConvertRequestErrorCodeOutputInvalid,
+	models.ConvertRequestErrorCodeInternal,
+}
+
+func NewConversionError(code models.ConvertRequestErrorCode, err error) error {
+	return &ConversionError{Code: code, Err: err}
+}
+
+func (e *ConversionError) Error() string {
+	if e.Err == nil {
+		return string(e.Code)
+	}
+	return e.Err.Error()
+}
+
+func (e *ConversionError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ConversionError) Is(target error) bool {
+	targetError, ok := target.(*ConversionError)
+	return ok && targetError.Err == nil && targetError.Code == e.Code
+}
+
+// Errors that are not classified explicitly are internal, except for timeouts
+func ErrorCodeOf(err error) models.ConvertRequestErrorCode {
+	var conversionError *ConversionError
+	if errors.As(err, &conversionError) {
+		return conversionError.Code
+	}
+
+	var netError net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netError) && netError.Timeout()) {
+		return models.ConvertRequestErrorCodeTimeout
+	}
+
+	return models.ConvertRequestErrorCodeInternal
+}
+
+// Only errors of CONVERT_RETRYABLE_ERROR_CODES are worth retrying, e.g. a password-protected file fails
+// the same way every time
+func IsRetryable(err error) bool {
+	return slices.Contains(config.Config.ConvertRetryableErrorCodes, string(ErrorCodeOf(err)))
+}
+
+func validateRetryableErrorCodes() {
+	for _, errorCode := range config.Config.ConvertRetryableErrorCodes {
+		if !slices.Contains(errorCodes, models.ConvertRequestErrorCode(errorCode)) {
+			logrus.Panicf("Unknown error code %s in CONVERT_RETRYABLE_ERROR_CODES", errorCode)
+		}
+	}
+}
+
+// Conversion services can't be reached, e.g. connection refused or a DNS failure
+func classifyRequestError(err error) error {
+	if ErrorCodeOf(err) == models.ConvertRequestErrorCodeTimeout {
+		return NewConversionError(models.ConvertRequestErrorCodeTimeout, err)
+	}
+	if errors.Is(err, context.Canceled) {
+		return NewConversionError(models.ConvertRequestErrorCodeInternal, err)
+	}
+	return NewConversionError(models.ConvertRequestErrorCodeEngineUnavailable, err)
+}
+
+// Gotenberg responds with 400 when LibreOffice or Chromium can't handle the document, and with 503 on its own timeouts
+func classifyResponseError(statusCode int, body string, err error) error {
+	lowerBody := strings.ToLower(body)
+
+	code := models.ConvertRequestErrorCodeInternal
+	switch {
+	case strings.Contains(lowerBody, "password") || strings.Contains(lowerBody, "encrypted"):
+		code = models.ConvertRequestErrorCodeEncryptedInput
+	case statusCode == 408 || statusCode == 504:
+		code = models.ConvertRequestErrorCodeTimeout
+	case statusCode == 429 || statusCode == 502 || statusCode == 503:
+		code = models.ConvertRequestErrorCodeEngineUnavailable
+	case strings.Contains(lowerBody, "extension") || strings.Contains(lowerBody, "not supported"):
+		code = models.ConvertRequestErrorCodeUnsupportedFormat
+	case statusCode == 400 || statusCode == 422:
+		code = models.ConvertRequestErrorCodeCorruptInput
+	}
+
+	return NewConversionError(code, err)
+}
@@ -0,0 +1,211 @@
+package converters
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"html"
+	"io"
+	"mime/multipart"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/sirupsen/logrus"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	goldmarkHtml "github.com/yuin/goldmark/renderer/html"
+)
+
+const (
+	maxAssetCount            = 500
+	maxAssetsUncompressedSum = 200 * 1024 * 1024
+)
+
+//go:embed assets/markdown.css
+var defaultMarkdownStylesheet []byte
+
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	// HTML uploads are trusted to the same extent, so there is no point in stripping raw HTML from Markdown
+	goldmark.WithRendererOptions(goldmarkHtml.WithUnsafe()),
+)
+
+type GotenbergChromiumEngine struct{}
+
+func (e *GotenbergChromiumEngine) Name() string {
+	return "gotenberg-chromium"
+}
+
+func (e *GotenbergChromiumEngine) Service() *Service {
+	return gotenberg
+}
+
+func (e *GotenbergChromiumEngine) Convert(ctx context.Context, job Job) error {
+	indexHtml, err := e.readIndexHtml(job)
+	if err != nil {
+		return err
+	}
+
+	var assets *zip.Reader
+	if job.Options.HasAssets {
+		assetsArchive, err := zip.OpenReader(job.AssetsFilePath())
+		if err != nil {
+			return NewConversionError(models.ConvertRequestErrorCodeCorruptInput, fmt.Errorf("failed to open assets archive: %w", err))
+		}
+		defer assetsArchive.Close()
+		assets = &assetsArchive.Reader
+	}
+
+	return ConvertHtml(ctx, indexHtml, assets, job.Options, job.OutputFilePath())
+}
+
+func (e *GotenbergChromiumEngine) readIndexHtml(job Job) ([]byte, error) {
+	content, err := os.ReadFile(job.InputFilePath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	if job.MimeType != MimeTypeMarkdown {
+		return content, nil
+	}
+
+	return renderMarkdown(content, job.FileName)
+}
+
+// Sends the HTML to the Chromium route of Gotenberg. Gotenberg stores all files in a flat directory,
+// so assets must be referenced by their base names (e.g. `<img src="logo.png">`).
+func ConvertHtml(ctx context.Context, indexHtml []byte, assets *zip.Reader, options models.ConversionOptions, outputFilePath string) error {
+	return postMultipartForm(
+		ctx,
+		gotenberg,
+		"/forms/chromium/convert/html",
+		outputFilePath,
+		func(multipartWriter *multipart.Writer) error {
+			if err := writeChromiumFields(multipartWriter, options); err != nil {
+				return err
+			}
+
+			if err := writeFormFile(multipartWriter, "files", "index.html", bytes.NewReader(indexHtml)); err != nil {
+				return err
+			}
+
+			if options.HeaderHtml != "" {
+				if err := writeFormFile(multipartWriter, "files", "header.html", strings.NewReader(options.HeaderHtml)); err != nil {
+					return err
+				}
+			}
+
+			if options.FooterHtml != "" {
+				if err := writeFormFile(multipartWriter, "files", "footer.html", strings.NewReader(options.FooterHtml)); err != nil {
+					return err
+				}
+			}
+
+			if assets != nil {
+				return writeAssets(multipartWriter, assets)
+			}
+
+			return nil
+		},
+	)
+}
+
+func writeChromiumFields(multipartWriter *multipart.Writer, options models.ConversionOptions) error {
+	fields := map[string]string{
+		"paperWidth":      options.PaperWidth,
+		"paperHeight":     options.PaperHeight,
+		"marginTop":       options.MarginTop,
+		"marginBottom":    options.MarginBottom,
+		"marginLeft":      options.MarginLeft,
+		"marginRight":     options.MarginRight,
+		"landscape":       strconv.FormatBool(options.Landscape),
+		"printBackground": "true",
+	}
+
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+
+		if err := multipartWriter.WriteField(name, value); err != nil {
+			return fmt.Errorf("failed to write form field %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func writeAssets(multipartWriter *multipart.Writer, assets *zip.Reader) error {
+	if len(assets.File) > maxAssetCount {
+		return fmt.Errorf("too many assets: %d, max %d", len(assets.File), maxAssetCount)
+	}
+
+	reservedNames := map[string]bool{"index.html": true, "header.html": true, "footer.html": true}
+	var uncompressedSum int64
+
+	for _, asset := range assets.File {
+		if asset.FileInfo().IsDir() {
+			continue
+		}
+
+		assetName := path.Base(asset.Name)
+		if reservedNames[assetName] {
+			logrus.Warnf("Skipping asset %s, the name is already taken", asset.Name)
+			continue
+		}
+		reservedNames[assetName] = true
+
+		assetReader, err := asset.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open asset %s: %w", asset.Name, err)
+		}
+
+		// The declared size can't be trusted, so the actual amount of read bytes is limited
+		limitedAssetReader := &io.LimitedReader{R: assetReader, N: maxAssetsUncompressedSum - uncompressedSum + 1}
+		err = writeFormFile(multipartWriter, "files", assetName, limitedAssetReader)
+		assetReader.Close()
+		if err != nil {
+			return err
+		}
+
+		uncompressedSum = maxAssetsUncompressedSum + 1 - limitedAssetReader.N
+		if uncompressedSum > maxAssetsUncompressedSum {
+			return fmt.Errorf("assets are too large, max %d bytes", maxAssetsUncompressedSum)
+		}
+	}
+
+	return nil
+}
+
+func renderMarkdown(content []byte, title string) ([]byte, error) {
+	stylesheet := defaultMarkdownStylesheet
+	if config.Config.MarkdownStylesheetPath != "" {
+		customStylesheet, err := os.ReadFile(config.Config.MarkdownStylesheetPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Markdown stylesheet: %w", err)
+		}
+		stylesheet = customStylesheet
+	}
+
+	var body bytes.Buffer
+	if err := markdown.Convert(content, &body); err != nil {
+		return nil, fmt.Errorf("failed to render Markdown: %w", err)
+	}
+
+	var document bytes.Buffer
+	fmt.Fprintf(
+		&document,
+		"<!doctype html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n%s</body>\n</html>\n",
+		html.EscapeString(title),
+		stylesheet,
+		body.Bytes(),
+	)
+
+	return document.Bytes(), nil
+}
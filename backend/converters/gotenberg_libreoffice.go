@@ -0,0 +1,87 @@
+package converters
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/sirupsen/logrus"
+)
+
+type GotenbergLibreOfficeEngine struct{}
+
+func (e *GotenbergLibreOfficeEngine) Name() string {
+	return "gotenberg-libreoffice"
+}
+
+func (e *GotenbergLibreOfficeEngine) Service() *Service {
+	return gotenberg
+}
+
+func (e *GotenbergLibreOfficeEngine) Convert(ctx context.Context, job Job) error {
+	originalFile, err := os.Open(job.InputFilePath())
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer originalFile.Close()
+
+	if job.MimeType == MimeTypeDocx {
+		if err := checkDocxContainer(originalFile); err != nil {
+			return err
+		}
+	}
+
+	return postMultipartForm(
+		ctx,
+		gotenberg,
+		"/forms/libreoffice/convert",
+		job.OutputFilePath(),
+		func(multipartWriter *multipart.Writer) error {
+			logrus.Infof("Creating form file with name: %s", job.FileName)
+			return writeFormFile(multipartWriter, "files", job.FileName, originalFile)
+		},
+	)
+}
+
+var (
+	zipSignature = []byte("PK\x03\x04")
+	// Compound File Binary, the container of legacy Office files and of encrypted OOXML files
+	compoundFileSignature = []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}
+	// The name of the stream with the encrypted document, in UTF-16LE as stored in the directory
+	encryptedPackageStreamName = []byte("E\x00n\x00c\x00r\x00y\x00p\x00t\x00e\x00d\x00P\x00a\x00c\x00k\x00a\x00g\x00e\x00")
+)
+
+// Password-protected .docx files are not zips, Word wraps them into a compound file with an EncryptedPackage stream.
+// LibreOffice fails on them with a generic error, so they are recognized beforehand.
+func checkDocxContainer(file *os.File) error {
+	header := make([]byte, len(compoundFileSignature))
+	if _, err := io.ReadFull(file, header); err != nil {
+		return NewConversionError(models.ConvertRequestErrorCodeCorruptInput, fmt.Errorf("failed to read file header: %w", err))
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind file: %w", err)
+	}
+
+	if bytes.HasPrefix(header, zipSignature) {
+		return nil
+	}
+
+	if bytes.Equal(header, compoundFileSignature) {
+		content, err := os.ReadFile(file.Name())
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		if bytes.Contains(content, encryptedPackageStreamName) {
+			return NewConversionError(models.ConvertRequestErrorCodeEncryptedInput, errors.New("the document is password-protected"))
+		}
+		// Probably a .doc with the wrong extension, LibreOffice detects the format by the content
+		return nil
+	}
+
+	return NewConversionError(models.ConvertRequestErrorCodeCorruptInput, errors.New("the document is not a valid .docx file"))
+}
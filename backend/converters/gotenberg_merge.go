@@ -0,0 +1,35 @@
+package converters
+
+import (
+	"context"
+	"fmt"
+	"mime/multipart"
+	"os"
+)
+
+// Merges the PDFs in the given order. Gotenberg merges files in the alphanumeric order of their names,
+// so the files are renamed to keep the order.
+func MergePdfs(ctx context.Context, inputFilePaths []string, outputFilePath string) error {
+	return postMultipartForm(
+		ctx,
+		gotenberg,
+		"/forms/pdfengines/merge",
+		outputFilePath,
+		func(multipartWriter *multipart.Writer) error {
+			for i, inputFilePath := range inputFilePaths {
+				inputFile, err := os.Open(inputFilePath)
+				if err != nil {
+					return fmt.Errorf("failed to open file to merge: %w", err)
+				}
+
+				err = writeFormFile(multipartWriter, "files", fmt.Sprintf("%06d.pdf", i), inputFile)
+				inputFile.Close()
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	)
+}
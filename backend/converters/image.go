@@ -0,0 +1,416 @@
+package converters
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/karpov-kir/word-to-pdf/backend/pdf"
+	"github.com/karpov-kir/word-to-pdf/backend/utils"
+	"golang.org/x/image/tiff"
+)
+
+const (
+	ImageFitFit      = "fit"
+	ImageFitFill     = "fill"
+	ImageFitOriginal = "original"
+
+	// Multi-page TIFFs from scanners can be big, but there should still be a sane limit
+	maxTiffPages = 500
+)
+
+var pointsPerUnit = map[string]float64{
+	"":   72,
+	"in": 72,
+	"pt": 1,
+	"px": 0.75,
+	"pc": 12,
+	"mm": 72 / 25.4,
+	"cm": 72 / 2.54,
+}
+
+// A4 in points
+var defaultPageSize = [2]float64{595.44, 842.4}
+
+// Lays out images into a PDF without any external engine
+type ImageEngine struct{}
+
+func (e *ImageEngine) Name() string {
+	return "native-image"
+}
+
+func (e *ImageEngine) Convert(ctx context.Context, job Job) error {
+	imageFile, err := os.Open(job.InputFilePath())
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer imageFile.Close()
+
+	return utils.WriteFileAtomically(job.OutputFilePath(), func(outputFile io.Writer) error {
+		return ConvertImagesToPdf(ctx, []io.ReadSeeker{imageFile}, job.Options, outputFile)
+	})
+}
+
+// Every image becomes a page (every frame in case of multi-page TIFFs)
+func ConvertImagesToPdf(ctx context.Context, images []io.ReadSeeker, options models.ConversionOptions, output io.Writer) error {
+	layout, err := newImageLayout(options)
+	if err != nil {
+		return err
+	}
+
+	pdfWriter, err := pdf.NewWriter(output)
+	if err != nil {
+		return err
+	}
+
+	catalogId := pdfWriter.ReserveObject()
+	pagesId := pdfWriter.ReserveObject()
+	pageIds := []string{}
+
+	for _, imageReader := range images {
+		pageImages, err := encodeImage(imageReader)
+		if err != nil {
+			return err
+		}
+
+		for _, pageImage := range pageImages {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			pageId, err := writeImagePage(pdfWriter, pagesId, pageImage, layout)
+			if err != nil {
+				return err
+			}
+			pageIds = append(pageIds, fmt.Sprintf("%d 0 R", pageId))
+		}
+	}
+
+	if len(pageIds) == 0 {
+		return fmt.Errorf("no images to convert")
+	}
+
+	if err := pdfWriter.WriteObject(pagesId, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(pageIds, " "), len(pageIds))); err != nil {
+		return err
+	}
+
+	if err := pdfWriter.WriteObject(catalogId, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesId)); err != nil {
+		return err
+	}
+
+	return pdfWriter.Close(catalogId)
+}
+
+type imageLayout struct {
+	pageWidth, pageHeight                            float64
+	marginTop, marginBottom, marginLeft, marginRight float64
+	fit                                              string
+}
+
+func newImageLayout(options models.ConversionOptions) (imageLayout, error) {
+	layout := imageLayout{
+		pageWidth:  defaultPageSize[0],
+		pageHeight: defaultPageSize[1],
+		fit:        options.ImageFit,
+	}
+
+	if layout.fit == "" {
+		layout.fit = ImageFitFit
+	}
+	if layout.fit != ImageFitFit && layout.fit != ImageFitFill && layout.fit != ImageFitOriginal {
+		return layout, fmt.Errorf("unsupported image fit: %s", layout.fit)
+	}
+
+	sizes := []struct {
+		value  string
+		target *float64
+	}{
+		{options.PaperWidth, &layout.pageWidth},
+		{options.PaperHeight, &layout.pageHeight},
+		{options.MarginTop, &layout.marginTop},
+		{options.MarginBottom, &layout.marginBottom},
+		{options.MarginLeft, &layout.marginLeft},
+		{options.MarginRight, &layout.marginRight},
+	}
+	for _, size := range sizes {
+		if size.value == "" {
+			continue
+		}
+
+		points, err := parseSizeToPoints(size.value)
+		if err != nil {
+			return layout, err
+		}
+		*size.target = points
+	}
+
+	if options.Landscape && layout.pageWidth < layout.pageHeight {
+		layout.pageWidth, layout.pageHeight = layout.pageHeight, layout.pageWidth
+	}
+
+	if layout.pageWidth-layout.marginLeft-layout.marginRight <= 0 || layout.pageHeight-layout.marginTop-layout.marginBottom <= 0 {
+		return layout, fmt.Errorf("margins do not leave any space for the image")
+	}
+
+	return layout, nil
+}
+
+func parseSizeToPoints(size string) (float64, error) {
+	numberPart := strings.TrimRight(size, "abcdefghijklmnopqrstuvwxyz")
+	factor, ok := pointsPerUnit[size[len(numberPart):]]
+	if !ok {
+		return 0, fmt.Errorf("unsupported size unit: %s", size)
+	}
+
+	number, err := strconv.ParseFloat(numberPart, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: %s", size)
+	}
+
+	return number * factor, nil
+}
+
+type encodedImage struct {
+	width, height int
+	dictionary    string
+	data          []byte
+}
+
+func encodeImage(imageReader io.ReadSeeker) ([]encodedImage, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(imageReader, header); err != nil {
+		return nil, NewConversionError(models.ConvertRequestErrorCodeCorruptInput, fmt.Errorf("failed to read image header: %w", err))
+	}
+	if _, err := imageReader.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind image: %w", err)
+	}
+
+	switch {
+	case bytes.Equal(header[:2], []byte{0xff, 0xd8}):
+		jpegImage, err := encodeJpeg(imageReader)
+		if err != nil {
+			return nil, err
+		}
+		return []encodedImage{jpegImage}, nil
+	case bytes.Equal(header, []byte("II*\x00")) || bytes.Equal(header, []byte("MM\x00*")):
+		return encodeTiff(imageReader)
+	default:
+		decodedImage, _, err := image.Decode(imageReader)
+		if errors.Is(err, image.ErrFormat) {
+			return nil, NewConversionError(models.ConvertRequestErrorCodeUnsupportedFormat, fmt.Errorf("failed to decode image: %w", err))
+		}
+		if err != nil {
+			return nil, NewConversionError(models.ConvertRequestErrorCodeCorruptInput, fmt.Errorf("failed to decode image: %w", err))
+		}
+
+		flateImage, err := encodeFlate(decodedImage)
+		if err != nil {
+			return nil, err
+		}
+		return []encodedImage{flateImage}, nil
+	}
+}
+
+// JPEGs are embedded as is, PDF supports them natively via DCTDecode
+func encodeJpeg(imageReader io.ReadSeeker) (encodedImage, error) {
+	data, err := io.ReadAll(imageReader)
+	if err != nil {
+		return encodedImage{}, fmt.Errorf("failed to read JPEG: %w", err)
+	}
+
+	imageConfig, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return encodedImage{}, NewConversionError(models.ConvertRequestErrorCodeCorruptInput, fmt.Errorf("failed to decode JPEG: %w", err))
+	}
+
+	colorSpace := ""
+	switch imageConfig.ColorModel {
+	case color.GrayModel:
+		colorSpace = "/DeviceGray"
+	case color.YCbCrModel:
+		colorSpace = "/DeviceRGB"
+	default:
+		// CMYK JPEGs are often inverted (Adobe), re-encoding is the safest option
+		decodedImage, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return encodedImage{}, NewConversionError(models.ConvertRequestErrorCodeCorruptInput, fmt.Errorf("failed to decode JPEG: %w", err))
+		}
+		return encodeFlate(decodedImage)
+	}
+
+	return encodedImage{
+		width:      imageConfig.Width,
+		height:     imageConfig.Height,
+		dictionary: fmt.Sprintf("/ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode", colorSpace),
+		data:       data,
+	}, nil
+}
+
+// Transparent pixels are composed over white, PDF pages are white as well
+func encodeFlate(decodedImage image.Image) (encodedImage, error) {
+	bounds := decodedImage.Bounds()
+	_, isGray := decodedImage.(*image.Gray)
+
+	var compressed bytes.Buffer
+	zlibWriter := zlib.NewWriter(&compressed)
+	row := make([]byte, 0, bounds.Dx()*3)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row = row[:0]
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := decodedImage.At(x, y).RGBA()
+			r, g, b = r+0xffff-a, g+0xffff-a, b+0xffff-a
+
+			if isGray {
+				row = append(row, byte(r>>8))
+			} else {
+				row = append(row, byte(r>>8), byte(g>>8), byte(b>>8))
+			}
+		}
+
+		if _, err := zlibWriter.Write(row); err != nil {
+			return encodedImage{}, fmt.Errorf("failed to compress image: %w", err)
+		}
+	}
+
+	if err := zlibWriter.Close(); err != nil {
+		return encodedImage{}, fmt.Errorf("failed to compress image: %w", err)
+	}
+
+	colorSpace := "/DeviceRGB"
+	if isGray {
+		colorSpace = "/DeviceGray"
+	}
+
+	return encodedImage{
+		width:      bounds.Dx(),
+		height:     bounds.Dy(),
+		dictionary: fmt.Sprintf("/ColorSpace %s /BitsPerComponent 8 /Filter /FlateDecode", colorSpace),
+		data:       compressed.Bytes(),
+	}, nil
+}
+
+// The TIFF decoder reads only the first directory (page), so every page is decoded
+// separately by pointing the header to the directory of the page
+func encodeTiff(imageReader io.ReadSeeker) ([]encodedImage, error) {
+	data, err := io.ReadAll(imageReader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TIFF: %w", err)
+	}
+
+	if len(data) < 8 {
+		return nil, NewConversionError(models.ConvertRequestErrorCodeCorruptInput, fmt.Errorf("TIFF is too short"))
+	}
+
+	var byteOrder binary.ByteOrder = binary.LittleEndian
+	if data[0] == 'M' {
+		byteOrder = binary.BigEndian
+	}
+
+	pages := []encodedImage{}
+	directoryOffset := byteOrder.Uint32(data[4:8])
+	visitedOffsets := map[uint32]bool{}
+
+	for directoryOffset != 0 {
+		if visitedOffsets[directoryOffset] || len(pages) >= maxTiffPages {
+			break
+		}
+		visitedOffsets[directoryOffset] = true
+
+		if int(directoryOffset)+2 > len(data) {
+			return nil, NewConversionError(models.ConvertRequestErrorCodeCorruptInput, fmt.Errorf("invalid TIFF directory offset: %d", directoryOffset))
+		}
+
+		pageData := make([]byte, len(data))
+		copy(pageData, data)
+		byteOrder.PutUint32(pageData[4:8], directoryOffset)
+
+		decodedPage, err := tiff.Decode(bytes.NewReader(pageData))
+		if err != nil {
+			return nil, NewConversionError(models.ConvertRequestErrorCodeCorruptInput, fmt.Errorf("failed to decode TIFF page %d: %w", len(pages)+1, err))
+		}
+
+		encodedPage, err := encodeFlate(decodedPage)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, encodedPage)
+
+		entryCount := int(byteOrder.Uint16(data[directoryOffset:]))
+		nextOffsetPosition := int(directoryOffset) + 2 + entryCount*12
+		if nextOffsetPosition+4 > len(data) {
+			break
+		}
+		directoryOffset = byteOrder.Uint32(data[nextOffsetPosition:])
+	}
+
+	return pages, nil
+}
+
+func writeImagePage(pdfWriter *pdf.Writer, pagesId int, pageImage encodedImage, layout imageLayout) (int, error) {
+	pageWidth, pageHeight := layout.pageWidth, layout.pageHeight
+	boxX, boxY := layout.marginLeft, layout.marginBottom
+	boxWidth := pageWidth - layout.marginLeft - layout.marginRight
+	boxHeight := pageHeight - layout.marginTop - layout.marginBottom
+
+	if layout.fit == ImageFitOriginal {
+		pageWidth, pageHeight = float64(pageImage.width), float64(pageImage.height)
+		boxX, boxY, boxWidth, boxHeight = 0, 0, pageWidth, pageHeight
+	}
+
+	scaleX := boxWidth / float64(pageImage.width)
+	scaleY := boxHeight / float64(pageImage.height)
+	scale := min(scaleX, scaleY)
+	if layout.fit == ImageFitFill {
+		scale = max(scaleX, scaleY)
+	}
+
+	imageWidth := float64(pageImage.width) * scale
+	imageHeight := float64(pageImage.height) * scale
+	imageX := boxX + (boxWidth-imageWidth)/2
+	imageY := boxY + (boxHeight-imageHeight)/2
+
+	// Clipping to the box cuts off the overflow in the fill mode
+	content := fmt.Sprintf(
+		"q %.2f %.2f %.2f %.2f re W n %.4f 0 0 %.4f %.4f %.4f cm /Im0 Do Q",
+		boxX, boxY, boxWidth, boxHeight,
+		imageWidth, imageHeight, imageX, imageY,
+	)
+
+	imageId := pdfWriter.ReserveObject()
+	contentId := pdfWriter.ReserveObject()
+	pageId := pdfWriter.ReserveObject()
+
+	if err := pdfWriter.WriteStream(
+		imageId,
+		fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d %s", pageImage.width, pageImage.height, pageImage.dictionary),
+		pageImage.data,
+	); err != nil {
+		return 0, err
+	}
+
+	if err := pdfWriter.WriteStream(contentId, "", []byte(content)); err != nil {
+		return 0, err
+	}
+
+	if err := pdfWriter.WriteObject(pageId, fmt.Sprintf(
+		"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>",
+		pagesId, pageWidth, pageHeight, imageId, contentId,
+	)); err != nil {
+		return 0, err
+	}
+
+	return pageId, nil
+}
@@ -0,0 +1,347 @@
+package converters
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/karpov-kir/word-to-pdf/backend/pdf"
+)
+
+var (
+	mediaBoxRegexp = regexp.MustCompile(`/MediaBox \[0 0 ([\d.]+) ([\d.]+)\]`)
+	// The placement of the image: width, height, x and y
+	imageMatrixRegexp = regexp.MustCompile(`([\d.]+) 0 0 ([\d.]+) (-?[\d.]+) (-?[\d.]+) cm /Im0 Do`)
+)
+
+func testImage(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 7), G: uint8(y * 13), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func encodeTestJpeg(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, testImage(width, height), nil); err != nil {
+		t.Fatalf("failed to encode JPEG: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func encodeTestPng(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, testImage(width, height)); err != nil {
+		t.Fatalf("failed to encode PNG: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+// Uncompressed grayscale little-endian TIFF with a page per size, the pixels of a page are followed by its directory
+func encodeTestTiff(sizes [][2]int) []byte {
+	const entryCount = 8
+
+	data := []byte("II*\x00\x00\x00\x00\x00")
+	previousNextOffsetPosition := 4
+
+	for _, size := range sizes {
+		width, height := size[0], size[1]
+		pixelsOffset := len(data)
+		for i := 0; i < width*height; i++ {
+			data = append(data, byte(i*31))
+		}
+
+		directoryOffset := len(data)
+		binary.LittleEndian.PutUint32(data[previousNextOffsetPosition:], uint32(directoryOffset))
+
+		directory := binary.LittleEndian.AppendUint16(nil, entryCount)
+		entries := [][3]uint32{
+			// Tag, type (3 short, 4 long), value
+			{256, 4, uint32(width)},
+			{257, 4, uint32(height)},
+			{258, 3, 8},
+			{259, 3, 1},
+			{262, 3, 1},
+			{273, 4, uint32(pixelsOffset)},
+			{278, 4, uint32(height)},
+			{279, 4, uint32(width * height)},
+		}
+		for _, entry := range entries {
+			directory = binary.LittleEndian.AppendUint16(directory, uint16(entry[0]))
+			directory = binary.LittleEndian.AppendUint16(directory, uint16(entry[1]))
+			directory = binary.LittleEndian.AppendUint32(directory, 1)
+			directory = binary.LittleEndian.AppendUint32(directory, entry[2])
+		}
+		data = append(data, directory...)
+
+		previousNextOffsetPosition = len(data)
+		data = binary.LittleEndian.AppendUint32(data, 0)
+	}
+
+	return data
+}
+
+type imagePage struct {
+	pageWidth, pageHeight                   float64
+	imageWidth, imageHeight, imageX, imageY float64
+}
+
+func convertTestImages(t *testing.T, options models.ConversionOptions, images ...[]byte) []imagePage {
+	t.Helper()
+
+	readers := make([]io.ReadSeeker, 0, len(images))
+	for _, imageData := range images {
+		readers = append(readers, bytes.NewReader(imageData))
+	}
+
+	var output bytes.Buffer
+	if err := ConvertImagesToPdf(context.Background(), readers, options, &output); err != nil {
+		t.Fatalf("failed to convert images: %v", err)
+	}
+
+	if err := pdf.Validate(bytes.NewReader(output.Bytes()), int64(output.Len())); err != nil {
+		t.Fatalf("invalid PDF: %v", err)
+	}
+
+	pageCount, err := pdf.CountPages(output.Bytes())
+	if err != nil {
+		t.Fatalf("failed to count pages: %v", err)
+	}
+
+	mediaBoxes := mediaBoxRegexp.FindAllStringSubmatch(output.String(), -1)
+	imageMatrices := imageMatrixRegexp.FindAllStringSubmatch(output.String(), -1)
+	if len(mediaBoxes) != pageCount || len(imageMatrices) != pageCount {
+		t.Fatalf("expected %d media boxes and image matrices, got %d and %d", pageCount, len(mediaBoxes), len(imageMatrices))
+	}
+
+	pages := make([]imagePage, 0, pageCount)
+	for i := range pageCount {
+		pages = append(pages, imagePage{
+			pageWidth:   parseTestNumber(t, mediaBoxes[i][1]),
+			pageHeight:  parseTestNumber(t, mediaBoxes[i][2]),
+			imageWidth:  parseTestNumber(t, imageMatrices[i][1]),
+			imageHeight: parseTestNumber(t, imageMatrices[i][2]),
+			imageX:      parseTestNumber(t, imageMatrices[i][3]),
+			imageY:      parseTestNumber(t, imageMatrices[i][4]),
+		})
+	}
+	return pages
+}
+
+func parseTestNumber(t *testing.T, value string) float64 {
+	t.Helper()
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		t.Fatalf("invalid number %q: %v", value, err)
+	}
+	return number
+}
+
+func assertNear(t *testing.T, name string, actual, expected float64) {
+	t.Helper()
+	if actual < expected-0.01 || actual > expected+0.01 {
+		t.Errorf("expected %s %.2f, got %.2f", name, expected, actual)
+	}
+}
+
+func TestConvertImagesToPdfFormats(t *testing.T) {
+	tests := []struct {
+		name      string
+		images    [][]byte
+		pageCount int
+	}{
+		{"JPEG", [][]byte{encodeTestJpeg(t, 40, 20)}, 1},
+		{"PNG", [][]byte{encodeTestPng(t, 40, 20)}, 1},
+		{"multi-page TIFF", [][]byte{encodeTestTiff([][2]int{{4, 2}, {3, 3}, {2, 5}})}, 3},
+		{"mixed images", [][]byte{encodeTestJpeg(t, 10, 10), encodeTestPng(t, 10, 10), encodeTestTiff([][2]int{{2, 2}, {2, 2}})}, 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pages := convertTestImages(t, models.ConversionOptions{}, test.images...)
+			if len(pages) != test.pageCount {
+				t.Fatalf("expected %d pages, got %d", test.pageCount, len(pages))
+			}
+		})
+	}
+}
+
+func TestConvertImagesToPdfEmbedsJpegAsIs(t *testing.T) {
+	jpegData := encodeTestJpeg(t, 16, 16)
+
+	var output bytes.Buffer
+	if err := ConvertImagesToPdf(context.Background(), []io.ReadSeeker{bytes.NewReader(jpegData)}, models.ConversionOptions{}, &output); err != nil {
+		t.Fatalf("failed to convert JPEG: %v", err)
+	}
+
+	if !bytes.Contains(output.Bytes(), []byte("/DCTDecode")) || !bytes.Contains(output.Bytes(), jpegData) {
+		t.Error("expected the JPEG to be embedded as is with DCTDecode")
+	}
+}
+
+func TestConvertImagesToPdfTiffPageSizes(t *testing.T) {
+	pages := convertTestImages(
+		t,
+		models.ConversionOptions{ImageFit: ImageFitOriginal},
+		encodeTestTiff([][2]int{{4, 2}, {3, 3}, {2, 5}}),
+	)
+
+	expectedSizes := [][2]float64{{4, 2}, {3, 3}, {2, 5}}
+	for i, page := range pages {
+		assertNear(t, "page width", page.pageWidth, expectedSizes[i][0])
+		assertNear(t, "page height", page.pageHeight, expectedSizes[i][1])
+	}
+}
+
+func TestConvertImagesToPdfLayout(t *testing.T) {
+	// 200x100 pixels
+	pngData := encodeTestPng(t, 200, 100)
+
+	tests := []struct {
+		name     string
+		options  models.ConversionOptions
+		expected imagePage
+	}{
+		{
+			name:    "fit on A4 by default",
+			options: models.ConversionOptions{},
+			// Limited by the width, centered vertically
+			expected: imagePage{595.44, 842.4, 595.44, 297.72, 0, 272.34},
+		},
+		{
+			name:    "fill on A4",
+			options: models.ConversionOptions{ImageFit: ImageFitFill},
+			// Limited by the height, the overflow is clipped
+			expected: imagePage{595.44, 842.4, 1684.8, 842.4, -544.68, 0},
+		},
+		{
+			name:     "original size",
+			options:  models.ConversionOptions{ImageFit: ImageFitOriginal},
+			expected: imagePage{200, 100, 200, 100, 0, 0},
+		},
+		{
+			name: "paper size and margins",
+			options: models.ConversionOptions{
+				PaperWidth:   "6in",
+				PaperHeight:  "4in",
+				MarginTop:    "1in",
+				MarginBottom: "1in",
+				MarginLeft:   "72pt",
+				MarginRight:  "25.4mm",
+			},
+			// The box is 288x144 at 72x72
+			expected: imagePage{432, 288, 288, 144, 72, 72},
+		},
+		{
+			name:     "landscape",
+			options:  models.ConversionOptions{Landscape: true},
+			expected: imagePage{842.4, 595.44, 842.4, 421.2, 0, 87.12},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pages := convertTestImages(t, test.options, pngData)
+			if len(pages) != 1 {
+				t.Fatalf("expected 1 page, got %d", len(pages))
+			}
+
+			page := pages[0]
+			assertNear(t, "page width", page.pageWidth, test.expected.pageWidth)
+			assertNear(t, "page height", page.pageHeight, test.expected.pageHeight)
+			assertNear(t, "image width", page.imageWidth, test.expected.imageWidth)
+			assertNear(t, "image height", page.imageHeight, test.expected.imageHeight)
+			assertNear(t, "image x", page.imageX, test.expected.imageX)
+			assertNear(t, "image y", page.imageY, test.expected.imageY)
+		})
+	}
+}
+
+func TestConvertImagesToPdfInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options models.ConversionOptions
+	}{
+		{"unsupported fit", models.ConversionOptions{ImageFit: "stretch"}},
+		{"unsupported unit", models.ConversionOptions{PaperWidth: "10ft"}},
+		{"invalid size", models.ConversionOptions{PaperWidth: "wide"}},
+		{"margins without space", models.ConversionOptions{MarginLeft: "5in", MarginRight: "5in"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ConvertImagesToPdf(context.Background(), []io.ReadSeeker{bytes.NewReader(encodeTestPng(t, 2, 2))}, test.options, io.Discard)
+			if err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestConvertImagesToPdfInvalidImages(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{"empty", []byte{}, ErrCorruptInput},
+		{"unsupported format", []byte("GIF89a not really"), ErrUnsupportedFormat},
+		{"truncated JPEG", encodeTestJpeg(t, 10, 10)[:20], ErrCorruptInput},
+		{"truncated TIFF", []byte("II*\x00"), ErrCorruptInput},
+		{"TIFF with a directory out of bounds", []byte("II*\x00\xff\xff\x00\x00"), ErrCorruptInput},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ConvertImagesToPdf(context.Background(), []io.ReadSeeker{bytes.NewReader(test.data)}, models.ConversionOptions{}, io.Discard)
+			if !errors.Is(err, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestImageEngineConvert(t *testing.T) {
+	config.Config.UploadsFolderAbsolutePath = t.TempDir()
+	job := Job{ConvertRequestId: "image-engine-test", FileName: "scan.tiff", MimeType: "image/tiff"}
+
+	if err := os.WriteFile(job.InputFilePath(), encodeTestTiff([][2]int{{4, 4}, {4, 4}}), 0644); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+
+	if err := (&ImageEngine{}).Convert(context.Background(), job); err != nil {
+		t.Fatalf("failed to convert: %v", err)
+	}
+
+	if err := pdf.ValidateFile(job.OutputFilePath()); err != nil {
+		t.Fatalf("invalid PDF: %v", err)
+	}
+
+	output, err := VerifyOutput(job)
+	if err != nil {
+		t.Fatalf("failed to verify output: %v", err)
+	}
+	if output.PageCount != 2 {
+		t.Errorf("expected 2 pages, got %d", output.PageCount)
+	}
+	if output.Size == 0 {
+		t.Error("expected a non-empty output")
+	}
+}
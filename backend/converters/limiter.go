@@ -0,0 +1,119 @@
+package converters
+
+import (
+	"sync"
+	"time"
+
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// The limit is multiplied by this on overload
+	limitDecreaseFactor = 0.7
+	// Requests sent before a decrease fail together, one decrease is enough for them
+	limitDecreaseCooldown = 5 * time.Second
+)
+
+// AIMD (additive increase, multiplicative decrease) limit of conversions running at the same time. Every request
+// to a conversion service that finishes within the latency threshold raises the limit by 1/limit (about 1 per
+// "limit" requests), overload (429, 503 and timeouts) cuts it.
+type ConcurrencyLimiter struct {
+	minLimit         int
+	maxLimit         int
+	latencyThreshold time.Duration
+
+	mu             sync.Mutex
+	limit          float64
+	decreases      int64
+	lastDecreaseAt time.Time
+	listeners      []func(limit int)
+}
+
+type ConcurrencyLimiterStatus struct {
+	Limit              int        `json:"limit"`
+	MinLimit           int        `json:"minLimit"`
+	MaxLimit           int        `json:"maxLimit"`
+	LatencyThresholdMs int64      `json:"latencyThresholdMs"`
+	Decreases          int64      `json:"decreases"`
+	LastDecreaseAt     *time.Time `json:"lastDecreaseAt,omitempty"`
+}
+
+func NewConcurrencyLimiter(initialLimit int, minLimit int, maxLimit int, latencyThreshold time.Duration) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		minLimit:         minLimit,
+		maxLimit:         maxLimit,
+		latencyThreshold: latencyThreshold,
+		limit:            float64(max(minLimit, min(initialLimit, maxLimit))),
+	}
+}
+
+func (l *ConcurrencyLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return int(l.limit)
+}
+
+// The listener is called with the new limit every time its integer part changes
+func (l *ConcurrencyLimiter) OnChange(listener func(limit int)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.listeners = append(l.listeners, listener)
+}
+
+func (l *ConcurrencyLimiter) Status() ConcurrencyLimiterStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	status := ConcurrencyLimiterStatus{
+		Limit:              int(l.limit),
+		MinLimit:           l.minLimit,
+		MaxLimit:           l.maxLimit,
+		LatencyThresholdMs: l.latencyThreshold.Milliseconds(),
+		Decreases:          l.decreases,
+	}
+	if !l.lastDecreaseAt.IsZero() {
+		lastDecreaseAt := l.lastDecreaseAt
+		status.LastDecreaseAt = &lastDecreaseAt
+	}
+
+	return status
+}
+
+// Errors that are not about the load (e.g. corrupt documents) and slow successes keep the limit as it is
+func (l *ConcurrencyLimiter) observe(latency time.Duration, err error) {
+	code := ErrorCodeOf(err)
+	overloaded := err != nil && (code == models.ConvertRequestErrorCodeEngineUnavailable || code == models.ConvertRequestErrorCodeTimeout)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	previousLimit := int(l.limit)
+
+	switch {
+	case overloaded:
+		if time.Since(l.lastDecreaseAt) < limitDecreaseCooldown {
+			return
+		}
+		l.limit = max(float64(l.minLimit), l.limit*limitDecreaseFactor)
+		l.decreases++
+		l.lastDecreaseAt = time.Now()
+	case err == nil && latency <= l.latencyThreshold:
+		l.limit = min(float64(l.maxLimit), l.limit+1/l.limit)
+	default:
+		return
+	}
+
+	if limit := int(l.limit); limit != previousLimit {
+		if limit < previousLimit {
+			logrus.Warnf("Conversion service is overloaded (%s), decreasing the concurrency limit to %d", code, limit)
+		} else {
+			logrus.Infof("Increasing the concurrency limit of conversions to %d", limit)
+		}
+		for _, listener := range l.listeners {
+			listener(limit)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package converters
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/karpov-kir/word-to-pdf/backend/utils"
+)
+
+const maxErrorBodySize = 512
+
+// Streams the multipart form produced by writeForm to a path of a conversion service and saves the resulting PDF
+// to outputFilePath. The endpoint is picked by the service, nothing is sent while all its endpoints are ejected.
+func postMultipartForm(ctx context.Context, service *Service, path string, outputFilePath string, writeForm func(*multipart.Writer) error) error {
+	return service.run(ctx, func(endpointUrl string) error {
+		return doPostMultipartForm(ctx, endpointUrl+path, outputFilePath, writeForm)
+	})
+}
+
+func doPostMultipartForm(ctx context.Context, url string, outputFilePath string, writeForm func(*multipart.Writer) error) error {
+	pipeRead, pipeWrite := io.Pipe()
+	multipartWriter := multipart.NewWriter(pipeWrite)
+
+	go func() {
+		defer pipeWrite.Close()
+		defer multipartWriter.Close()
+
+		if err := writeForm(multipartWriter); err != nil {
+			pipeWrite.CloseWithError(err)
+			return
+		}
+	}()
+
+	convertRequest, err := http.NewRequestWithContext(ctx, "POST", url, pipeRead)
+	if err != nil {
+		return fmt.Errorf("failed to create convert request: %w", err)
+	}
+	convertRequest.Header.Set("Content-Type", multipartWriter.FormDataContentType())
+
+	httpClient := &http.Client{}
+	resp, err := httpClient.Do(convertRequest)
+	if err != nil {
+		return classifyRequestError(fmt.Errorf("failed to send convert request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// The beginning of the body is enough to tell what went wrong
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		return classifyResponseError(
+			resp.StatusCode,
+			string(body),
+			fmt.Errorf("failed to convert file, status code: %d: %s", resp.StatusCode, strings.TrimSpace(string(body))),
+		)
+	}
+
+	// The output file may be linked to a cache entry, e.g. when a retry runs after a restore
+	return utils.WriteFileAtomically(outputFilePath, func(convertedFile io.Writer) error {
+		if _, err := io.Copy(convertedFile, resp.Body); err != nil {
+			return classifyRequestError(fmt.Errorf("failed to save converted file: %w", err))
+		}
+
+		return nil
+	})
+}
+
+func writeFormFile(multipartWriter *multipart.Writer, fieldName string, fileName string, content io.Reader) error {
+	multipartFileWriter, err := multipartWriter.CreateFormFile(fieldName, fileName)
+	if err != nil {
+		return fmt.Errorf("failed to start transferring data form file: %w", err)
+	}
+
+	if _, err := io.Copy(multipartFileWriter, content); err != nil {
+		return fmt.Errorf("failed to transfer file content: %w", err)
+	}
+
+	return nil
+}
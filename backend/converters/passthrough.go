@@ -0,0 +1,36 @@
+package converters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/karpov-kir/word-to-pdf/backend/pdf"
+	"github.com/karpov-kir/word-to-pdf/backend/utils"
+)
+
+// Uploaded PDFs are not converted, they are only validated and exposed as converted files,
+// so they can be used in batches along with converted documents
+type PassthroughEngine struct{}
+
+func (e *PassthroughEngine) Name() string {
+	return "passthrough"
+}
+
+func (e *PassthroughEngine) Convert(ctx context.Context, job Job) error {
+	if err := pdf.ValidateFile(job.InputFilePath()); err != nil {
+		return NewConversionError(models.ConvertRequestErrorCodeCorruptInput, fmt.Errorf("invalid PDF: %w", err))
+	}
+
+	// Encrypted PDFs can't be verified or merged without decrypting
+	encrypted, err := pdf.IsEncryptedFile(job.InputFilePath())
+	if err != nil {
+		return NewConversionError(models.ConvertRequestErrorCodeCorruptInput, fmt.Errorf("invalid PDF: %w", err))
+	}
+	if encrypted {
+		return NewConversionError(models.ConvertRequestErrorCodeEncryptedInput, errors.New("encrypted PDFs are not supported"))
+	}
+
+	return utils.LinkOrCopyFile(job.InputFilePath(), job.OutputFilePath())
+}
@@ -0,0 +1,214 @@
+package converters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+)
+
+// The weight of the latest request in the recent latency
+const recentLatencyWeight = 0.2
+
+// A conversion service running on one or more endpoints (e.g. several Gotenberg containers). Requests go to
+// the endpoint with the least outstanding requests relative to its weight, endpoints with open breakers are skipped.
+type Service struct {
+	name      string
+	endpoints []*serviceEndpoint
+
+	mu sync.Mutex
+	// Closed and replaced whenever a request finishes, requests waiting for a free endpoint listen to it
+	released chan struct{}
+	// Endpoints with the same load are picked in turns
+	next int
+}
+
+type serviceEndpoint struct {
+	config.ServiceEndpoint
+	breaker *Breaker
+
+	outstanding   int
+	requests      int64
+	failures      int64
+	totalLatency  time.Duration
+	recentLatency time.Duration
+}
+
+type ServiceStatus struct {
+	Name      string           `json:"name"`
+	Available bool             `json:"available"`
+	Endpoints []EndpointStatus `json:"endpoints"`
+}
+
+type EndpointStatus struct {
+	Url            string `json:"url"`
+	Weight         int    `json:"weight"`
+	MaxConcurrency int    `json:"maxConcurrency,omitempty"`
+	Outstanding    int    `json:"outstanding"`
+	Requests       int64  `json:"requests"`
+	Failures       int64  `json:"failures"`
+	// Over all requests and with more weight on the latest ones
+	AverageLatencyMs int64         `json:"averageLatencyMs"`
+	RecentLatencyMs  int64         `json:"recentLatencyMs"`
+	Breaker          BreakerStatus `json:"breaker"`
+}
+
+var services = []*Service{}
+
+func NewService(name string, endpoints []config.ServiceEndpoint, healthPath string) *Service {
+	service := &Service{name: name, released: make(chan struct{})}
+	for _, endpoint := range endpoints {
+		service.endpoints = append(service.endpoints, &serviceEndpoint{
+			ServiceEndpoint: endpoint,
+			breaker:         NewBreaker(endpoint.Url, endpoint.Url+healthPath),
+		})
+	}
+
+	services = append(services, service)
+	return service
+}
+
+func Services() []*Service {
+	return services
+}
+
+func (s *Service) Name() string {
+	return s.name
+}
+
+// At least one endpoint is not ejected
+func (s *Service) IsAvailable() bool {
+	for _, endpoint := range s.endpoints {
+		if endpoint.breaker.IsAvailable() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Service) Status() ServiceStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := ServiceStatus{Name: s.name, Endpoints: []EndpointStatus{}}
+	for _, endpoint := range s.endpoints {
+		endpointStatus := EndpointStatus{
+			Url:             endpoint.Url,
+			Weight:          endpoint.Weight,
+			MaxConcurrency:  endpoint.MaxConcurrency,
+			Outstanding:     endpoint.outstanding,
+			Requests:        endpoint.requests,
+			Failures:        endpoint.failures,
+			RecentLatencyMs: endpoint.recentLatency.Milliseconds(),
+			Breaker:         endpoint.breaker.Status(),
+		}
+		if endpoint.requests > 0 {
+			endpointStatus.AverageLatencyMs = (endpoint.totalLatency / time.Duration(endpoint.requests)).Milliseconds()
+		}
+		if endpointStatus.Breaker.State != BreakerStateOpen {
+			status.Available = true
+		}
+		status.Endpoints = append(status.Endpoints, endpointStatus)
+	}
+
+	return status
+}
+
+// Sends a request to the picked endpoint, waiting while all endpoints are at their concurrency limits
+func (s *Service) run(ctx context.Context, request func(endpointUrl string) error) error {
+	endpoint, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	startedAt := time.Now()
+	err = endpoint.breaker.run(func() error {
+		return request(endpoint.Url)
+	})
+	latency := time.Since(startedAt)
+	s.release(endpoint, latency, err)
+
+	// Ejected right before the request, nothing was sent
+	if !errors.Is(err, ErrBreakerOpen) {
+		Limiter.observe(latency, err)
+	}
+
+	return err
+}
+
+func (s *Service) acquire(ctx context.Context) (*serviceEndpoint, error) {
+	for {
+		s.mu.Lock()
+		endpoint, anyAvailable := s.pickEndpoint()
+		if endpoint != nil {
+			endpoint.outstanding++
+			s.mu.Unlock()
+			return endpoint, nil
+		}
+		released := s.released
+		s.mu.Unlock()
+
+		if !anyAvailable {
+			return nil, NewConversionError(models.ConvertRequestErrorCodeEngineUnavailable, fmt.Errorf("%s: %w", s.name, ErrBreakerOpen))
+		}
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, classifyRequestError(fmt.Errorf("failed to wait for a free %s endpoint: %w", s.name, ctx.Err()))
+		}
+	}
+}
+
+// Must be called with the mutex locked. Returns nil when there is no endpoint with free capacity, and whether
+// there is an endpoint that is not ejected at all.
+func (s *Service) pickEndpoint() (*serviceEndpoint, bool) {
+	var picked *serviceEndpoint
+	anyAvailable := false
+
+	for i := range s.endpoints {
+		endpoint := s.endpoints[(s.next+i)%len(s.endpoints)]
+		if !endpoint.breaker.IsAvailable() {
+			continue
+		}
+		anyAvailable = true
+
+		if endpoint.MaxConcurrency > 0 && endpoint.outstanding >= endpoint.MaxConcurrency {
+			continue
+		}
+
+		// outstanding / weight compared without division
+		if picked == nil || endpoint.outstanding*picked.Weight < picked.outstanding*endpoint.Weight {
+			picked = endpoint
+		}
+	}
+
+	s.next++
+	return picked, anyAvailable
+}
+
+func (s *Service) release(endpoint *serviceEndpoint, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	endpoint.outstanding--
+	endpoint.requests++
+	if err != nil && !errors.Is(err, context.Canceled) {
+		endpoint.failures++
+	}
+
+	endpoint.totalLatency += latency
+	if endpoint.requests == 1 {
+		endpoint.recentLatency = latency
+	} else {
+		endpoint.recentLatency = time.Duration(recentLatencyWeight*float64(latency) + (1-recentLatencyWeight)*float64(endpoint.recentLatency))
+	}
+
+	close(s.released)
+	s.released = make(chan struct{})
+}
@@ -0,0 +1,34 @@
+package converters
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/karpov-kir/word-to-pdf/backend/pdf"
+)
+
+type Output struct {
+	PageCount int
+	Size      int64
+}
+
+// Checks the header and the trailer, then parses the cross-reference sections and the page tree,
+// e.g. truncated responses and HTML error pages are caught here
+func VerifyOutput(job Job) (Output, error) {
+	fileInfo, err := os.Stat(job.OutputFilePath())
+	if err != nil {
+		return Output{}, NewConversionError(models.ConvertRequestErrorCodeOutputInvalid, fmt.Errorf("invalid output: %w", err))
+	}
+
+	if err := pdf.ValidateFile(job.OutputFilePath()); err != nil {
+		return Output{}, NewConversionError(models.ConvertRequestErrorCodeOutputInvalid, fmt.Errorf("invalid output: %w", err))
+	}
+
+	pageCount, err := pdf.CountPagesInFile(job.OutputFilePath())
+	if err != nil {
+		return Output{}, NewConversionError(models.ConvertRequestErrorCodeOutputInvalid, fmt.Errorf("invalid output: %w", err))
+	}
+
+	return Output{PageCount: pageCount, Size: fileInfo.Size()}, nil
+}
@@ -0,0 +1,198 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Runs are searched this far ahead, which covers every valid combination of days and months (e.g. February 29)
+const maxLookAheadYears = 5
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type field struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	minuteField     = field{name: "minute", min: 0, max: 59}
+	hourField       = field{name: "hour", min: 0, max: 23}
+	dayOfMonthField = field{name: "day of month", min: 1, max: 31}
+	monthField      = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is Sunday too
+	dayOfWeekField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// A standard 5 field cron expression ("minute hour day-of-month month day-of-week") or one of the macros,
+// e.g. "30 2 * * 1-5" or "@daily". Times are in UTC. When both the day of month and the day of week are
+// restricted, a day matching either of them matches, like in cron.
+type Schedule struct {
+	minutes     uint64
+	hours       uint64
+	daysOfMonth uint64
+	months      uint64
+	daysOfWeek  uint64
+	// Any day is matched by the field
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+func Parse(expression string) (Schedule, error) {
+	expression = strings.TrimSpace(expression)
+	if macro, ok := macros[strings.ToLower(expression)]; ok {
+		expression = macro
+	}
+
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	}
+
+	var schedule Schedule
+	var err error
+	if schedule.minutes, err = parseField(fields[0], minuteField); err != nil {
+		return Schedule{}, err
+	}
+	if schedule.hours, err = parseField(fields[1], hourField); err != nil {
+		return Schedule{}, err
+	}
+	if schedule.daysOfMonth, err = parseField(fields[2], dayOfMonthField); err != nil {
+		return Schedule{}, err
+	}
+	if schedule.months, err = parseField(fields[3], monthField); err != nil {
+		return Schedule{}, err
+	}
+	if schedule.daysOfWeek, err = parseField(fields[4], dayOfWeekField); err != nil {
+		return Schedule{}, err
+	}
+	if schedule.daysOfWeek&(1<<7) != 0 {
+		schedule.daysOfWeek |= 1 << 0
+	}
+	schedule.anyDayOfMonth = strings.HasPrefix(fields[2], "*")
+	schedule.anyDayOfWeek = strings.HasPrefix(fields[4], "*")
+
+	// E.g. "0 0 30 2 *"
+	if schedule.Next(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).IsZero() {
+		return Schedule{}, fmt.Errorf("expression never matches")
+	}
+
+	return schedule, nil
+}
+
+// The first matching minute after the time, zero if there is none
+func (s Schedule) Next(after time.Time) time.Time {
+	t := after.UTC().Truncate(time.Minute).Add(time.Minute)
+	yearLimit := t.Year() + maxLookAheadYears
+
+	for t.Year() <= yearLimit {
+		if s.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if s.hours&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if s.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (s Schedule) matchesDay(t time.Time) bool {
+	dayOfMonthMatches := s.daysOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeekMatches := s.daysOfWeek&(1<<uint(t.Weekday())) != 0
+
+	if s.anyDayOfMonth || s.anyDayOfWeek {
+		return dayOfMonthMatches && dayOfWeekMatches
+	}
+	return dayOfMonthMatches || dayOfWeekMatches
+}
+
+// Supports "*", values, ranges ("1-5"), steps ("*/15", "1-30/5", "10/5") and comma separated lists of them
+func parseField(value string, f field) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(value, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %s field: %s", f.name, part)
+			}
+		}
+
+		var start, end int
+		if rangePart == "*" {
+			start, end = f.min, f.max
+		} else if startPart, endPart, isRange := strings.Cut(rangePart, "-"); isRange {
+			var err error
+			if start, err = parseValue(startPart, f); err != nil {
+				return 0, err
+			}
+			if end, err = parseValue(endPart, f); err != nil {
+				return 0, err
+			}
+			if end < start {
+				return 0, fmt.Errorf("invalid range in %s field: %s", f.name, part)
+			}
+		} else {
+			var err error
+			if start, err = parseValue(rangePart, f); err != nil {
+				return 0, err
+			}
+			end = start
+			// "10/5" is from 10 to the end
+			if hasStep {
+				end = f.max
+			}
+		}
+
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	return bits, nil
+}
+
+func parseValue(value string, f field) (int, error) {
+	if number, ok := f.names[strings.ToLower(value)]; ok {
+		return number, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < f.min || number > f.max {
+		return 0, fmt.Errorf("invalid value in %s field: %s", f.name, value)
+	}
+
+	return number, nil
+}
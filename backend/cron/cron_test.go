@@ -0,0 +1,102 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func utc(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		after      time.Time
+		expected   time.Time
+	}{
+		{"every minute", "* * * * *", utc(2025, 6, 2, 10, 7), utc(2025, 6, 2, 10, 8)},
+		{"strictly after", "30 10 * * *", utc(2025, 6, 2, 10, 30), utc(2025, 6, 3, 10, 30)},
+		{"seconds are truncated", "30 10 * * *", utc(2025, 6, 2, 10, 29).Add(59 * time.Second), utc(2025, 6, 2, 10, 30)},
+		{"value", "15 * * * *", utc(2025, 6, 2, 10, 20), utc(2025, 6, 2, 11, 15)},
+		{"range", "0 9-17 * * *", utc(2025, 6, 2, 12, 30), utc(2025, 6, 2, 13, 0)},
+		{"range to the next day", "0 9-17 * * *", utc(2025, 6, 2, 17, 30), utc(2025, 6, 3, 9, 0)},
+		{"step", "*/15 * * * *", utc(2025, 6, 2, 10, 7), utc(2025, 6, 2, 10, 15)},
+		{"step to the next hour", "*/15 * * * *", utc(2025, 6, 2, 10, 45), utc(2025, 6, 2, 11, 0)},
+		{"step in range", "5-30/10 * * * *", utc(2025, 6, 2, 10, 26), utc(2025, 6, 2, 11, 5)},
+		{"step from value", "10/20 * * * *", utc(2025, 6, 2, 10, 31), utc(2025, 6, 2, 10, 50)},
+		{"list", "0,30 8,20 * * *", utc(2025, 6, 2, 8, 30), utc(2025, 6, 2, 20, 0)},
+		{"list of ranges and steps", "0 1-2,*/12 * * *", utc(2025, 6, 2, 2, 0), utc(2025, 6, 2, 12, 0)},
+		{"month names", "0 0 1 jan,JUL *", utc(2025, 2, 1, 0, 0), utc(2025, 7, 1, 0, 0)},
+		{"day of week names", "0 0 * * mon-fri", utc(2025, 6, 6, 12, 0), utc(2025, 6, 9, 0, 0)},
+		// 2025-06-07 is a Saturday
+		{"day of week", "0 0 * * 0", utc(2025, 6, 7, 12, 0), utc(2025, 6, 8, 0, 0)},
+		{"7 is Sunday", "0 0 * * 7", utc(2025, 6, 7, 12, 0), utc(2025, 6, 8, 0, 0)},
+		{"day of month", "0 0 15 * *", utc(2025, 6, 2, 0, 0), utc(2025, 6, 15, 0, 0)},
+		{"day of month skips short months", "0 0 31 * *", utc(2025, 4, 1, 0, 0), utc(2025, 5, 31, 0, 0)},
+		// The 10th or any Monday, 2025-06-03 is a Tuesday
+		{"day of month or day of week", "0 0 10 * 1", utc(2025, 6, 3, 0, 0), utc(2025, 6, 9, 0, 0)},
+		{"day of month or day of week, day of month first", "0 0 10 * 1", utc(2025, 6, 9, 0, 0), utc(2025, 6, 10, 0, 0)},
+		{"day of month with any day of week step", "0 0 10 * */1", utc(2025, 6, 3, 0, 0), utc(2025, 6, 10, 0, 0)},
+		{"month rollover", "0 0 1 * *", utc(2025, 1, 31, 12, 0), utc(2025, 2, 1, 0, 0)},
+		{"year rollover", "0 0 1 1 *", utc(2025, 12, 31, 23, 59), utc(2026, 1, 1, 0, 0)},
+		{"last minute of the year", "59 23 31 12 *", utc(2025, 12, 31, 23, 59), utc(2026, 12, 31, 23, 59)},
+		{"leap day", "0 0 29 2 *", utc(2025, 3, 1, 0, 0), utc(2028, 2, 29, 0, 0)},
+		{"hourly", "@hourly", utc(2025, 6, 2, 10, 0), utc(2025, 6, 2, 11, 0)},
+		{"daily", "@daily", utc(2025, 6, 2, 10, 0), utc(2025, 6, 3, 0, 0)},
+		{"weekly", "@weekly", utc(2025, 6, 2, 10, 0), utc(2025, 6, 8, 0, 0)},
+		{"monthly", "@monthly", utc(2025, 6, 2, 10, 0), utc(2025, 7, 1, 0, 0)},
+		{"yearly", "@YEARLY", utc(2025, 6, 2, 10, 0), utc(2026, 1, 1, 0, 0)},
+		{"other time zones", "0 9 * * *", time.Date(2025, 6, 2, 10, 7, 0, 0, time.FixedZone("UTC+2", 2*60*60)), utc(2025, 6, 2, 9, 0)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := Parse(test.expression)
+			if err != nil {
+				t.Fatalf("failed to parse %q: %v", test.expression, err)
+			}
+
+			next := schedule.Next(test.after)
+			if !next.Equal(test.expected) || next.Location() != time.UTC {
+				t.Errorf("expected %q after %s to run at %s, got %s", test.expression, test.after, test.expected, next)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"@every 5m",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"-1 * * * *",
+		"5-1 * * * *",
+		"1- * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"1,,2 * * * *",
+		"a * * * *",
+		"* * * foo *",
+		"* * * * mon-sun-tue",
+		"0 0 30 2 *",
+		"0 0 31 4,6,9,11 *",
+	}
+
+	for _, expression := range tests {
+		t.Run(expression, func(t *testing.T) {
+			if _, err := Parse(expression); err == nil {
+				t.Errorf("expected %q to be invalid", expression)
+			}
+		})
+	}
+}
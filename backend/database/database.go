@@ -19,8 +19,9 @@ var (
 
 func InitDb() error {
 	var err error
+	// NOW() and the TIMESTAMP columns are in UTC regardless of the time zone of the DB server
 	connString := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s timezone=UTC",
 		config.Config.DatabaseHost,
 		config.Config.DatabasePort,
 		config.Config.DatabaseUser,
@@ -60,6 +61,16 @@ func InitDb() error {
 	return nil
 }
 
+// The clock of the DB, the one that sets created_at and the other timestamps, in UTC
+func Now() (time.Time, error) {
+	var now time.Time
+	if err := Connection.Get(&now, "SELECT NOW()::TIMESTAMP"); err != nil {
+		return now, fmt.Errorf("failed to get current time from DB: %w", err)
+	}
+
+	return now.UTC(), nil
+}
+
 func CloseDb() {
 	if Connection != nil {
 		Connection.Close()
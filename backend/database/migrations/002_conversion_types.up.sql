@@ -0,0 +1,2 @@
+ALTER TABLE convert_requests ADD COLUMN mime_type VARCHAR(100) NOT NULL DEFAULT 'application/octet-stream';
+ALTER TABLE convert_requests ADD COLUMN conversion_options JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1 @@
+ALTER TABLE batch_request ADD COLUMN output_type VARCHAR(20) NOT NULL DEFAULT 'zip';
@@ -0,0 +1 @@
+ALTER TABLE convert_requests ADD COLUMN source_path VARCHAR(1000);
@@ -0,0 +1,3 @@
+-- New enum values can't be used in the same transaction, so nothing else is done here
+ALTER TYPE batch_request_status_enum ADD VALUE IF NOT EXISTS 'waiting';
+ALTER TYPE convert_request_status_enum ADD VALUE IF NOT EXISTS 'cancelled';
@@ -0,0 +1 @@
+ALTER TABLE batch_request ADD COLUMN manifest JSONB;
@@ -0,0 +1 @@
+ALTER TABLE batch_request ADD COLUMN streamed BOOLEAN NOT NULL DEFAULT FALSE;
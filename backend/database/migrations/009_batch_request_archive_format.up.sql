@@ -0,0 +1,3 @@
+ALTER TABLE batch_request ADD COLUMN archive_format VARCHAR(20) NOT NULL DEFAULT 'zip';
+-- Encrypted with ARCHIVE_PASSWORD_SECRET and cleared once the batch is processed
+ALTER TABLE batch_request ADD COLUMN archive_password BYTEA;
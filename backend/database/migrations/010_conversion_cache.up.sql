@@ -0,0 +1,14 @@
+ALTER TABLE convert_requests ADD COLUMN content_hash VARCHAR(64);
+ALTER TABLE convert_requests ADD COLUMN cache_key VARCHAR(64);
+
+-- Converted outputs shared between convert requests of the same content and options,
+-- files are kept in the "cache" subfolder of the uploads folder and expire separately from convert requests
+CREATE TABLE conversion_cache (
+  cache_key VARCHAR(64) PRIMARY KEY,
+  file_size BIGINT NOT NULL,
+  hit_count INTEGER NOT NULL DEFAULT 0,
+  last_hit_at TIMESTAMP,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_conversion_cache_created_at ON conversion_cache (created_at);
@@ -0,0 +1,2 @@
+-- Fetched by the background worker, file_size is 0 until then
+ALTER TABLE convert_requests ADD COLUMN source_url VARCHAR(2000);
@@ -0,0 +1,4 @@
+ALTER TABLE convert_requests ADD COLUMN page_count INT;
+ALTER TABLE convert_requests ADD COLUMN output_size BIGINT;
+-- Set along with the error, e.g. "output_invalid" when the converted file is not a valid PDF
+ALTER TABLE convert_requests ADD COLUMN error_code VARCHAR(50);
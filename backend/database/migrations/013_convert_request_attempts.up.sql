@@ -0,0 +1,16 @@
+ALTER TABLE convert_requests ADD COLUMN attempt_count INT NOT NULL DEFAULT 0;
+-- Failed attempts are retried with a backoff, the convert request is queued again but not picked up before this
+ALTER TABLE convert_requests ADD COLUMN not_before TIMESTAMP;
+
+CREATE TABLE convert_request_attempts (
+  id UUID PRIMARY KEY,
+  convert_request_id UUID NOT NULL,
+  attempt INT NOT NULL,
+  engine VARCHAR(50) NOT NULL,
+  started_at TIMESTAMP NOT NULL,
+  duration_ms INT NOT NULL,
+  error VARCHAR(1000),
+  error_code VARCHAR(50)
+);
+
+CREATE INDEX idx_convert_request_attempts_convert_request_id ON convert_request_attempts (convert_request_id);
@@ -0,0 +1,6 @@
+-- 0 is low, 1 normal and 2 high, see models.Priority
+ALTER TABLE convert_requests ADD COLUMN priority SMALLINT NOT NULL DEFAULT 1;
+ALTER TABLE convert_requests ADD COLUMN needed_by TIMESTAMP;
+
+ALTER TABLE batch_request ADD COLUMN priority SMALLINT NOT NULL DEFAULT 1;
+ALTER TABLE batch_request ADD COLUMN needed_by TIMESTAMP;
@@ -0,0 +1,27 @@
+-- Labels set by clients, batch schedules pick convert requests by them. Clients can also delay convert requests with not_before (see 013).
+ALTER TABLE convert_requests ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+CREATE INDEX idx_convert_requests_tags ON convert_requests USING GIN (tags);
+
+-- Queued batch requests are not picked up before this
+ALTER TABLE batch_request ADD COLUMN not_before TIMESTAMP;
+
+-- Recurring batches over the latest convert requests of the user with the tag
+CREATE TABLE batch_schedules (
+  id UUID PRIMARY KEY,
+  user_id UUID NOT NULL,
+  cron_expression VARCHAR(100) NOT NULL,
+  tag VARCHAR(50) NOT NULL,
+  output_type VARCHAR(20) NOT NULL,
+  naming_template VARCHAR(200),
+  archive_format VARCHAR(20) NOT NULL,
+  -- Sealed like in batch_request, but kept for the next runs
+  archive_password BYTEA,
+  priority SMALLINT NOT NULL DEFAULT 1,
+  next_run_at TIMESTAMP NOT NULL,
+  last_run_at TIMESTAMP,
+  last_batch_request_id UUID,
+  created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_batch_schedules_next_run_at ON batch_schedules (next_run_at);
+CREATE INDEX idx_batch_schedules_user_id ON batch_schedules (user_id);
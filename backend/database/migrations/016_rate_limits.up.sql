@@ -0,0 +1,10 @@
+-- Fixed window counters of the postgres rate limit store (RATE_LIMIT_STORE), losing them on a crash only resets the limits
+CREATE UNLOGGED TABLE rate_limit_counters (
+  key VARCHAR(200) NOT NULL,
+  window_start TIMESTAMP NOT NULL,
+  count INT NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (key, window_start)
+);
+
+CREATE INDEX idx_rate_limit_counters_expires_at ON rate_limit_counters (expires_at);
@@ -0,0 +1,19 @@
+-- Users without a row are on DEFAULT_PLAN
+CREATE TABLE user_plans (
+  user_id UUID PRIMARY KEY,
+  plan VARCHAR(50) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Usage per UTC day and month, a new period starts with a new row, so quotas reset by themselves
+CREATE TABLE usage_counters (
+  user_id UUID NOT NULL,
+  period VARCHAR(10) NOT NULL,
+  period_start DATE NOT NULL,
+  conversions INT NOT NULL DEFAULT 0,
+  uploaded_bytes BIGINT NOT NULL DEFAULT 0,
+  batches INT NOT NULL DEFAULT 0,
+  PRIMARY KEY (user_id, period, period_start)
+);
+
+CREATE INDEX idx_usage_counters_period_start ON usage_counters (period_start);
@@ -0,0 +1,2 @@
+-- Batch requests can be cancelled through the admin API
+ALTER TYPE batch_request_status_enum ADD VALUE IF NOT EXISTS 'cancelled';
@@ -0,0 +1,3 @@
+-- Set while a processor works on the request, so that processors of other instances and admin operations leave it alone
+ALTER TABLE convert_requests ADD COLUMN picked_up_at TIMESTAMP;
+ALTER TABLE batch_request ADD COLUMN picked_up_at TIMESTAMP;
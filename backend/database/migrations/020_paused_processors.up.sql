@@ -0,0 +1,5 @@
+-- Processors paused through the admin API, shared by all instances
+CREATE TABLE paused_processors (
+  name VARCHAR(50) PRIMARY KEY,
+  paused_at TIMESTAMP NOT NULL
+);
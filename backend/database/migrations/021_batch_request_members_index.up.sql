@@ -0,0 +1,2 @@
+-- The files cleanup looks up batches that reference a convert request with @>
+CREATE INDEX idx_batch_request_convert_requests ON batch_request USING GIN (convert_requests jsonb_path_ops);
@@ -0,0 +1,411 @@
+package endpoint_handlers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid/v5"
+	"github.com/jmoiron/sqlx"
+	"github.com/karpov-kir/word-to-pdf/backend/background"
+	"github.com/karpov-kir/word-to-pdf/backend/database"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/karpov-kir/word-to-pdf/backend/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// At most this many requests are changed by a single bulk operation, so that a broad filter doesn't lock
+// the tables for long. Operators repeat the operation while hasMore is true.
+const maxAdminBulkSize = 1000
+
+const maxAdminQueueUsers = 50
+
+// Queue inspection and operations for operators, only for admin API keys (see auth.AdminMiddleware).
+// The task pools are of this instance, so requests in progress on other instances are not listed as in flight,
+// but they are picked up (see background.NotPickedUp) and left alone by the operations.
+type AdminHandler struct {
+	ConvertTaskPool *utils.TaskPool
+	BatchTaskPool   *utils.TaskPool
+}
+
+type adminQueue struct {
+	table     string
+	processor string
+	taskPool  *utils.TaskPool
+	// All statuses, to validate filters
+	statuses []string
+	// Statuses of the requests that are still to be processed
+	pendingStatuses []string
+	requeue         adminOperation
+	cancel          adminOperation
+	purge           func(ids []string) (int64, error)
+}
+
+type adminOperation struct {
+	fromStatuses []string
+	// Additional condition of the requests the operation applies to
+	condition string
+	set       string
+}
+
+func (h *AdminHandler) convertQueue() adminQueue {
+	return adminQueue{
+		table:     "convert_requests",
+		processor: background.ConvertProcessor,
+		taskPool:  h.ConvertTaskPool,
+		statuses: []string{
+			string(models.ConvertRequestStatusQueued),
+			string(models.ConvertRequestStatusDone),
+			string(models.ConvertRequestStatusError),
+			string(models.ConvertRequestStatusCancelled),
+		},
+		pendingStatuses: []string{string(models.ConvertRequestStatusQueued)},
+		// Delayed and retried convert requests are queued too, they are made due right away
+		requeue: adminOperation{
+			fromStatuses: []string{
+				string(models.ConvertRequestStatusQueued),
+				string(models.ConvertRequestStatusError),
+				string(models.ConvertRequestStatusCancelled),
+			},
+			condition: "is_file_deleted = FALSE",
+			set: fmt.Sprintf(
+				"status = '%s', error = NULL, error_code = NULL, attempt_count = 0, not_before = NOW()",
+				models.ConvertRequestStatusQueued,
+			),
+		},
+		cancel: adminOperation{
+			fromStatuses: []string{string(models.ConvertRequestStatusQueued)},
+			set:          fmt.Sprintf("status = '%s'", models.ConvertRequestStatusCancelled),
+		},
+		purge: background.PurgeConvertRequests,
+	}
+}
+
+func (h *AdminHandler) batchQueue() adminQueue {
+	return adminQueue{
+		table:     "batch_request",
+		processor: background.BatchProcessor,
+		taskPool:  h.BatchTaskPool,
+		statuses: []string{
+			string(models.BatchRequestStatusWaiting),
+			string(models.BatchRequestStatusQueued),
+			string(models.BatchRequestStatusDone),
+			string(models.BatchRequestStatusError),
+			string(models.BatchRequestStatusCancelled),
+		},
+		pendingStatuses: []string{string(models.BatchRequestStatusWaiting), string(models.BatchRequestStatusQueued)},
+		// Requeued batch requests wait for their convert requests again. The passwords of encrypted archives are
+		// dropped once the batch request is finished, so such batch requests can't be requeued.
+		requeue: adminOperation{
+			fromStatuses: []string{string(models.BatchRequestStatusError), string(models.BatchRequestStatusCancelled)},
+			condition:    fmt.Sprintf("NOT (archive_format = '%s' AND archive_password IS NULL)", models.BatchRequestArchiveFormatZipAes),
+			set: fmt.Sprintf(
+				"status = '%s', error = NULL, batched_at = NULL, is_batch_deleted = FALSE, not_before = NOW()",
+				models.BatchRequestStatusWaiting,
+			),
+		},
+		cancel: adminOperation{
+			fromStatuses: []string{string(models.BatchRequestStatusWaiting), string(models.BatchRequestStatusQueued)},
+			set:          fmt.Sprintf("status = '%s', archive_password = NULL", models.BatchRequestStatusCancelled),
+		},
+		purge: background.PurgeBatchRequests,
+	}
+}
+
+type adminQueueStats struct {
+	// Of the requests due within the window of the processors (12 hours), delayed requests are included
+	ByStatus map[string]int `json:"byStatus"`
+	// Users with the most pending requests
+	ByUser []adminUserQueueStats `json:"byUser"`
+	// Of the pending requests that are due, nil when there are none
+	OldestQueuedAgeMs *int64 `json:"oldestQueuedAgeMs"`
+	// Tokens (request IDs) of the task pool of this instance
+	InFlight []string `json:"inFlight"`
+	Paused   bool     `json:"paused"`
+}
+
+type adminUserQueueStats struct {
+	UserId  string `db:"user_id" json:"userId"`
+	Queued  int    `db:"queued" json:"queued"`
+	Delayed int    `db:"delayed" json:"delayed"`
+}
+
+func (h *AdminHandler) GetQueue(c *fiber.Ctx) error {
+	convertQueueStats, err := fetchAdminQueueStats(h.convertQueue())
+	if err != nil {
+		return err
+	}
+
+	batchQueueStats, err := fetchAdminQueueStats(h.batchQueue())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"convertRequests": convertQueueStats,
+		"batchRequests":   batchQueueStats,
+	})
+}
+
+func fetchAdminQueueStats(queue adminQueue) (adminQueueStats, error) {
+	stats := adminQueueStats{
+		ByStatus: map[string]int{},
+		InFlight: []string{},
+		Paused:   background.IsProcessorPaused(queue.processor),
+	}
+
+	statusCounts := []struct {
+		Status string `db:"status"`
+		Count  int    `db:"count"`
+	}{}
+	if err := database.Connection.Select(
+		&statusCounts,
+		`SELECT status, COUNT(*) AS count FROM `+queue.table+`
+      WHERE `+background.DueAt+` >= NOW() - INTERVAL '12 HOURS'
+      GROUP BY status`,
+	); err != nil {
+		return stats, fmt.Errorf("failed to count %s by status: %w", queue.table, err)
+	}
+	for _, statusCount := range statusCounts {
+		stats.ByStatus[statusCount.Status] = statusCount.Count
+	}
+
+	query, args, err := sqlx.In(
+		`SELECT
+        user_id,
+        COUNT(*) FILTER (WHERE `+background.DueAt+` <= NOW()) AS queued,
+        COUNT(*) FILTER (WHERE `+background.DueAt+` > NOW()) AS delayed
+      FROM `+queue.table+`
+      WHERE status IN (?) AND `+background.DueAt+` >= NOW() - INTERVAL '12 HOURS'
+      GROUP BY user_id
+      ORDER BY COUNT(*) DESC
+      LIMIT ?`,
+		queue.pendingStatuses,
+		maxAdminQueueUsers,
+	)
+	if err != nil {
+		return stats, fmt.Errorf("failed to build in clause in query: %w", err)
+	}
+	stats.ByUser = []adminUserQueueStats{}
+	if err := database.Connection.Select(&stats.ByUser, database.Connection.Rebind(query), args...); err != nil {
+		return stats, fmt.Errorf("failed to count %s by user: %w", queue.table, err)
+	}
+
+	query, args, err = sqlx.In(
+		`SELECT CAST(EXTRACT(EPOCH FROM NOW() - MIN(`+background.DueAt+`)) * 1000 AS BIGINT) FROM `+queue.table+`
+      WHERE status IN (?) AND `+background.DueAt+` >= NOW() - INTERVAL '12 HOURS' AND `+background.DueAt+` <= NOW()`,
+		queue.pendingStatuses,
+	)
+	if err != nil {
+		return stats, fmt.Errorf("failed to build in clause in query: %w", err)
+	}
+	if err := database.Connection.Get(&stats.OldestQueuedAgeMs, database.Connection.Rebind(query), args...); err != nil {
+		return stats, fmt.Errorf("failed to fetch oldest queued %s: %w", queue.table, err)
+	}
+
+	for token := range queue.taskPool.OccupiedTokens() {
+		stats.InFlight = append(stats.InFlight, token)
+	}
+	slices.Sort(stats.InFlight)
+
+	return stats, nil
+}
+
+// Selects requests by IDs or by a filter, the given fields are combined
+type adminBulkRequest struct {
+	Ids    []uuid.UUID `json:"ids"`
+	Status string      `json:"status"`
+	UserId *uuid.UUID  `json:"userId"`
+	// Unix milliseconds
+	CreatedBefore *int64 `json:"createdBefore"`
+}
+
+func (h *AdminHandler) RequeueConvertRequests(c *fiber.Ctx) error {
+	queue := h.convertQueue()
+	return runAdminOperation(c, queue, "requeue", &queue.requeue)
+}
+
+func (h *AdminHandler) CancelConvertRequests(c *fiber.Ctx) error {
+	queue := h.convertQueue()
+	return runAdminOperation(c, queue, "cancel", &queue.cancel)
+}
+
+func (h *AdminHandler) PurgeConvertRequests(c *fiber.Ctx) error {
+	return runAdminOperation(c, h.convertQueue(), "purge", nil)
+}
+
+func (h *AdminHandler) RequeueBatchRequests(c *fiber.Ctx) error {
+	queue := h.batchQueue()
+	return runAdminOperation(c, queue, "requeue", &queue.requeue)
+}
+
+func (h *AdminHandler) CancelBatchRequests(c *fiber.Ctx) error {
+	queue := h.batchQueue()
+	return runAdminOperation(c, queue, "cancel", &queue.cancel)
+}
+
+func (h *AdminHandler) PurgeBatchRequests(c *fiber.Ctx) error {
+	return runAdminOperation(c, h.batchQueue(), "purge", nil)
+}
+
+// Requests in progress on any instance are skipped. Without an operation the matching requests are purged.
+func runAdminOperation(c *fiber.Ctx, queue adminQueue, name string, operation *adminOperation) error {
+	var request adminBulkRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	if len(request.Ids) == 0 && request.Status == "" && request.UserId == nil && request.CreatedBefore == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "IDs or a filter (status, userId, createdBefore) are required",
+		})
+	}
+
+	if len(request.Ids) > maxAdminBulkSize {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("At most %d IDs are allowed", maxAdminBulkSize),
+		})
+	}
+
+	if request.Status != "" && !slices.Contains(queue.statuses, request.Status) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Unsupported status: %s, supported statuses: %s", request.Status, strings.Join(queue.statuses, ", ")),
+		})
+	}
+
+	createdBefore, err := timestampFromUnixMilli("createdBefore", request.CreatedBefore)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ids, err := selectAdminOperationIds(queue, request, createdBefore, operation)
+	if err != nil {
+		return err
+	}
+
+	var affected int64
+	if len(ids) > 0 {
+		if operation == nil {
+			affected, err = queue.purge(ids)
+		} else {
+			affected, err = applyAdminOperation(queue, operation, ids)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	logrus.Infof("Admin %s of %s affected %d out of %d matching requests", name, queue.table, affected, len(ids))
+
+	return c.JSON(fiber.Map{
+		"affected": affected,
+		"hasMore":  len(ids) == maxAdminBulkSize,
+	})
+}
+
+func selectAdminOperationIds(queue adminQueue, request adminBulkRequest, createdBefore *time.Time, operation *adminOperation) ([]string, error) {
+	inProgress := []string{uuid.Nil.String()}
+	for token := range queue.taskPool.OccupiedTokens() {
+		inProgress = append(inProgress, token)
+	}
+
+	namedArgs := map[string]interface{}{
+		"inProgress": inProgress,
+		"limit":      maxAdminBulkSize,
+	}
+	conditions := []string{"id NOT IN (:inProgress)", background.NotPickedUp}
+
+	if len(request.Ids) > 0 {
+		namedArgs["ids"] = request.Ids
+		conditions = append(conditions, "id IN (:ids)")
+	}
+	if request.Status != "" {
+		namedArgs["status"] = request.Status
+		conditions = append(conditions, "CAST(status AS TEXT) = :status")
+	}
+	if request.UserId != nil {
+		namedArgs["userId"] = *request.UserId
+		conditions = append(conditions, "user_id = :userId")
+	}
+	if createdBefore != nil {
+		namedArgs["createdBefore"] = *createdBefore
+		conditions = append(conditions, "created_at < :createdBefore")
+	}
+	if operation != nil {
+		namedArgs["fromStatuses"] = operation.fromStatuses
+		conditions = append(conditions, "CAST(status AS TEXT) IN (:fromStatuses)")
+		if operation.condition != "" {
+			conditions = append(conditions, operation.condition)
+		}
+	}
+
+	query, args, err := sqlx.Named(
+		`SELECT id FROM `+queue.table+` WHERE `+strings.Join(conditions, " AND ")+` ORDER BY created_at LIMIT :limit`,
+		namedArgs,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	query, args, err = sqlx.In(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build in clause in query: %w", err)
+	}
+
+	ids := []string{}
+	if err := database.Connection.Select(&ids, database.Connection.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", queue.table, err)
+	}
+
+	return ids, nil
+}
+
+// The statuses are checked again, the requests could have been picked up or finished since they were selected
+func applyAdminOperation(queue adminQueue, operation *adminOperation, ids []string) (int64, error) {
+	query, args, err := sqlx.In(
+		`UPDATE `+queue.table+` SET `+operation.set+` WHERE id IN (?) AND CAST(status AS TEXT) IN (?) AND `+background.NotPickedUp,
+		ids,
+		operation.fromStatuses,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build in clause in query: %w", err)
+	}
+
+	result, err := database.Connection.Exec(database.Connection.Rebind(query), args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update %s: %w", queue.table, err)
+	}
+
+	return result.RowsAffected()
+}
+
+func (h *AdminHandler) PauseProcessor(c *fiber.Ctx) error {
+	return setProcessorPaused(c, true)
+}
+
+func (h *AdminHandler) ResumeProcessor(c *fiber.Ctx) error {
+	return setProcessorPaused(c, false)
+}
+
+func setProcessorPaused(c *fiber.Ctx, paused bool) error {
+	name := c.Params("name")
+	if err := background.SetProcessorPaused(name, paused); errors.Is(err, background.ErrUnknownProcessor) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": fmt.Sprintf("Unsupported processor: %s, supported processors: %s, %s", name, background.ConvertProcessor, background.BatchProcessor),
+		})
+	} else if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"processor": name,
+		"paused":    paused,
+	})
+}
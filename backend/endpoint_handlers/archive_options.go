@@ -0,0 +1,68 @@
+package endpoint_handlers
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/karpov-kir/word-to-pdf/backend/archives"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+)
+
+const (
+	minArchivePasswordLength = 8
+	maxArchivePasswordLength = 128
+)
+
+type archiveOptions struct {
+	Format models.BatchRequestArchiveFormat
+	// The password is never stored in plaintext, see archives.SealPassword
+	SealedPassword []byte
+}
+
+func parseArchiveOptions(outputType models.BatchRequestOutputType, format string, password string, streamed bool) (archiveOptions, error) {
+	options := archiveOptions{Format: models.BatchRequestArchiveFormat(format)}
+	if options.Format == "" {
+		options.Format = models.BatchRequestArchiveFormatZip
+	}
+
+	switch options.Format {
+	case models.BatchRequestArchiveFormatZip, models.BatchRequestArchiveFormatTarGz, models.BatchRequestArchiveFormatZipAes:
+	default:
+		return options, fmt.Errorf("unsupported archive format: %s", options.Format)
+	}
+
+	if outputType != models.BatchRequestOutputTypeZip && options.Format != models.BatchRequestArchiveFormatZip {
+		return options, fmt.Errorf("archive format is only supported for the zip output type")
+	}
+
+	if streamed && outputType != models.BatchRequestOutputTypeZip {
+		return options, fmt.Errorf("only zip batches can be streamed")
+	}
+
+	if streamed && options.Format != models.BatchRequestArchiveFormatZip {
+		return options, fmt.Errorf("only plain zip batches can be streamed")
+	}
+
+	if options.Format != models.BatchRequestArchiveFormatZipAes {
+		if password != "" {
+			return options, fmt.Errorf("archive password is only supported for the %s archive format", models.BatchRequestArchiveFormatZipAes)
+		}
+		return options, nil
+	}
+
+	if !archives.ArePasswordsEnabled() {
+		return options, fmt.Errorf("the %s archive format is disabled on this server", models.BatchRequestArchiveFormatZipAes)
+	}
+
+	if passwordLength := utf8.RuneCountInString(password); passwordLength < minArchivePasswordLength || passwordLength > maxArchivePasswordLength {
+		return options, fmt.Errorf("archive password must be %d to %d characters long", minArchivePasswordLength, maxArchivePasswordLength)
+	}
+
+	sealedPassword, err := archives.SealPassword(password)
+	if err != nil {
+		return options, err
+	}
+	options.SealedPassword = sealedPassword
+
+	return options, nil
+}
@@ -5,10 +5,35 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/karpov-kir/word-to-pdf/backend/auth"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
 )
 
+// Tokens are normal priority by default, "low" can be requested for bulk work. High priority is only given to API keys.
 func CreateToken(c *fiber.Ctx) error {
-	token, err := auth.GenerateJWT()
+	var request struct {
+		Priority string `json:"priority"`
+	}
+
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Failed to parse request body",
+			})
+		}
+	}
+
+	priority := models.PriorityNormal
+	if request.Priority != "" {
+		var err error
+		priority, err = models.ParsePriority(request.Priority)
+		if err != nil || priority > models.PriorityNormal {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Unsupported priority: %s", request.Priority),
+			})
+		}
+	}
+
+	token, err := auth.GenerateJWT(priority)
 	if err != nil {
 		return fmt.Errorf("failed to generate JWT: %w", err)
 	}
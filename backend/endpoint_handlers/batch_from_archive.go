@@ -0,0 +1,278 @@
+package endpoint_handlers
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid/v5"
+	"github.com/karpov-kir/word-to-pdf/backend/auth"
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/converters"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/karpov-kir/word-to-pdf/backend/naming"
+	"github.com/karpov-kir/word-to-pdf/backend/quota"
+	"github.com/sirupsen/logrus"
+)
+
+var errArchiveTooLarge = errors.New("archive is too large when uncompressed")
+
+type extractedDocument struct {
+	id         uuid.UUID
+	sourcePath string
+	size       int64
+}
+
+// Creates a convert request per supported document in the uploaded zip and a batch that waits for all of them
+func (h *BatchRequestsHandler) CreateBatchRequestFromArchive(c *fiber.Ctx) error {
+	userId := c.Locals(auth.UserIdLocal).(string)
+	priority := auth.Priority(c)
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Failed to parse form: %v", err))
+	}
+
+	files := form.File["file"]
+	if len(files) == 0 {
+		return c.Status(fiber.StatusBadRequest).SendString("No file uploaded")
+	}
+
+	outputType := models.BatchRequestOutputType(c.FormValue("outputType", string(models.BatchRequestOutputTypeZip)))
+	if outputType != models.BatchRequestOutputTypeZip && outputType != models.BatchRequestOutputTypePdf {
+		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Unsupported output type: %s", outputType))
+	}
+
+	streamed := c.FormValue("streamed") == "true"
+	archiveOptions, err := parseArchiveOptions(outputType, c.FormValue("archiveFormat"), c.FormValue("archivePassword"), streamed)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Invalid archive options: %v", err))
+	}
+
+	namingTemplate, err := naming.ParseTemplate(c.FormValue("namingTemplate"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Invalid naming template: %v", err))
+	}
+
+	conversionOptions, err := parseConversionOptions(form)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Invalid conversion options: %v", err))
+	}
+
+	schedulingOptions, err := parseSchedulingOptions(c)
+	if err == nil && schedulingOptions.NotBefore != nil && streamed {
+		err = errStreamedBatchNotBefore
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	archiveFile, err := files[0].Open()
+	if err != nil {
+		return fmt.Errorf("failed to open file stream: %w", err)
+	}
+	defer archiveFile.Close()
+
+	zipReader, err := zip.NewReader(archiveFile, files[0].Size)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Invalid zip archive: %v", err))
+	}
+
+	documents, err := extractArchiveDocuments(zipReader)
+	if errors.Is(err, errArchiveTooLarge) {
+		return c.Status(fiber.StatusRequestEntityTooLarge).SendString(err.Error())
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Failed to extract archive: %v", err))
+	}
+	if len(documents) == 0 {
+		return c.Status(fiber.StatusBadRequest).SendString("No supported documents found in the archive")
+	}
+
+	logrus.Infof("Extracted %d documents from archive %s of user %s", len(documents), files[0].Filename, userId)
+
+	// The convert requests and the batch are created together, the extracted files are removed when they are not
+	committed := false
+	defer func() {
+		if !committed {
+			removeExtractedDocuments(documents)
+		}
+	}()
+
+	// The extracted bytes are counted, the archive can be compressed a lot (up to ARCHIVE_MAX_COMPRESSION_RATIO)
+	var extractedBytes int64
+	for _, document := range documents {
+		extractedBytes += document.size
+	}
+
+	tx, err := beginWithQuota(userId, quota.Usage{Conversions: len(documents), UploadedBytes: extractedBytes, Batches: 1})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	convertRequests := make([]models.ConvertRequest, 0, len(documents))
+	batchRequestMembers := make([]models.BatchRequestMember, 0, len(documents))
+
+	for _, document := range documents {
+		sourcePath := document.sourcePath
+		convertRequest, err := insertConvertRequest(tx, newConvertRequest{
+			Id:                document.id,
+			UserId:            userId,
+			FileName:          truncateFileName(path.Base(sourcePath)),
+			FileSize:          document.size,
+			MimeType:          converters.DetectMimeType(sourcePath),
+			ConversionOptions: conversionOptions,
+			SourcePath:        &sourcePath,
+			Priority:          priority,
+			NeededBy:          schedulingOptions.NeededBy,
+			NotBefore:         schedulingOptions.NotBefore,
+			Tags:              schedulingOptions.Tags,
+		})
+		if err != nil {
+			return err
+		}
+
+		convertRequests = append(convertRequests, convertRequest)
+		batchRequestMembers = append(batchRequestMembers, models.BatchRequestMember{
+			Id:         convertRequest.Id,
+			FileName:   convertRequest.FileName,
+			SourcePath: &sourcePath,
+		})
+	}
+
+	batchRequest, err := insertBatchRequest(tx, newBatchRequest{
+		UserId:          userId,
+		ConvertRequests: batchRequestMembers,
+		OutputType:      outputType,
+		NamingTemplate:  namingTemplate,
+		Streamed:        streamed,
+		ArchiveOptions:  archiveOptions,
+		Priority:        priority,
+		NeededBy:        schedulingOptions.NeededBy,
+		NotBefore:       schedulingOptions.NotBefore,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit batch request: %w", err)
+	}
+	committed = true
+
+	return c.JSON(fiber.Map{
+		"batchRequest":    batchRequest,
+		"convertRequests": convertRequests,
+	})
+}
+
+// Extracts supported documents into the uploads folder. The declared sizes of entries can't be trusted,
+// so the actual amount of decompressed bytes is limited too (zip bombs).
+func extractArchiveDocuments(zipReader *zip.Reader) ([]extractedDocument, error) {
+	documents := []extractedDocument{}
+	var uncompressedSum int64
+
+	for _, entry := range zipReader.File {
+		sourcePath, ok := sanitizeArchivePath(entry.Name)
+		if !ok || entry.FileInfo().IsDir() || !converters.IsSupported(sourcePath) {
+			logrus.Debugf("Skipping archive entry %s", entry.Name)
+			continue
+		}
+
+		if len(documents) >= config.Config.ArchiveMaxEntries {
+			removeExtractedDocuments(documents)
+			return nil, fmt.Errorf("too many documents, max %d", config.Config.ArchiveMaxEntries)
+		}
+
+		entryLimit := config.Config.ArchiveMaxUncompressedSize - uncompressedSum
+		if ratioLimit := int64(entry.CompressedSize64) * config.Config.ArchiveMaxCompressionRatio; ratioLimit < entryLimit {
+			entryLimit = ratioLimit
+		}
+
+		document, err := extractArchiveEntry(entry, sourcePath, entryLimit)
+		if err != nil {
+			removeExtractedDocuments(documents)
+			return nil, err
+		}
+
+		documents = append(documents, document)
+		uncompressedSum += document.size
+	}
+
+	return documents, nil
+}
+
+func removeExtractedDocuments(documents []extractedDocument) {
+	for _, document := range documents {
+		os.Remove(filepath.Join(config.Config.UploadsFolderAbsolutePath, document.id.String()))
+	}
+}
+
+func extractArchiveEntry(entry *zip.File, sourcePath string, limit int64) (extractedDocument, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return extractedDocument{}, fmt.Errorf("failed to generate UUID: %w", err)
+	}
+
+	entryReader, err := entry.Open()
+	if err != nil {
+		return extractedDocument{}, fmt.Errorf("failed to open %s: %w", sourcePath, err)
+	}
+	defer entryReader.Close()
+
+	filePath := filepath.Join(config.Config.UploadsFolderAbsolutePath, id.String())
+	localFileWriter, err := os.Create(filePath)
+	if err != nil {
+		return extractedDocument{}, fmt.Errorf("failed to create file on server: %w", err)
+	}
+	defer localFileWriter.Close()
+
+	size, err := io.Copy(localFileWriter, io.LimitReader(entryReader, limit+1))
+	if err == nil && size > limit {
+		err = errArchiveTooLarge
+	}
+	if err != nil {
+		localFileWriter.Close()
+		os.Remove(filePath)
+		return extractedDocument{}, fmt.Errorf("failed to extract %s: %w", sourcePath, err)
+	}
+
+	return extractedDocument{id: id, sourcePath: sourcePath, size: size}, nil
+}
+
+// Returns a clean relative path, entries escaping the archive (zip slip) and system junk are rejected
+func sanitizeArchivePath(name string) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || strings.Contains(name, ":") {
+		return "", false
+	}
+
+	for _, segment := range strings.Split(name, "/") {
+		if segment == ".." || segment == "__MACOSX" || strings.HasPrefix(segment, "._") {
+			return "", false
+		}
+	}
+
+	cleanPath := path.Clean(name)
+	if cleanPath == "." || len(cleanPath) > 1000 || path.Base(cleanPath)[0] == '.' {
+		return "", false
+	}
+
+	return cleanPath, true
+}
+
+func truncateFileName(fileName string) string {
+	if len(fileName) <= 250 {
+		return fileName
+	}
+
+	extension := path.Ext(fileName)
+	return strings.ToValidUTF8(fileName[:250-len(extension)], "") + extension
+}
@@ -5,13 +5,19 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofrs/uuid/v5"
 	"github.com/jmoiron/sqlx"
+	"github.com/karpov-kir/word-to-pdf/backend/auth"
+	"github.com/karpov-kir/word-to-pdf/backend/background"
 	"github.com/karpov-kir/word-to-pdf/backend/config"
 	"github.com/karpov-kir/word-to-pdf/backend/database"
 	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/karpov-kir/word-to-pdf/backend/naming"
+	"github.com/karpov-kir/word-to-pdf/backend/quota"
 	"github.com/karpov-kir/word-to-pdf/backend/utils"
 	"github.com/sirupsen/logrus"
 )
@@ -21,10 +27,17 @@ type BatchRequestsHandler struct {
 }
 
 func (h *BatchRequestsHandler) CreateBatchRequest(c *fiber.Ctx) error {
-	userId := c.Locals("userId").(string)
+	userId := c.Locals(auth.UserIdLocal).(string)
 
 	var request struct {
-		ConvertRequestIds []uuid.UUID `json:"convertRequestIds"`
+		ConvertRequestIds []uuid.UUID                   `json:"convertRequestIds"`
+		OutputType        models.BatchRequestOutputType `json:"outputType"`
+		NamingTemplate    string                        `json:"namingTemplate"`
+		Streamed          bool                          `json:"streamed"`
+		ArchiveFormat     string                        `json:"archiveFormat"`
+		ArchivePassword   string                        `json:"archivePassword"`
+		NeededBy          *int64                        `json:"neededBy"`
+		NotBefore         *int64                        `json:"notBefore"`
 	}
 
 	if err := c.BodyParser(&request); err != nil {
@@ -39,6 +52,48 @@ func (h *BatchRequestsHandler) CreateBatchRequest(c *fiber.Ctx) error {
 		})
 	}
 
+	if request.OutputType == "" {
+		request.OutputType = models.BatchRequestOutputTypeZip
+	} else if request.OutputType != models.BatchRequestOutputTypeZip && request.OutputType != models.BatchRequestOutputTypePdf {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Unsupported output type: %s", request.OutputType),
+		})
+	}
+
+	archiveOptions, err := parseArchiveOptions(request.OutputType, request.ArchiveFormat, request.ArchivePassword, request.Streamed)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid archive options: %v", err),
+		})
+	}
+
+	namingTemplate, err := naming.ParseTemplate(request.NamingTemplate)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid naming template: %v", err),
+		})
+	}
+
+	neededBy, err := timestampFromUnixMilli("neededBy", request.NeededBy)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	notBefore, err := timestampFromUnixMilli("notBefore", request.NotBefore)
+	if err == nil {
+		err = validateNotBefore(notBefore)
+	}
+	if err == nil && notBefore != nil && request.Streamed {
+		err = errStreamedBatchNotBefore
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	if len(request.ConvertRequestIds) > 200 {
 		logrus.Warnf("Too many convert request IDs provided: %d, truncating to 200", len(request.ConvertRequestIds))
 		request.ConvertRequestIds = request.ConvertRequestIds[len(request.ConvertRequestIds)-200:]
@@ -46,7 +101,7 @@ func (h *BatchRequestsHandler) CreateBatchRequest(c *fiber.Ctx) error {
 
 	query, args, err := sqlx.Named(
 		`
-      SELECT id, file_name
+      SELECT id, file_name, source_path
       FROM convert_requests WHERE id IN (:ids)
     `,
 		map[string]interface{}{
@@ -62,55 +117,124 @@ func (h *BatchRequestsHandler) CreateBatchRequest(c *fiber.Ctx) error {
 	}
 	query = database.Connection.Rebind(query)
 
-	var convertRequests []struct {
-		Id       uuid.UUID `db:"id" json:"id"`
-		FileName string    `db:"file_name" json:"file_name"`
-	}
+	var convertRequests []models.BatchRequestMember
 	if err := database.Connection.Select(&convertRequests, query, args...); err != nil {
 		return fmt.Errorf("failed to fetch convert requests: %w", err)
 	}
 
+	// The order matters for merged PDFs, so the order of the request is kept
+	positions := make(map[uuid.UUID]int, len(request.ConvertRequestIds))
+	for i, convertRequestId := range request.ConvertRequestIds {
+		positions[convertRequestId] = i
+	}
+	sort.Slice(convertRequests, func(i, j int) bool {
+		return positions[convertRequests[i].Id] < positions[convertRequests[j].Id]
+	})
+
+	tx, err := beginWithQuota(userId, quota.Usage{Batches: 1})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	batchRequest, err := insertBatchRequest(tx, newBatchRequest{
+		UserId:          userId,
+		ConvertRequests: convertRequests,
+		OutputType:      request.OutputType,
+		NamingTemplate:  namingTemplate,
+		Streamed:        request.Streamed,
+		ArchiveOptions:  archiveOptions,
+		Priority:        auth.Priority(c),
+		NeededBy:        neededBy,
+		NotBefore:       notBefore,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit batch request: %w", err)
+	}
+
+	return c.JSON(batchRequest)
+}
+
+type newBatchRequest struct {
+	UserId          string
+	ConvertRequests []models.BatchRequestMember
+	OutputType      models.BatchRequestOutputType
+	NamingTemplate  naming.Template
+	Streamed        bool
+	ArchiveOptions  archiveOptions
+	Priority        models.Priority
+	NeededBy        *time.Time
+	NotBefore       *time.Time
+}
+
+func insertBatchRequest(db sqlx.Ext, request newBatchRequest) (models.BatchRequest, error) {
+	var batchRequest models.BatchRequest
+
 	id, err := uuid.NewV7()
 	if err != nil {
-		return fmt.Errorf("failed to generate UUID: %w", err)
+		return batchRequest, fmt.Errorf("failed to generate UUID: %w", err)
 	}
 
-	convertRequestsJSON, err := json.Marshal(convertRequests)
+	convertRequestsJSON, err := json.Marshal(request.ConvertRequests)
 	if err != nil {
-		return fmt.Errorf("failed to marshal convert requests: %w", err)
+		return batchRequest, fmt.Errorf("failed to marshal convert requests: %w", err)
 	}
 
 	batchRequestPayload := map[string]interface{}{
 		"id":               id,
 		"convert_requests": convertRequestsJSON,
-		"status":           models.BatchRequestStatusQueued,
-		"user_id":          userId,
+		"output_type":      request.OutputType,
+		"naming_template":  string(request.NamingTemplate),
+		"streamed":         request.Streamed,
+		"archive_format":   request.ArchiveOptions.Format,
+		"archive_password": request.ArchiveOptions.SealedPassword,
+		"priority":         request.Priority,
+		"needed_by":        request.NeededBy,
+		"not_before":       request.NotBefore,
+		"status":           models.BatchRequestStatusWaiting,
+		"user_id":          request.UserId,
 		"created_at":       "NOW()",
 	}
-	rows, err := database.Connection.NamedQuery(
+	rows, err := sqlx.NamedQuery(
+		db,
 		`
-      INSERT INTO batch_request (id, convert_requests, status, created_at, user_id)
-      VALUES (:id, :convert_requests, :status, :created_at, :user_id)
-      RETURNING id, status, created_at
+      INSERT INTO batch_request (
+        id, convert_requests, output_type, naming_template, streamed, archive_format, archive_password, priority, needed_by, not_before, status,
+        created_at, user_id
+      )
+      VALUES (
+        :id, :convert_requests, :output_type, :naming_template, :streamed, :archive_format, :archive_password, :priority, :needed_by, :not_before, :status,
+        :created_at, :user_id
+      )
+      RETURNING id, output_type, naming_template, streamed, archive_format, priority, needed_by, not_before, status, created_at
     `,
 		batchRequestPayload,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to insert batch request into DB: %w", err)
+		return batchRequest, fmt.Errorf("failed to insert batch request into DB: %w", err)
 	}
 	defer rows.Close()
 
-	var batchRequest models.BatchRequest
-
 	if rows.Next() {
 		rows.Scan(
 			&batchRequest.Id,
+			&batchRequest.OutputType,
+			&batchRequest.NamingTemplate,
+			&batchRequest.Streamed,
+			&batchRequest.ArchiveFormat,
+			&batchRequest.Priority,
+			&batchRequest.NeededBy,
+			&batchRequest.NotBefore,
 			&batchRequest.Status,
 			&batchRequest.CreatedAt,
 		)
 	}
 
-	return c.JSON(batchRequest)
+	return batchRequest, nil
 }
 
 func (h *BatchRequestsHandler) DownloadBatchFile(c *fiber.Ctx) error {
@@ -119,12 +243,17 @@ func (h *BatchRequestsHandler) DownloadBatchFile(c *fiber.Ctx) error {
 	logrus.Info("Downloading batch file from batch request: ", batchRequestId)
 
 	var batchRequest struct {
-		Id string `db:"id"`
+		Id             string                           `db:"id"`
+		OutputType     models.BatchRequestOutputType    `db:"output_type"`
+		ArchiveFormat  models.BatchRequestArchiveFormat `db:"archive_format"`
+		Streamed       bool                             `db:"streamed"`
+		Status         models.BatchRequestStatus        `db:"status"`
+		IsBatchDeleted bool                             `db:"is_batch_deleted"`
 	}
 
 	query, args, err := sqlx.Named(
 		`
-    SELECT id
+    SELECT id, output_type, archive_format, streamed, status, is_batch_deleted
     FROM batch_request WHERE id = :id
   `,
 		map[string]interface{}{
@@ -140,14 +269,32 @@ func (h *BatchRequestsHandler) DownloadBatchFile(c *fiber.Ctx) error {
 		return fmt.Errorf("failed to fetch batch request: %w", err)
 	}
 
-	filePath := filepath.Join(config.Config.UploadsFolderAbsolutePath, fmt.Sprintf("%s.zip", batchRequest.Id))
+	if batchRequest.Streamed {
+		if batchRequest.Status != models.BatchRequestStatusDone || batchRequest.IsBatchDeleted {
+			return c.Status(fiber.StatusNotFound).SendString("Batch file not found")
+		}
+		return streamBatchZip(c, batchRequestId)
+	}
+
+	extension := models.BatchFileExtension(batchRequest.OutputType, batchRequest.ArchiveFormat)
+	filePath := filepath.Join(config.Config.UploadsFolderAbsolutePath, batchRequest.Id+extension)
 
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return c.Status(fiber.StatusNotFound).SendString("Batch file not found")
 	}
 
 	logrus.Info("Streaming batch file of batch request: ", batchRequestId)
-	return c.Download(filePath, fmt.Sprintf("converted-documents-%s.zip", batchRequestId[len(batchRequestId)-5:]))
+	if err := c.Download(filePath, batchDownloadFileName(batchRequestId, extension)); err != nil {
+		return err
+	}
+
+	// Otherwise it's guessed from the last extension
+	c.Set(fiber.HeaderContentType, models.BatchFileContentType(batchRequest.OutputType, batchRequest.ArchiveFormat))
+	return nil
+}
+
+func batchDownloadFileName(batchRequestId string, extension string) string {
+	return fmt.Sprintf("converted-documents-%s%s", batchRequestId[len(batchRequestId)-5:], extension)
 }
 
 func (h *BatchRequestsHandler) GetBatchRequestsByIds(c *fiber.Ctx) error {
@@ -171,7 +318,8 @@ func (h *BatchRequestsHandler) GetBatchRequestsByIds(c *fiber.Ctx) error {
 
 	query, args, err := sqlx.Named(
 		`
-    SELECT id, status, created_at, batched_at, batched_file_count, error
+    SELECT id, status, output_type, naming_template, streamed, archive_format, priority, needed_by, not_before, created_at, batched_at, batched_file_count,
+      error, convert_requests, manifest
     FROM batch_request WHERE id IN (:ids)
   `,
 		map[string]interface{}{
@@ -196,6 +344,15 @@ func (h *BatchRequestsHandler) GetBatchRequestsByIds(c *fiber.Ctx) error {
 		if h.TaskPool.IsOccupied(batchRequests[i].Id.String()) {
 			batchRequests[i].Status = models.BatchRequestStatusBatching
 		}
+
+		// Not processed yet, so the breakdown reflects the progress of the convert requests
+		if batchRequests[i].Members == nil {
+			manifest, err := background.BuildBatchRequestManifest(batchRequests[i].ConvertRequests, false)
+			if err != nil {
+				return err
+			}
+			batchRequests[i].Members = manifest
+		}
 	}
 
 	return c.JSON(batchRequests)
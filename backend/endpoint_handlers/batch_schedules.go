@@ -0,0 +1,180 @@
+package endpoint_handlers
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid/v5"
+	"github.com/karpov-kir/word-to-pdf/backend/auth"
+	"github.com/karpov-kir/word-to-pdf/backend/cron"
+	"github.com/karpov-kir/word-to-pdf/backend/database"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/karpov-kir/word-to-pdf/backend/naming"
+	"github.com/sirupsen/logrus"
+)
+
+const maxBatchSchedulesPerUser = 20
+
+const batchScheduleColumns = `
+  id, cron_expression, tag, output_type, naming_template, archive_format, priority, next_run_at, last_run_at, last_batch_request_id,
+  created_at
+`
+
+// Batches the latest convert requests of the user with the tag on every run of the cron expression,
+// see background.StartRunningBatchSchedules
+func CreateBatchSchedule(c *fiber.Ctx) error {
+	userId := c.Locals(auth.UserIdLocal).(string)
+
+	var request struct {
+		CronExpression  string                        `json:"cronExpression"`
+		Tag             string                        `json:"tag"`
+		OutputType      models.BatchRequestOutputType `json:"outputType"`
+		NamingTemplate  string                        `json:"namingTemplate"`
+		ArchiveFormat   string                        `json:"archiveFormat"`
+		ArchivePassword string                        `json:"archivePassword"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to parse request body",
+		})
+	}
+
+	schedule, err := cron.Parse(request.CronExpression)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid cron expression: %v", err),
+		})
+	}
+
+	if err := validateTag(request.Tag); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid tag: %v", err),
+		})
+	}
+
+	if request.OutputType == "" {
+		request.OutputType = models.BatchRequestOutputTypeZip
+	} else if request.OutputType != models.BatchRequestOutputTypeZip && request.OutputType != models.BatchRequestOutputTypePdf {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Unsupported output type: %s", request.OutputType),
+		})
+	}
+
+	// Scheduled batches are never streamed, nobody waits for them
+	archiveOptions, err := parseArchiveOptions(request.OutputType, request.ArchiveFormat, request.ArchivePassword, false)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid archive options: %v", err),
+		})
+	}
+
+	namingTemplate, err := naming.ParseTemplate(request.NamingTemplate)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid naming template: %v", err),
+		})
+	}
+
+	var scheduleCount int
+	if err := database.Connection.Get(&scheduleCount, "SELECT COUNT(*) FROM batch_schedules WHERE user_id = $1", userId); err != nil {
+		return fmt.Errorf("failed to count batch schedules: %w", err)
+	}
+	if scheduleCount >= maxBatchSchedulesPerUser {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("At most %d batch schedules are allowed", maxBatchSchedulesPerUser),
+		})
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return fmt.Errorf("failed to generate UUID: %w", err)
+	}
+
+	// Runs are compared with the clock of the DB, see background.runDueBatchSchedules
+	now, err := database.Now()
+	if err != nil {
+		return err
+	}
+
+	rows, err := database.Connection.NamedQuery(
+		`
+      INSERT INTO batch_schedules (
+        id, user_id, cron_expression, tag, output_type, naming_template, archive_format, archive_password, priority, next_run_at, created_at
+      )
+      VALUES (
+        :id, :user_id, :cron_expression, :tag, :output_type, :naming_template, :archive_format, :archive_password, :priority, :next_run_at, :created_at
+      )
+      RETURNING `+batchScheduleColumns,
+		map[string]interface{}{
+			"id":               id,
+			"user_id":          userId,
+			"cron_expression":  request.CronExpression,
+			"tag":              request.Tag,
+			"output_type":      request.OutputType,
+			"naming_template":  string(namingTemplate),
+			"archive_format":   archiveOptions.Format,
+			"archive_password": archiveOptions.SealedPassword,
+			"priority":         auth.Priority(c),
+			"next_run_at":      schedule.Next(now),
+			"created_at":       now,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert batch schedule into DB: %w", err)
+	}
+	defer rows.Close()
+
+	var batchSchedule models.BatchSchedule
+	if rows.Next() {
+		if err := rows.StructScan(&batchSchedule); err != nil {
+			return fmt.Errorf("failed to scan batch schedule: %w", err)
+		}
+	}
+
+	logrus.Infof("Batch schedule %s (%s) of tag %s created for user %s", batchSchedule.Id, request.CronExpression, request.Tag, userId)
+
+	return c.JSON(batchSchedule)
+}
+
+func GetBatchSchedules(c *fiber.Ctx) error {
+	userId := c.Locals(auth.UserIdLocal).(string)
+
+	batchSchedules := []models.BatchSchedule{}
+	if err := database.Connection.Select(
+		&batchSchedules,
+		"SELECT "+batchScheduleColumns+" FROM batch_schedules WHERE user_id = $1 ORDER BY created_at",
+		userId,
+	); err != nil {
+		return fmt.Errorf("failed to fetch batch schedules: %w", err)
+	}
+
+	return c.JSON(batchSchedules)
+}
+
+// Batch requests created by the schedule are kept
+func DeleteBatchSchedule(c *fiber.Ctx) error {
+	userId := c.Locals(auth.UserIdLocal).(string)
+
+	batchScheduleId, err := uuid.FromString(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid batch schedule ID",
+		})
+	}
+
+	result, err := database.Connection.Exec("DELETE FROM batch_schedules WHERE id = $1 AND user_id = $2", batchScheduleId, userId)
+	if err != nil {
+		return fmt.Errorf("failed to delete batch schedule: %w", err)
+	}
+
+	if deletedCount, _ := result.RowsAffected(); deletedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Batch schedule not found",
+		})
+	}
+
+	logrus.Infof("Batch schedule %s of user %s deleted", batchScheduleId, userId)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
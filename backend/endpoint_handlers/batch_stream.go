@@ -0,0 +1,116 @@
+package endpoint_handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/karpov-kir/word-to-pdf/backend/background"
+	"github.com/karpov-kir/word-to-pdf/backend/naming"
+	"github.com/sirupsen/logrus"
+)
+
+var errUnsatisfiableRange = errors.New("unsatisfiable range")
+
+// The zip is the same on every download, so a single byte range is supported to resume interrupted downloads
+func streamBatchZip(c *fiber.Ctx, batchRequestId string) error {
+	streamedZip, err := background.OpenStreamedBatchZip(batchRequestId)
+	if err != nil {
+		return err
+	}
+
+	if err := streamedZip.Validate(); err != nil {
+		logrus.Warnf("Can't stream batch request %s: %v", batchRequestId, err)
+		return c.Status(fiber.StatusNotFound).SendString("Batch file not found")
+	}
+
+	size := streamedZip.Size()
+	etag := fmt.Sprintf(`"%s-%d"`, batchRequestId, size)
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, naming.ContentDisposition(batchDownloadFileName(batchRequestId, ".zip")))
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	c.Set(fiber.HeaderETag, etag)
+
+	offset, length := int64(0), size
+	rangeHeader := c.Get(fiber.HeaderRange)
+	ifRange := c.Get(fiber.HeaderIfRange)
+
+	if rangeHeader != "" && (ifRange == "" || ifRange == etag) {
+		offset, length, err = parseByteRange(rangeHeader, size)
+		if errors.Is(err, errUnsatisfiableRange) {
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+			return c.SendStatus(fiber.StatusRequestedRangeNotSatisfiable)
+		}
+		if err != nil {
+			// Ranges that can't be parsed are ignored as per RFC 9110
+			offset, length = 0, size
+		} else {
+			c.Status(fiber.StatusPartialContent)
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size))
+		}
+	}
+
+	logrus.Infof("Streaming batch zip of batch request %s, bytes %d-%d of %d", batchRequestId, offset, offset+length, size)
+
+	// The response is closed by fasthttp when the client goes away, which stops the writer too
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		err := streamedZip.WriteRange(pipeWriter, offset, length)
+		if err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			logrus.Errorf("Failed to stream batch zip of batch request %s: %v", batchRequestId, err)
+		}
+		pipeWriter.CloseWithError(err)
+	}()
+
+	c.Context().SetBodyStream(pipeReader, int(length))
+	return nil
+}
+
+// Only a single range is supported, which is what download managers use to resume
+func parseByteRange(rangeHeader string, size int64) (int64, int64, error) {
+	value, ok := strings.CutPrefix(rangeHeader, "bytes=")
+	if !ok || strings.Contains(value, ",") {
+		return 0, 0, fmt.Errorf("unsupported range: %s", rangeHeader)
+	}
+
+	startValue, endValue, ok := strings.Cut(strings.TrimSpace(value), "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid range: %s", rangeHeader)
+	}
+
+	// Suffix range, e.g. "bytes=-500" for the last 500 bytes
+	if startValue == "" {
+		suffixLength, err := strconv.ParseInt(endValue, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid range: %s", rangeHeader)
+		}
+		if suffixLength <= 0 {
+			return 0, 0, errUnsatisfiableRange
+		}
+		suffixLength = min(suffixLength, size)
+		return size - suffixLength, suffixLength, nil
+	}
+
+	start, err := strconv.ParseInt(startValue, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, fmt.Errorf("invalid range: %s", rangeHeader)
+	}
+	if start >= size {
+		return 0, 0, errUnsatisfiableRange
+	}
+
+	end := size - 1
+	if endValue != "" {
+		end, err = strconv.ParseInt(endValue, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, fmt.Errorf("invalid range: %s", rangeHeader)
+		}
+		end = min(end, size-1)
+	}
+
+	return start, end - start + 1, nil
+}
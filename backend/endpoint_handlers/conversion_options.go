@@ -0,0 +1,78 @@
+package endpoint_handlers
+
+import (
+	"fmt"
+	"mime/multipart"
+	"regexp"
+	"strings"
+
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+)
+
+const maxTemplateLength = 64 * 1024
+
+var sizeRegexp = regexp.MustCompile(`^\d+(\.\d+)?(pt|px|in|mm|cm|pc)?$`)
+
+var paperSizes = map[string][2]string{
+	"a3":     {"11.7", "16.54"},
+	"a4":     {"8.27", "11.7"},
+	"a5":     {"5.83", "8.27"},
+	"letter": {"8.5", "11"},
+	"legal":  {"8.5", "14"},
+}
+
+func parseConversionOptions(form *multipart.Form) (models.ConversionOptions, error) {
+	value := func(name string) string {
+		if values := form.Value[name]; len(values) > 0 {
+			return strings.TrimSpace(values[0])
+		}
+		return ""
+	}
+
+	options := models.ConversionOptions{
+		PaperWidth:   value("paperWidth"),
+		PaperHeight:  value("paperHeight"),
+		MarginTop:    value("marginTop"),
+		MarginBottom: value("marginBottom"),
+		MarginLeft:   value("marginLeft"),
+		MarginRight:  value("marginRight"),
+		Landscape:    value("landscape") == "true",
+		HeaderHtml:   value("headerHtml"),
+		FooterHtml:   value("footerHtml"),
+		ImageFit:     value("imageFit"),
+
+		AppendAttachments: value("appendAttachments") == "true",
+	}
+
+	if paperSize := strings.ToLower(value("paperSize")); paperSize != "" {
+		dimensions, ok := paperSizes[paperSize]
+		if !ok {
+			return options, fmt.Errorf("unsupported paper size: %s", paperSize)
+		}
+		options.PaperWidth, options.PaperHeight = dimensions[0], dimensions[1]
+	}
+
+	sizes := map[string]string{
+		"paperWidth":   options.PaperWidth,
+		"paperHeight":  options.PaperHeight,
+		"marginTop":    options.MarginTop,
+		"marginBottom": options.MarginBottom,
+		"marginLeft":   options.MarginLeft,
+		"marginRight":  options.MarginRight,
+	}
+	for name, size := range sizes {
+		if size != "" && !sizeRegexp.MatchString(size) {
+			return options, fmt.Errorf("invalid %s: %s", name, size)
+		}
+	}
+
+	if options.ImageFit != "" && options.ImageFit != "fit" && options.ImageFit != "fill" && options.ImageFit != "original" {
+		return options, fmt.Errorf("unsupported image fit: %s", options.ImageFit)
+	}
+
+	if len(options.HeaderHtml) > maxTemplateLength || len(options.FooterHtml) > maxTemplateLength {
+		return options, fmt.Errorf("header and footer templates must not exceed %d bytes", maxTemplateLength)
+	}
+
+	return options, nil
+}
@@ -0,0 +1,110 @@
+package endpoint_handlers
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/karpov-kir/word-to-pdf/backend/background"
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/converters"
+	"github.com/karpov-kir/word-to-pdf/backend/database"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/karpov-kir/word-to-pdf/backend/naming"
+	"github.com/sirupsen/logrus"
+)
+
+// Converts small files inline and responds with the PDF. The convert request is created as usual, so when
+// it's delayed with notBefore, the convert processor is paused, the file is too large, there are no free slots
+// or the conversion takes longer than SYNC_CONVERT_TIMEOUT, 202 is returned with the convert request and
+// it's finished in the background.
+func (h *ConvertRequestsHandler) Convert(c *fiber.Ctx) error {
+	namingTemplate, err := naming.ParseTemplate(c.Query("namingTemplate"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Invalid naming template: %v", err))
+	}
+
+	convertRequest, err := createConvertRequestFromForm(c)
+	if err != nil {
+		return err
+	}
+	convertRequestId := convertRequest.Id.String()
+
+	// Restored from the conversion cache
+	if convertRequest.Status == models.ConvertRequestStatusDone {
+		return sendConvertedFile(c, convertRequest, namingTemplate)
+	}
+
+	if convertRequest.NotBefore != nil && convertRequest.NotBefore.After(time.Now()) {
+		logrus.Infof("Convert request %s is scheduled for %s, converting in the background", convertRequestId, convertRequest.NotBefore)
+		return c.Status(fiber.StatusAccepted).JSON(convertRequest)
+	}
+
+	if background.IsProcessorPaused(background.ConvertProcessor) {
+		logrus.Infof("Convert processor is paused, convert request %s is converted in the background", convertRequestId)
+		return c.Status(fiber.StatusAccepted).JSON(convertRequest)
+	}
+
+	if convertRequest.FileSize > config.Config.SyncConvertMaxFileSize {
+		logrus.Infof("File of convert request %s is too large to convert synchronously, converting in the background", convertRequestId)
+		return c.Status(fiber.StatusAccepted).JSON(convertRequest)
+	}
+
+	if !converters.IsAvailable(convertRequest.MimeType) {
+		logrus.Infof("Conversion engine of convert request %s is unavailable, converting in the background", convertRequestId)
+		return c.Status(fiber.StatusAccepted).JSON(convertRequest)
+	}
+
+	// The buffered channel lets the task finish after the budget is exceeded and nobody waits for it anymore
+	convertError := make(chan error, 1)
+	if !h.TaskPool.AddWeightedTask(func(ctx context.Context) {
+		convertError <- background.ProcessConvertRequest(ctx, convertRequestId)
+	}, convertRequestId, background.ConvertRequestWeight(convertRequest.FileSize)) {
+		logrus.Infof("No free slots to convert convert request %s synchronously, converting in the background", convertRequestId)
+		return c.Status(fiber.StatusAccepted).JSON(convertRequest)
+	}
+
+	select {
+	case <-convertError:
+	case <-time.After(config.Config.SyncConvertTimeout):
+		logrus.Infof("Convert request %s is not converted within %s, responding with the convert request", convertRequestId, config.Config.SyncConvertTimeout)
+		convertRequest.Status = models.ConvertRequestStatusConverting
+		return c.Status(fiber.StatusAccepted).JSON(convertRequest)
+	}
+
+	if err := database.Connection.Get(
+		&convertRequest,
+		`
+      SELECT id, file_name, file_size, mime_type, status, error, error_code, page_count, output_size, priority, needed_by, not_before, tags, converted_at,
+        created_at
+      FROM convert_requests WHERE id = $1
+    `,
+		convertRequestId,
+	); err != nil {
+		return fmt.Errorf("failed to fetch convert request: %w", err)
+	}
+
+	// The attempt failed, but a retry is scheduled
+	if convertRequest.Status == models.ConvertRequestStatusQueued {
+		logrus.Infof("Convert request %s is retried in the background, responding with the convert request", convertRequestId)
+		return c.Status(fiber.StatusAccepted).JSON(convertRequest)
+	}
+
+	if convertRequest.Status != models.ConvertRequestStatusDone {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(convertRequest)
+	}
+
+	return sendConvertedFile(c, convertRequest, namingTemplate)
+}
+
+func sendConvertedFile(c *fiber.Ctx, convertRequest models.ConvertRequest, namingTemplate naming.Template) error {
+	filePath := filepath.Join(config.Config.UploadsFolderAbsolutePath, fmt.Sprintf("%s_converted", convertRequest.Id))
+
+	fileName := naming.SingleFileName(namingTemplate, convertRequest.CreatedAt, convertRequest.FileName, ".pdf")
+	c.Set(fiber.HeaderContentDisposition, naming.ContentDisposition(fileName))
+
+	logrus.Info("Streaming file of convert request: ", convertRequest.Id)
+	return c.SendFile(filePath)
+}
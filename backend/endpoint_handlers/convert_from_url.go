@@ -0,0 +1,109 @@
+package endpoint_handlers
+
+import (
+	"fmt"
+	"mime/multipart"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofrs/uuid/v5"
+	"github.com/karpov-kir/word-to-pdf/backend/auth"
+	"github.com/karpov-kir/word-to-pdf/backend/converters"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/karpov-kir/word-to-pdf/backend/quota"
+	"github.com/karpov-kir/word-to-pdf/backend/remote"
+	"github.com/sirupsen/logrus"
+)
+
+// The file is not fetched here, the background worker does it before converting. The file type is detected
+// from `fileName` or the last segment of the URL path.
+func createConvertRequestFromUrl(c *fiber.Ctx, userId string, form *multipart.Form, sourceUrl string) (models.ConvertRequest, error) {
+	if err := remote.ValidateUrl(sourceUrl); err != nil {
+		return models.ConvertRequest{}, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid sourceUrl: %v", err))
+	}
+
+	if len(form.File["assets"]) > 0 {
+		return models.ConvertRequest{}, fiber.NewError(fiber.StatusBadRequest, "Assets are not supported with sourceUrl")
+	}
+
+	fileName := ""
+	if values := form.Value["fileName"]; len(values) > 0 {
+		fileName = strings.TrimSpace(values[0])
+	}
+	if fileName == "" {
+		fileName = fileNameFromUrl(sourceUrl)
+	}
+	if fileName == "" {
+		return models.ConvertRequest{}, fiber.NewError(fiber.StatusBadRequest, "Can't get file name from sourceUrl, pass fileName")
+	}
+	if len(fileName) > 250 {
+		return models.ConvertRequest{}, fiber.NewError(fiber.StatusBadRequest, "File name too long")
+	}
+
+	mimeType := converters.DetectMimeType(fileName)
+	if mimeType == converters.MimeTypeUnknown {
+		return models.ConvertRequest{}, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Unsupported file type: %s", fileName))
+	}
+
+	conversionOptions, err := parseConversionOptions(form)
+	if err != nil {
+		return models.ConvertRequest{}, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid conversion options: %v", err))
+	}
+
+	schedulingOptions, err := parseSchedulingOptions(c)
+	if err != nil {
+		return models.ConvertRequest{}, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return models.ConvertRequest{}, fmt.Errorf("failed to generate UUID: %w", err)
+	}
+
+	// The size is not known yet, the bytes are counted when the file is fetched
+	tx, err := beginWithQuota(userId, quota.Usage{Conversions: 1})
+	if err != nil {
+		return models.ConvertRequest{}, err
+	}
+	defer tx.Rollback()
+
+	convertRequest, err := insertConvertRequest(tx, newConvertRequest{
+		Id:                id,
+		UserId:            userId,
+		FileName:          fileName,
+		MimeType:          mimeType,
+		ConversionOptions: conversionOptions,
+		SourceUrl:         &sourceUrl,
+		Priority:          auth.Priority(c),
+		NeededBy:          schedulingOptions.NeededBy,
+		NotBefore:         schedulingOptions.NotBefore,
+		Tags:              schedulingOptions.Tags,
+	})
+	if err != nil {
+		return models.ConvertRequest{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.ConvertRequest{}, fmt.Errorf("failed to commit convert request: %w", err)
+	}
+
+	logrus.Infof("Convert request %s from URL created successfully", convertRequest.Id)
+
+	return convertRequest, nil
+}
+
+func fileNameFromUrl(sourceUrl string) string {
+	parsedUrl, err := url.Parse(sourceUrl)
+	if err != nil {
+		return ""
+	}
+
+	fileName := path.Base(parsedUrl.Path)
+	if fileName == "." || fileName == "/" {
+		return ""
+	}
+
+	return fileName
+}
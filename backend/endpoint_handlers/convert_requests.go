@@ -1,18 +1,29 @@
 package endpoint_handlers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofrs/uuid/v5"
 	"github.com/jmoiron/sqlx"
+	"github.com/karpov-kir/word-to-pdf/backend/auth"
+	"github.com/karpov-kir/word-to-pdf/backend/cache"
 	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/converters"
 	"github.com/karpov-kir/word-to-pdf/backend/database"
 	"github.com/karpov-kir/word-to-pdf/backend/models"
+	"github.com/karpov-kir/word-to-pdf/backend/naming"
+	"github.com/karpov-kir/word-to-pdf/backend/quota"
 	"github.com/karpov-kir/word-to-pdf/backend/utils"
+	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 )
 
@@ -41,7 +52,8 @@ func (h *ConvertRequestsHandler) GetConvertRequestsByIds(c *fiber.Ctx) error {
 
 	query, args, err := sqlx.Named(
 		`
-      SELECT id, file_name, file_size, status, error, converted_at, created_at
+      SELECT id, file_name, file_size, mime_type, status, error, error_code, page_count, output_size, priority, needed_by, not_before, tags, converted_at,
+        created_at
       FROM convert_requests WHERE id IN (:ids)
     `,
 		map[string]interface{}{
@@ -76,14 +88,16 @@ func (h *ConvertRequestsHandler) DownloadConvertedFile(c *fiber.Ctx) error {
 
 	logrus.Info("Downloading file from convert request: ", convertRequestId)
 
-	var convertRequest struct {
-		Id       string `db:"id"`
-		FileName string `db:"file_name"`
+	namingTemplate, err := naming.ParseTemplate(c.Query("namingTemplate"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Invalid naming template: %v", err))
 	}
 
+	var convertRequest models.ConvertRequest
+
 	query, args, err := sqlx.Named(
 		`
-    SELECT id, file_name
+    SELECT id, file_name, created_at
     FROM convert_requests WHERE id = :id
   `,
 		map[string]interface{}{
@@ -99,75 +113,229 @@ func (h *ConvertRequestsHandler) DownloadConvertedFile(c *fiber.Ctx) error {
 		return fmt.Errorf("failed to fetch convert request: %w", err)
 	}
 
-	filePath := filepath.Join(config.Config.UploadsFolderAbsolutePath, fmt.Sprintf("%s_converted", convertRequest.Id))
-
-	logrus.Info("Streaming file of convert request: ", convertRequestId)
-	return c.Download(filePath, convertRequest.FileName+".pdf")
+	return sendConvertedFile(c, convertRequest, namingTemplate)
 }
 
 func CreateConvertRequest(c *fiber.Ctx) error {
-	userId := c.Locals("userId").(string)
+	convertRequest, err := createConvertRequestFromForm(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(convertRequest)
+}
+
+// Invalid forms are reported as fiber errors with the bad request status
+func createConvertRequestFromForm(c *fiber.Ctx) (models.ConvertRequest, error) {
+	userId := c.Locals(auth.UserIdLocal).(string)
 
 	logrus.Infof("New request to convert a file from user %s", userId)
 
 	form, err := c.MultipartForm()
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Failed to parse form: %v", err))
+		return models.ConvertRequest{}, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Failed to parse form: %v", err))
 	}
 
 	files := form.File["file"]
+	sourceUrl := strings.TrimSpace(c.FormValue("sourceUrl"))
+	if sourceUrl != "" {
+		if len(files) > 0 {
+			return models.ConvertRequest{}, fiber.NewError(fiber.StatusBadRequest, "Either file or sourceUrl must be provided, not both")
+		}
+		return createConvertRequestFromUrl(c, userId, form, sourceUrl)
+	}
 	if len(files) == 0 {
-		return c.Status(fiber.StatusBadRequest).SendString("No file uploaded")
+		return models.ConvertRequest{}, fiber.NewError(fiber.StatusBadRequest, "No file uploaded")
 	}
 
 	file := files[0]
 	if len(file.Filename) > 250 {
-		return c.Status(fiber.StatusBadRequest).SendString("File name too long")
+		return models.ConvertRequest{}, fiber.NewError(fiber.StatusBadRequest, "File name too long")
 	} else if len(file.Filename) == 0 {
-		return c.Status(fiber.StatusBadRequest).SendString("Missing file name")
+		return models.ConvertRequest{}, fiber.NewError(fiber.StatusBadRequest, "Missing file name")
 	}
 
-	incomingFileReader, err := file.Open()
+	mimeType := converters.DetectMimeType(file.Filename)
+
+	conversionOptions, err := parseConversionOptions(form)
 	if err != nil {
-		return fmt.Errorf("failed to open file stream: %w", err)
+		return models.ConvertRequest{}, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid conversion options: %v", err))
 	}
-	defer incomingFileReader.Close()
 
-	id, err := uuid.NewV7()
+	schedulingOptions, err := parseSchedulingOptions(c)
 	if err != nil {
-		return fmt.Errorf("failed to generate UUID: %w", err)
+		return models.ConvertRequest{}, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	assetsFiles := form.File["assets"]
+	if len(assetsFiles) > 0 && mimeType != converters.MimeTypeHtml && mimeType != converters.MimeTypeMarkdown {
+		return models.ConvertRequest{}, fiber.NewError(fiber.StatusBadRequest, "Assets are supported only for HTML and Markdown files")
 	}
 
-	localFileWriter, err := os.Create(filepath.Join(config.Config.UploadsFolderAbsolutePath, id.String()))
+	id, err := uuid.NewV7()
 	if err != nil {
-		return fmt.Errorf("failed to create file on server: %w", err)
+		return models.ConvertRequest{}, fmt.Errorf("failed to generate UUID: %w", err)
 	}
-	defer localFileWriter.Close()
+
+	uploadedBytes := file.Size
+	if len(assetsFiles) > 0 {
+		uploadedBytes += assetsFiles[0].Size
+	}
+
+	// The files are saved before the quota is consumed, so that the transaction doesn't hold a connection and
+	// the usage counters of the user while the upload is written. They are removed when the convert request is not committed.
+	committed := false
+	defer func() {
+		if !committed {
+			removeConvertRequestFiles(id.String())
+		}
+	}()
 
 	logrus.Infof("Saving file %s to %s", file.Filename, id.String())
-	if _, err := io.Copy(localFileWriter, incomingFileReader); err != nil {
-		return fmt.Errorf("failed to save file: %w", err)
+	contentHash, err := saveUploadedFile(file, filepath.Join(config.Config.UploadsFolderAbsolutePath, id.String()))
+	if err != nil {
+		return models.ConvertRequest{}, err
 	}
 	logrus.Infof("File %s saved to %s", file.Filename, id.String())
 
+	assetsHash := ""
+	if len(assetsFiles) > 0 {
+		if assetsHash, err = saveUploadedFile(assetsFiles[0], filepath.Join(config.Config.UploadsFolderAbsolutePath, fmt.Sprintf("%s_assets", id.String()))); err != nil {
+			return models.ConvertRequest{}, err
+		}
+		conversionOptions.HasAssets = true
+	}
+
+	cacheKey, err := cache.Key(contentHash, assetsHash, mimeType, conversionOptions)
+	if err != nil {
+		return models.ConvertRequest{}, err
+	}
+
+	status := models.ConvertRequestStatusQueued
+	var output *converters.Output
+	if restoredOutput, restored := cache.Restore(cacheKey, converters.Job{ConvertRequestId: id.String()}); restored {
+		logrus.Infof("Converted file of convert request %s is restored from cache entry %s", id.String(), cacheKey)
+		status = models.ConvertRequestStatusDone
+		output = &restoredOutput
+	}
+
+	tx, err := beginWithQuota(userId, quota.Usage{Conversions: 1, UploadedBytes: uploadedBytes})
+	if err != nil {
+		return models.ConvertRequest{}, err
+	}
+	defer tx.Rollback()
+
+	convertRequest, err := insertConvertRequest(tx, newConvertRequest{
+		Id:                id,
+		UserId:            userId,
+		FileName:          file.Filename,
+		FileSize:          file.Size,
+		MimeType:          mimeType,
+		ConversionOptions: conversionOptions,
+		ContentHash:       &contentHash,
+		CacheKey:          &cacheKey,
+		Priority:          auth.Priority(c),
+		NeededBy:          schedulingOptions.NeededBy,
+		NotBefore:         schedulingOptions.NotBefore,
+		Tags:              schedulingOptions.Tags,
+		Status:            status,
+		Output:            output,
+	})
+	if err != nil {
+		return models.ConvertRequest{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.ConvertRequest{}, fmt.Errorf("failed to commit convert request: %w", err)
+	}
+	committed = true
+
+	logrus.Infof("Convert request %s created successfully", convertRequest.Id)
+
+	return convertRequest, nil
+}
+
+// Removes the uploaded files of a convert request that is not created, including the output restored from the cache
+func removeConvertRequestFiles(convertRequestId string) {
+	for _, suffix := range []string{"", "_assets", "_converted"} {
+		os.Remove(filepath.Join(config.Config.UploadsFolderAbsolutePath, convertRequestId+suffix))
+	}
+}
+
+type newConvertRequest struct {
+	Id                uuid.UUID
+	UserId            string
+	FileName          string
+	FileSize          int64
+	MimeType          string
+	ConversionOptions models.ConversionOptions
+	SourcePath        *string
+	SourceUrl         *string
+	ContentHash       *string
+	CacheKey          *string
+	Priority          models.Priority
+	NeededBy          *time.Time
+	NotBefore         *time.Time
+	Tags              []string
+	// Queued by default, done when the converted file is restored from the cache (the output is set then)
+	Status models.ConvertRequestStatus
+	Output *converters.Output
+}
+
+// The file of the convert request must be saved by the time it is inserted (unless it's fetched from the source URL),
+// it can be picked up right away
+func insertConvertRequest(db sqlx.Ext, request newConvertRequest) (models.ConvertRequest, error) {
+	if request.Status == "" {
+		request.Status = models.ConvertRequestStatusQueued
+	}
+
+	var convertedAt, pageCount, outputSize interface{}
+	if request.Status == models.ConvertRequestStatusDone {
+		convertedAt = "NOW()"
+	}
+	if request.Output != nil {
+		pageCount = request.Output.PageCount
+		outputSize = request.Output.Size
+	}
+
 	convertRequestPayload := map[string]interface{}{
-		"id":         id,
-		"file_name":  file.Filename,
-		"file_size":  file.Size,
-		"status":     models.ConvertRequestStatusQueued,
-		"user_id":    userId,
-		"created_at": "NOW()",
-	}
-	rows, err := database.Connection.NamedQuery(
+		"id":                 request.Id,
+		"file_name":          request.FileName,
+		"file_size":          request.FileSize,
+		"mime_type":          request.MimeType,
+		"conversion_options": request.ConversionOptions,
+		"source_path":        request.SourcePath,
+		"source_url":         request.SourceUrl,
+		"content_hash":       request.ContentHash,
+		"cache_key":          request.CacheKey,
+		"priority":           request.Priority,
+		"needed_by":          request.NeededBy,
+		"not_before":         request.NotBefore,
+		"tags":               pq.StringArray(request.Tags),
+		"status":             request.Status,
+		"user_id":            request.UserId,
+		"created_at":         "NOW()",
+		"converted_at":       convertedAt,
+		"page_count":         pageCount,
+		"output_size":        outputSize,
+	}
+	rows, err := sqlx.NamedQuery(
+		db,
 		`
-      INSERT INTO convert_requests (id, file_name, file_size, created_at, status, user_id)
-      VALUES (:id, :file_name, :file_size, :created_at, :status, :user_id)
-      RETURNING id, file_name, file_size, status, created_at
+      INSERT INTO convert_requests (
+        id, file_name, file_size, mime_type, conversion_options, source_path, source_url, content_hash, cache_key, created_at, status, user_id,
+        converted_at, page_count, output_size, priority, needed_by, not_before, tags
+      )
+      VALUES (
+        :id, :file_name, :file_size, :mime_type, :conversion_options, :source_path, :source_url, :content_hash, :cache_key, :created_at, :status, :user_id,
+        :converted_at, :page_count, :output_size, :priority, :needed_by, :not_before, :tags
+      )
+      RETURNING id, file_name, file_size, mime_type, status, converted_at, page_count, output_size, priority, needed_by, not_before, tags, created_at
     `,
 		convertRequestPayload,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to insert convert request into DB: %w", err)
+		return models.ConvertRequest{}, fmt.Errorf("failed to insert convert request into DB: %w", err)
 	}
 	defer rows.Close()
 
@@ -178,12 +346,40 @@ func CreateConvertRequest(c *fiber.Ctx) error {
 			&convertRequest.Id,
 			&convertRequest.FileName,
 			&convertRequest.FileSize,
+			&convertRequest.MimeType,
 			&convertRequest.Status,
+			&convertRequest.ConvertedAt,
+			&convertRequest.PageCount,
+			&convertRequest.OutputSize,
+			&convertRequest.Priority,
+			&convertRequest.NeededBy,
+			&convertRequest.NotBefore,
+			&convertRequest.Tags,
 			&convertRequest.CreatedAt,
 		)
 	}
 
-	logrus.Infof("Convert request %s created successfully", convertRequest.Id)
+	return convertRequest, nil
+}
 
-	return c.JSON(convertRequest)
+// Returns the SHA-256 of the content, which is used to find conversions of the same file
+func saveUploadedFile(file *multipart.FileHeader, filePath string) (string, error) {
+	incomingFileReader, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open file stream: %w", err)
+	}
+	defer incomingFileReader.Close()
+
+	localFileWriter, err := os.Create(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create file on server: %w", err)
+	}
+	defer localFileWriter.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(localFileWriter, hash), incomingFileReader); err != nil {
+		return "", fmt.Errorf("failed to save file: %w", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }
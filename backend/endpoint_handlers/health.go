@@ -0,0 +1,26 @@
+package endpoint_handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/karpov-kir/word-to-pdf/backend/converters"
+)
+
+type healthResponse struct {
+	// "degraded" while any conversion service is unavailable, the API itself keeps accepting requests
+	Status   string                     `json:"status"`
+	Services []converters.ServiceStatus `json:"services"`
+}
+
+func Health(c *fiber.Ctx) error {
+	response := healthResponse{Status: "ok", Services: []converters.ServiceStatus{}}
+
+	for _, service := range converters.Services() {
+		status := service.Status()
+		if !status.Available {
+			response.Status = "degraded"
+		}
+		response.Services = append(response.Services, status)
+	}
+
+	return c.JSON(response)
+}
@@ -0,0 +1,65 @@
+package endpoint_handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/karpov-kir/word-to-pdf/backend/auth"
+	"github.com/karpov-kir/word-to-pdf/backend/database"
+	"github.com/karpov-kir/word-to-pdf/backend/quota"
+	"github.com/sirupsen/logrus"
+)
+
+// Begins the transaction of the requests that use the usage, see quota.Consume. The usage is counted when
+// the transaction is committed.
+func beginWithQuota(userId string, usage quota.Usage) (*sqlx.Tx, error) {
+	tx, err := database.Connection.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := quota.Consume(tx, userId, usage); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+func GetUsage(c *fiber.Ctx) error {
+	userId := c.Locals(auth.UserIdLocal).(string)
+
+	report, err := quota.ReportOf(userId)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(report)
+}
+
+// Quota errors get the error format of the extension (ServerErrorDto), other errors are handled by fiber
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var exceededError *quota.ExceededError
+	if !errors.As(err, &exceededError) {
+		return fiber.DefaultErrorHandler(c, err)
+	}
+
+	logrus.Infof("Quota of user %v exceeded: %v", c.Locals(auth.UserIdLocal), exceededError)
+
+	response := fiber.Map{
+		"message": fmt.Sprintf("The %s quota of %d is exceeded", exceededError.Quota, exceededError.Limit),
+		"type":    "quotaExceededError",
+		"reason":  exceededError.Quota,
+	}
+	if exceededError.ResetsAt != nil {
+		response["resetsAt"] = exceededError.ResetsAt.Unix() * 1000
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(max(1, int(math.Ceil(time.Until(*exceededError.ResetsAt).Seconds())))))
+	}
+
+	return c.Status(fiber.StatusTooManyRequests).JSON(response)
+}
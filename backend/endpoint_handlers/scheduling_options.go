@@ -0,0 +1,112 @@
+package endpoint_handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+)
+
+// Streamed batches are built on every download, there is nothing to delay
+var errStreamedBatchNotBefore = errors.New("notBefore is not supported for streamed batches")
+
+const (
+	maxTags      = 10
+	maxTagLength = 50
+)
+
+// Timestamps are passed as Unix timestamps in milliseconds, like the dates in responses. Empty means not set.
+func parseTimestamp(name string, value string) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	milliseconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a Unix timestamp in milliseconds: %s", name, value)
+	}
+
+	return timestampFromUnixMilli(name, &milliseconds)
+}
+
+func timestampFromUnixMilli(name string, milliseconds *int64) (*time.Time, error) {
+	if milliseconds == nil {
+		return nil, nil
+	}
+	if *milliseconds <= 0 {
+		return nil, fmt.Errorf("%s must be positive: %d", name, *milliseconds)
+	}
+
+	timestamp := time.UnixMilli(*milliseconds).UTC()
+	return &timestamp, nil
+}
+
+// Past times are allowed (the request is due right away), too distant ones are not, files are not kept for that long
+func validateNotBefore(notBefore *time.Time) error {
+	if notBefore != nil && time.Until(*notBefore) > config.Config.MaxScheduleDelay {
+		return fmt.Errorf("notBefore must be within %s", config.Config.MaxScheduleDelay)
+	}
+	return nil
+}
+
+// Comma separated, e.g. "reports,weekly"
+func parseTags(value string) ([]string, error) {
+	tags := []string{}
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag == "" {
+			continue
+		}
+		if err := validateTag(tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("at most %d tags are allowed", maxTags)
+	}
+
+	return tags, nil
+}
+
+func validateTag(tag string) error {
+	if tag == "" {
+		return fmt.Errorf("tag is empty")
+	}
+	if len(tag) > maxTagLength {
+		return fmt.Errorf("tag is too long, max %d characters: %s", maxTagLength, tag)
+	}
+	return nil
+}
+
+type schedulingOptions struct {
+	NeededBy  *time.Time
+	NotBefore *time.Time
+	Tags      []string
+}
+
+// Form fields "neededBy", "notBefore" and "tags" of uploads
+func parseSchedulingOptions(c *fiber.Ctx) (schedulingOptions, error) {
+	var options schedulingOptions
+	var err error
+
+	if options.NeededBy, err = parseTimestamp("neededBy", c.FormValue("neededBy")); err != nil {
+		return options, err
+	}
+	if options.NotBefore, err = parseTimestamp("notBefore", c.FormValue("notBefore")); err != nil {
+		return options, err
+	}
+	if err := validateNotBefore(options.NotBefore); err != nil {
+		return options, err
+	}
+	if options.Tags, err = parseTags(c.FormValue("tags")); err != nil {
+		return options, err
+	}
+
+	return options, nil
+}
@@ -11,6 +11,8 @@ require (
 	github.com/lib/pq v1.10.9
 	github.com/sirupsen/logrus v1.9.3
 	github.com/testcontainers/testcontainers-go v0.35.0
+	github.com/yuin/goldmark v1.7.8
+	golang.org/x/image v0.23.0
 )
 
 require (
@@ -7,17 +7,22 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/expvar"
 	"github.com/karpov-kir/word-to-pdf/backend/auth"
 	"github.com/karpov-kir/word-to-pdf/backend/background"
 	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/converters"
 	"github.com/karpov-kir/word-to-pdf/backend/database"
 	eh "github.com/karpov-kir/word-to-pdf/backend/endpoint_handlers"
+	"github.com/karpov-kir/word-to-pdf/backend/ratelimit"
 	"github.com/karpov-kir/word-to-pdf/backend/utils"
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
 	config.Init()
+	converters.Init()
+	ratelimit.Init()
 	ctx := context.Background()
 
 	if err := database.InitDb(); err != nil {
@@ -26,23 +31,38 @@ func main() {
 	}
 	defer database.CloseDb()
 
-	convertRequestsTaskPool := utils.NewTaskPool(ctx, config.Config.ParallelConvertLimit)
+	convertRequestsTaskPool := utils.NewTaskPool(ctx, config.Config.ConvertConcurrencyMax)
+	convertRequestsTaskPool.SetLimit(converters.Limiter.Limit())
+	converters.Limiter.OnChange(convertRequestsTaskPool.SetLimit)
+	convertRequestsTaskPool.SetWeightBudget(config.Config.ConvertWeightBudget, config.Config.ConvertWeightStarvationTimeout)
 	convertRequestsTaskPool.Start()
 	defer convertRequestsTaskPool.Stop()
 
+	go background.StartSyncingPausedProcessors()
 	go background.ProcessQueuedConvertRequests(convertRequestsTaskPool)
 	go background.StartDeletingOldConvertRequestFiles()
+	go background.StartDeletingExpiredConversionCacheEntries()
+	go background.StartProbingConversionEngines(ctx)
+	go background.StartMeasuringConvertQueueDepth()
+	go background.StartDeletingExpiredRateLimitCounters()
+	go background.StartDeletingOldUsageCounters()
 
 	batchRequestsTaskPool := utils.NewTaskPool(ctx, config.Config.ParallelBatchLimit)
 	batchRequestsTaskPool.Start()
 	defer batchRequestsTaskPool.Stop()
 	go background.StartDeletingOldBatchRequestFiles()
 	go background.ProcessBatchRequests(batchRequestsTaskPool)
+	go background.StartRunningBatchSchedules()
 
 	app := fiber.New(
 		fiber.Config{
 			// Controlled by the frontend server
 			BodyLimit: math.MaxInt,
+			// For the per-IP rate limits
+			ProxyHeader:             config.Config.ProxyHeader,
+			EnableTrustedProxyCheck: true,
+			TrustedProxies:          config.Config.TrustedProxies,
+			ErrorHandler:            eh.ErrorHandler,
 		},
 	)
 
@@ -52,18 +72,47 @@ func main() {
 	batchRequestsHandler := &eh.BatchRequestsHandler{TaskPool: batchRequestsTaskPool}
 
 	app.Get("/", eh.LifeCheck)
-	app.Post("/auth/token", eh.CreateToken)
+	app.Get("/health", eh.Health)
+	// Metrics and runtime details are for operators only
+	app.Use("/debug/vars", auth.JWTMiddleware(), auth.AdminMiddleware(), expvar.New())
+	app.Post("/auth/token", ratelimit.Middleware("tokens", config.Config.TokensRateLimit), eh.CreateToken)
 
 	app.Get("/download/pdf/:id", convertRequestsHandler.DownloadConvertedFile)
 	app.Get("/download/pdf-batch/:id", batchRequestsHandler.DownloadBatchFile)
 
 	app.Use(auth.JWTMiddleware())
-	app.Post("/convert-requests/create", eh.CreateConvertRequest)
+
+	uploadsRateLimit := ratelimit.Middleware("uploads", config.Config.UploadsRateLimit)
+	batchesRateLimit := ratelimit.Middleware("batches", config.Config.BatchesRateLimit)
+	backpressure := ratelimit.Backpressure()
+
+	app.Post("/convert", uploadsRateLimit, backpressure, convertRequestsHandler.Convert)
+	app.Post("/convert-requests/create", uploadsRateLimit, backpressure, eh.CreateConvertRequest)
 	app.Post("/convert-requests/by-ids", convertRequestsHandler.GetConvertRequestsByIds)
 
-	app.Post("/batch-requests/create", batchRequestsHandler.CreateBatchRequest)
+	app.Post("/batch-requests/create", batchesRateLimit, batchRequestsHandler.CreateBatchRequest)
+	app.Post("/batch-requests/from-archive", uploadsRateLimit, batchesRateLimit, backpressure, batchRequestsHandler.CreateBatchRequestFromArchive)
 	app.Post("/batch-requests/by-ids", batchRequestsHandler.GetBatchRequestsByIds)
 
+	app.Get("/me/usage", eh.GetUsage)
+
+	app.Post("/batch-schedules/create", batchesRateLimit, eh.CreateBatchSchedule)
+	app.Get("/batch-schedules", eh.GetBatchSchedules)
+	app.Delete("/batch-schedules/:id", eh.DeleteBatchSchedule)
+
+	adminHandler := &eh.AdminHandler{ConvertTaskPool: convertRequestsTaskPool, BatchTaskPool: batchRequestsTaskPool}
+	admin := app.Group("/admin", auth.AdminMiddleware())
+
+	admin.Get("/queue", adminHandler.GetQueue)
+	admin.Post("/convert-requests/requeue", adminHandler.RequeueConvertRequests)
+	admin.Post("/convert-requests/cancel", adminHandler.CancelConvertRequests)
+	admin.Post("/convert-requests/purge", adminHandler.PurgeConvertRequests)
+	admin.Post("/batch-requests/requeue", adminHandler.RequeueBatchRequests)
+	admin.Post("/batch-requests/cancel", adminHandler.CancelBatchRequests)
+	admin.Post("/batch-requests/purge", adminHandler.PurgeBatchRequests)
+	admin.Post("/processors/:name/pause", adminHandler.PauseProcessor)
+	admin.Post("/processors/:name/resume", adminHandler.ResumeProcessor)
+
 	logrus.Fatal(app.Listen(":3030"))
 }
 
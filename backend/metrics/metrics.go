@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"expvar"
+
+	"github.com/karpov-kir/word-to-pdf/backend/converters"
+)
+
+// Counters are published with expvar, they are served on /debug/vars along with the runtime memory stats
+var (
+	ConversionCacheHits   = expvar.NewInt("conversion_cache_hits")
+	ConversionCacheMisses = expvar.NewInt("conversion_cache_misses")
+
+	// Requests rejected with 429, see the ratelimit package
+	RateLimitedRequests   = expvar.NewInt("rate_limited_requests")
+	BackpressuredRequests = expvar.NewInt("backpressured_requests")
+	// Convert requests that are due and wait for a slot, measured every POLL_QUEUED_CONVERT_REQUESTS_INTERVAL
+	ConvertQueueDepth = expvar.NewInt("convert_queue_depth")
+)
+
+func init() {
+	// Requests, failures and latencies per endpoint, the same as on /health
+	expvar.Publish("conversion_services", expvar.Func(func() any {
+		statuses := []converters.ServiceStatus{}
+		for _, service := range converters.Services() {
+			statuses = append(statuses, service.Status())
+		}
+		return statuses
+	}))
+
+	// The current limit of conversions running at the same time, see converters.ConcurrencyLimiter
+	expvar.Publish("convert_concurrency", expvar.Func(func() any {
+		if converters.Limiter == nil {
+			return nil
+		}
+		return converters.Limiter.Status()
+	}))
+}
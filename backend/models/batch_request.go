@@ -1,7 +1,9 @@
 package models
 
 import (
+	"database/sql/driver"
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/gofrs/uuid/v5"
@@ -10,19 +12,129 @@ import (
 type BatchRequestStatus string
 
 const (
-	BatchRequestStatusQueued   BatchRequestStatus = "queued"
-	BatchRequestStatusDone     BatchRequestStatus = "done"
-	BatchRequestStatusError    BatchRequestStatus = "error"
-	BatchRequestStatusBatching BatchRequestStatus = "batching"
+	// Until all convert requests of the batch are done, errored or cancelled (or the wait times out)
+	BatchRequestStatusWaiting   BatchRequestStatus = "waiting"
+	BatchRequestStatusQueued    BatchRequestStatus = "queued"
+	BatchRequestStatusDone      BatchRequestStatus = "done"
+	BatchRequestStatusError     BatchRequestStatus = "error"
+	BatchRequestStatusBatching  BatchRequestStatus = "batching"
+	BatchRequestStatusCancelled BatchRequestStatus = "cancelled"
 )
 
+type BatchRequestOutputType string
+
+const (
+	BatchRequestOutputTypeZip BatchRequestOutputType = "zip"
+	// All converted files merged into a single PDF in the order of the convert requests
+	BatchRequestOutputTypePdf BatchRequestOutputType = "pdf"
+)
+
+type BatchRequestArchiveFormat string
+
+const (
+	BatchRequestArchiveFormatZip   BatchRequestArchiveFormat = "zip"
+	BatchRequestArchiveFormatTarGz BatchRequestArchiveFormat = "tar.gz"
+	// AES-256 encrypted zip (WinZip AE-2), protected with a client provided password
+	BatchRequestArchiveFormatZipAes BatchRequestArchiveFormat = "zip-aes"
+)
+
+// Stored as JSON in batch_request.convert_requests
+type BatchRequestMember struct {
+	Id       uuid.UUID `db:"id" json:"id"`
+	FileName string    `db:"file_name" json:"file_name"`
+	// The path of the file in the uploaded archive, the output mirrors the structure of the archive
+	SourcePath *string `db:"source_path" json:"source_path,omitempty"`
+}
+
+type BatchRequestMembers []BatchRequestMember
+
+func (m BatchRequestMembers) Value() (driver.Value, error) {
+	return json.Marshal(m)
+}
+
+func (m *BatchRequestMembers) Scan(value interface{}) error {
+	return scanJSON(value, m)
+}
+
+// The outcome of every convert request of a batch, returned by the API and included in batch zips
+type BatchRequestManifestEntry struct {
+	ConvertRequestId uuid.UUID                `json:"convertRequestId"`
+	FileName         string                   `json:"fileName"`
+	EntryName        *string                  `json:"entryName,omitempty"`
+	Status           ConvertRequestStatus     `json:"status"`
+	Error            *string                  `json:"error,omitempty"`
+	ErrorCode        *ConvertRequestErrorCode `json:"errorCode,omitempty"`
+	PageCount        *int                     `json:"pageCount,omitempty"`
+	OutputSize       *int64                   `json:"outputSize,omitempty"`
+	Included         bool                     `json:"included"`
+	// Only for streamed batches, the zip is assembled on every download from the stored checksums
+	Crc32 *uint32 `json:"crc32,omitempty"`
+}
+
+type BatchRequestManifest []BatchRequestManifestEntry
+
+func (m BatchRequestManifest) Value() (driver.Value, error) {
+	return json.Marshal(m)
+}
+
+func (m *BatchRequestManifest) Scan(value interface{}) error {
+	return scanJSON(value, m)
+}
+
+func scanJSON(value interface{}, target interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("unexpected type of JSON value: %T", value)
+	}
+
+	return json.Unmarshal(bytes, target)
+}
+
+func BatchFileExtension(outputType BatchRequestOutputType, archiveFormat BatchRequestArchiveFormat) string {
+	if outputType == BatchRequestOutputTypePdf {
+		return ".pdf"
+	}
+	if archiveFormat == BatchRequestArchiveFormatTarGz {
+		return ".tar.gz"
+	}
+	return ".zip"
+}
+
+func BatchFileContentType(outputType BatchRequestOutputType, archiveFormat BatchRequestArchiveFormat) string {
+	if outputType == BatchRequestOutputTypePdf {
+		return "application/pdf"
+	}
+	if archiveFormat == BatchRequestArchiveFormatTarGz {
+		return "application/gzip"
+	}
+	return "application/zip"
+}
+
 type BatchRequest struct {
-	Id               uuid.UUID          `db:"id" json:"id"`
-	Status           BatchRequestStatus `db:"status" json:"status"`
-	BatchedAt        *time.Time         `db:"batched_at" json:"batchedAt,omitempty"`
-	CreatedAt        time.Time          `db:"created_at" json:"createdAt"`
-	Error            *string            `db:"error" json:"error,omitempty"`
-	BatchedFileCount *int               `db:"batched_file_count" json:"batchedFileCount"`
+	Id         uuid.UUID              `db:"id" json:"id"`
+	Status     BatchRequestStatus     `db:"status" json:"status"`
+	OutputType BatchRequestOutputType `db:"output_type" json:"outputType"`
+	// Only for zip output types
+	ArchiveFormat    BatchRequestArchiveFormat `db:"archive_format" json:"archiveFormat"`
+	BatchedAt        *time.Time                `db:"batched_at" json:"batchedAt,omitempty"`
+	CreatedAt        time.Time                 `db:"created_at" json:"createdAt"`
+	Error            *string                   `db:"error" json:"error,omitempty"`
+	BatchedFileCount *int                      `db:"batched_file_count" json:"batchedFileCount"`
+	// Names of the files inside zips, see naming.Template
+	NamingTemplate *string `db:"naming_template" json:"namingTemplate,omitempty"`
+	// Zip batches that are not written to disk, but built on the fly on every download
+	Streamed        bool                `db:"streamed" json:"streamed"`
+	ConvertRequests BatchRequestMembers `db:"convert_requests" json:"-"`
+	// Stored when the batch is processed, until then it is built from the current state of the convert requests
+	Members  BatchRequestManifest `db:"manifest" json:"members,omitempty"`
+	Priority Priority             `db:"priority" json:"priority"`
+	NeededBy *time.Time           `db:"needed_by" json:"neededBy,omitempty"`
+	// Not batched before, even when the convert requests are done
+	NotBefore *time.Time `db:"not_before" json:"notBefore,omitempty"`
 }
 
 func (bd BatchRequest) MarshalJSON() ([]byte, error) {
@@ -30,6 +142,8 @@ func (bd BatchRequest) MarshalJSON() ([]byte, error) {
 	return json.Marshal(&struct {
 		BatchedAt *int64 `json:"batchedAt,omitempty"`
 		CreatedAt int64  `json:"createdAt"`
+		NeededBy  *int64 `json:"neededBy,omitempty"`
+		NotBefore *int64 `json:"notBefore,omitempty"`
 		*Alias
 	}{
 		BatchedAt: func() *int64 {
@@ -40,6 +154,8 @@ func (bd BatchRequest) MarshalJSON() ([]byte, error) {
 			return nil
 		}(),
 		CreatedAt: bd.CreatedAt.Unix() * 1000,
+		NeededBy:  unixMilli(bd.NeededBy),
+		NotBefore: unixMilli(bd.NotBefore),
 		Alias:     (*Alias)(&bd),
 	})
 }
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// Creates a batch request over the latest convert requests of the user with the tag on every run of the cron expression
+type BatchSchedule struct {
+	Id uuid.UUID `db:"id" json:"id"`
+	// See cron.Parse
+	CronExpression     string                    `db:"cron_expression" json:"cronExpression"`
+	Tag                string                    `db:"tag" json:"tag"`
+	OutputType         BatchRequestOutputType    `db:"output_type" json:"outputType"`
+	NamingTemplate     *string                   `db:"naming_template" json:"namingTemplate,omitempty"`
+	ArchiveFormat      BatchRequestArchiveFormat `db:"archive_format" json:"archiveFormat"`
+	Priority           Priority                  `db:"priority" json:"priority"`
+	NextRunAt          time.Time                 `db:"next_run_at" json:"nextRunAt"`
+	LastRunAt          *time.Time                `db:"last_run_at" json:"lastRunAt,omitempty"`
+	LastBatchRequestId *uuid.UUID                `db:"last_batch_request_id" json:"lastBatchRequestId,omitempty"`
+	CreatedAt          time.Time                 `db:"created_at" json:"createdAt"`
+}
+
+func (bs BatchSchedule) MarshalJSON() ([]byte, error) {
+	type Alias BatchSchedule
+	return json.Marshal(&struct {
+		NextRunAt int64  `json:"nextRunAt"`
+		LastRunAt *int64 `json:"lastRunAt,omitempty"`
+		CreatedAt int64  `json:"createdAt"`
+		*Alias
+	}{
+		NextRunAt: bs.NextRunAt.Unix() * 1000,
+		LastRunAt: unixMilli(bs.LastRunAt),
+		CreatedAt: bs.CreatedAt.Unix() * 1000,
+		Alias:     (*Alias)(&bs),
+	})
+}
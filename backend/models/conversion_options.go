@@ -0,0 +1,33 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+)
+
+// Options are passed as is to the conversion engines, sizes are in the Gotenberg format (e.g. "8.27", "210mm", "1in").
+type ConversionOptions struct {
+	PaperWidth   string `json:"paperWidth,omitempty"`
+	PaperHeight  string `json:"paperHeight,omitempty"`
+	MarginTop    string `json:"marginTop,omitempty"`
+	MarginBottom string `json:"marginBottom,omitempty"`
+	MarginLeft   string `json:"marginLeft,omitempty"`
+	MarginRight  string `json:"marginRight,omitempty"`
+	Landscape    bool   `json:"landscape,omitempty"`
+	HeaderHtml   string `json:"headerHtml,omitempty"`
+	FooterHtml   string `json:"footerHtml,omitempty"`
+	HasAssets    bool   `json:"hasAssets,omitempty"`
+	// Only for images: "fit" (default), "fill" (crops the overflow) or "original" (the page takes the size of the image)
+	ImageFit string `json:"imageFit,omitempty"`
+	// Only for emails: Word attachments are converted and appended as extra pages
+	AppendAttachments bool `json:"appendAttachments,omitempty"`
+}
+
+func (o ConversionOptions) Value() (driver.Value, error) {
+	return json.Marshal(o)
+}
+
+func (o *ConversionOptions) Scan(value interface{}) error {
+	*o = ConversionOptions{}
+	return scanJSON(value, o)
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/gofrs/uuid/v5"
+	"github.com/lib/pq"
 )
 
 type ConvertRequestStatus string
@@ -14,16 +15,44 @@ const (
 	ConvertRequestStatusDone       ConvertRequestStatus = "done"
 	ConvertRequestStatusError      ConvertRequestStatus = "error"
 	ConvertRequestStatusConverting ConvertRequestStatus = "converting"
+	ConvertRequestStatusCancelled  ConvertRequestStatus = "cancelled"
+)
+
+// Tells clients why a conversion failed, the error itself is free text for people
+type ConvertRequestErrorCode string
+
+const (
+	// The file is damaged or not what its extension says
+	ConvertRequestErrorCodeCorruptInput ConvertRequestErrorCode = "corrupt_input"
+	// The file is password-protected
+	ConvertRequestErrorCodeEncryptedInput    ConvertRequestErrorCode = "encrypted_input"
+	ConvertRequestErrorCodeUnsupportedFormat ConvertRequestErrorCode = "unsupported_format"
+	// The conversion service can't be reached or is overloaded
+	ConvertRequestErrorCodeEngineUnavailable ConvertRequestErrorCode = "engine_unavailable"
+	ConvertRequestErrorCodeTimeout           ConvertRequestErrorCode = "timeout"
+	// The conversion succeeded, but the result is not a valid PDF (e.g. truncated or an error page)
+	ConvertRequestErrorCodeOutputInvalid ConvertRequestErrorCode = "output_invalid"
+	ConvertRequestErrorCodeInternal      ConvertRequestErrorCode = "internal"
 )
 
 type ConvertRequest struct {
-	Id          uuid.UUID            `db:"id" json:"id"`
-	FileName    string               `db:"file_name" json:"fileName"`
-	Status      ConvertRequestStatus `db:"status" json:"status"`
-	ConvertedAt *time.Time           `db:"converted_at" json:"convertedAt"`
-	CreatedAt   time.Time            `db:"created_at" json:"createdAt"`
-	FileSize    int64                `db:"file_size" json:"fileSize"`
-	Error       *string              `db:"error" json:"error"`
+	Id          uuid.UUID                `db:"id" json:"id"`
+	FileName    string                   `db:"file_name" json:"fileName"`
+	MimeType    string                   `db:"mime_type" json:"mimeType"`
+	Status      ConvertRequestStatus     `db:"status" json:"status"`
+	ConvertedAt *time.Time               `db:"converted_at" json:"convertedAt"`
+	CreatedAt   time.Time                `db:"created_at" json:"createdAt"`
+	FileSize    int64                    `db:"file_size" json:"fileSize"`
+	Error       *string                  `db:"error" json:"error"`
+	ErrorCode   *ConvertRequestErrorCode `db:"error_code" json:"errorCode"`
+	PageCount   *int                     `db:"page_count" json:"pageCount"`
+	OutputSize  *int64                   `db:"output_size" json:"outputSize"`
+	Priority    Priority                 `db:"priority" json:"priority"`
+	// Requests with earlier deadlines are converted first within the same priority
+	NeededBy *time.Time `db:"needed_by" json:"neededBy,omitempty"`
+	// Not picked up before, set by clients to delay the conversion and by retries
+	NotBefore *time.Time     `db:"not_before" json:"notBefore,omitempty"`
+	Tags      pq.StringArray `db:"tags" json:"tags"`
 }
 
 func (c ConvertRequest) MarshalJSON() ([]byte, error) {
@@ -31,6 +60,8 @@ func (c ConvertRequest) MarshalJSON() ([]byte, error) {
 	return json.Marshal(&struct {
 		ConvertedAt *int64 `json:"convertedAt"`
 		CreatedAt   int64  `json:"createdAt"`
+		NeededBy    *int64 `json:"neededBy,omitempty"`
+		NotBefore   *int64 `json:"notBefore,omitempty"`
 		*Alias
 	}{
 		ConvertedAt: func() *int64 {
@@ -41,6 +72,8 @@ func (c ConvertRequest) MarshalJSON() ([]byte, error) {
 			return nil
 		}(),
 		CreatedAt: c.CreatedAt.Unix() * 1000,
+		NeededBy:  unixMilli(c.NeededBy),
+		NotBefore: unixMilli(c.NotBefore),
 		Alias:     (*Alias)(&c),
 	})
 }
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Set per access token or API key, higher priorities are converted and batched first
+type Priority int
+
+const (
+	// E.g. bulk backfills through the API
+	PriorityLow    Priority = 0
+	PriorityNormal Priority = 1
+	PriorityHigh   Priority = 2
+)
+
+var priorityNames = map[Priority]string{
+	PriorityLow:    "low",
+	PriorityNormal: "normal",
+	PriorityHigh:   "high",
+}
+
+func ParsePriority(value string) (Priority, error) {
+	for priority, name := range priorityNames {
+		if name == value {
+			return priority, nil
+		}
+	}
+
+	return PriorityNormal, fmt.Errorf("unknown priority: %s", value)
+}
+
+func (p Priority) String() string {
+	if name, ok := priorityNames[p]; ok {
+		return name
+	}
+	return fmt.Sprint(int(p))
+}
+
+func (p Priority) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func unixMilli(t *time.Time) *int64 {
+	if t == nil {
+		return nil
+	}
+
+	milliseconds := t.Unix() * 1000
+	return &milliseconds
+}
@@ -0,0 +1,195 @@
+package naming
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	DefaultTemplate   = "{name}"
+	maxTemplateLength = 200
+	// Leaves room for the deduplication suffix and the extension within the common 255 bytes limit
+	maxNameLength = 200
+	fallbackName  = "document"
+)
+
+var (
+	placeholderRegexp = regexp.MustCompile(`\{([^{}]*)\}`)
+	extensionRegexp   = regexp.MustCompile(`^\.[A-Za-z0-9]{1,5}$`)
+	reservedNames     = regexp.MustCompile(`(?i)^(con|prn|aux|nul|com[0-9]|lpt[0-9])(\..*)?$`)
+
+	placeholders = map[string]bool{"index": true, "name": true, "date": true}
+)
+
+// A client provided pattern of output file names, e.g. "{index}-{name}" or "{date}-{name}":
+//   - {index} - the 1-based position in the batch, zero padded so that names sort in the batch order
+//   - {name} - the original file name without the extension
+//   - {date} - the creation date of the batch (or the convert request for single downloads), YYYY-MM-DD
+type Template string
+
+func ParseTemplate(value string) (Template, error) {
+	if value == "" {
+		return DefaultTemplate, nil
+	}
+
+	if len(value) > maxTemplateLength {
+		return "", fmt.Errorf("template is too long, max %d characters", maxTemplateLength)
+	}
+
+	for _, match := range placeholderRegexp.FindAllStringSubmatch(value, -1) {
+		if !placeholders[match[1]] {
+			return "", fmt.Errorf("unknown placeholder %s", match[0])
+		}
+	}
+
+	if strings.ContainsAny(placeholderRegexp.ReplaceAllString(value, ""), "{}") {
+		return "", fmt.Errorf("unbalanced braces in template")
+	}
+
+	return Template(value), nil
+}
+
+func (t Template) apply(index int, indexWidth int, name string, date time.Time) string {
+	return placeholderRegexp.ReplaceAllStringFunc(string(t), func(placeholder string) string {
+		switch placeholder {
+		case "{index}":
+			return fmt.Sprintf("%0*d", indexWidth, index)
+		case "{date}":
+			return date.UTC().Format(time.DateOnly)
+		default:
+			return name
+		}
+	})
+}
+
+// Gives every file of a batch a unique name. The result only depends on the order of the calls,
+// so the same batch always gets the same names.
+type Namer struct {
+	template   Template
+	date       time.Time
+	indexWidth int
+	// Case-insensitive, as the archives are often extracted on case-insensitive file systems
+	usedNames map[string]bool
+}
+
+func NewNamer(template Template, date time.Time, count int) *Namer {
+	if template == "" {
+		template = DefaultTemplate
+	}
+
+	return &Namer{
+		template:   template,
+		date:       date,
+		indexWidth: len(strconv.Itoa(count)),
+		usedNames:  map[string]bool{},
+	}
+}
+
+// The directory is kept (sanitized) for files from archives, pass an empty one otherwise
+func (n *Namer) Name(index int, directory string, originalName string, extension string) string {
+	segments := []string{}
+	for _, segment := range strings.Split(strings.ReplaceAll(directory, "\\", "/"), "/") {
+		if segment = sanitize(segment); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	originalName = StripExtension(sanitize(originalName))
+	if originalName == "" {
+		originalName = fallbackName
+	}
+
+	name := sanitize(n.template.apply(index, n.indexWidth, originalName, n.date))
+	if name == "" {
+		name = fallbackName
+	}
+
+	prefix := strings.Join(segments, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	uniqueName := prefix + name + extension
+	for suffix := 2; n.usedNames[strings.ToLower(uniqueName)]; suffix++ {
+		uniqueName = fmt.Sprintf("%s%s (%d)%s", prefix, name, suffix, extension)
+	}
+	n.usedNames[strings.ToLower(uniqueName)] = true
+
+	return uniqueName
+}
+
+// Names the only file of a single download
+func SingleFileName(template Template, date time.Time, originalName string, extension string) string {
+	return NewNamer(template, date, 1).Name(1, "", originalName, extension)
+}
+
+// Only strips what looks like an extension, so "v1.2 final" stays as is
+func StripExtension(name string) string {
+	extension := path.Ext(name)
+	if extensionRegexp.MatchString(extension) && len(name) > len(extension) {
+		return strings.TrimSuffix(name, extension)
+	}
+	return name
+}
+
+// Makes a single path segment that is safe on common file systems. Path separators and
+// characters reserved on Windows are replaced, leading and trailing dots and spaces are removed
+// (e.g. "..", hidden files).
+func sanitize(name string) string {
+	name = strings.ToValidUTF8(name, "")
+
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+
+	name = strings.Trim(name, ". ")
+	if reservedNames.MatchString(name) {
+		name = "_" + name
+	}
+
+	for len(name) > maxNameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+
+	return strings.TrimRight(name, ". ")
+}
+
+// RFC 6266: an ASCII fallback for old clients and the exact UTF-8 name for the rest
+func ContentDisposition(fileName string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, fileName)
+
+	contentDisposition := fmt.Sprintf(`attachment; filename="%s"`, fallback)
+	if fallback != fileName {
+		contentDisposition += "; filename*=UTF-8''" + encodeExtValue(fileName)
+	}
+
+	return contentDisposition
+}
+
+// RFC 5987 percent encoding, only attr-char is kept as is
+func encodeExtValue(value string) string {
+	var encoded strings.Builder
+	for _, b := range []byte(value) {
+		if b < utf8.RuneSelf && (unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b)) || strings.IndexByte("!#$&+-.^_`|~", b) >= 0) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
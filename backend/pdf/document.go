@@ -0,0 +1,603 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+const (
+	// Decoded cross-reference and object streams, they are tiny in practice
+	maxDecodedStreamSize = 64 * 1024 * 1024
+	maxResolveDepth      = 32
+	maxXrefSections      = 1000
+)
+
+var (
+	errInvalidObject = errors.New("invalid object")
+
+	objectHeaderRegexp = regexp.MustCompile(`(\d+)[\x00\t\n\f\r ]+(\d+)[\x00\t\n\f\r ]+obj`)
+)
+
+type xrefEntry struct {
+	offset int64
+	// Objects inside object streams are located by the stream and the index within it
+	compressed bool
+	streamId   int
+	index      int
+}
+
+type objectStream struct {
+	data    []byte
+	offsets map[int]int
+}
+
+// Random access to the objects of a PDF kept in memory
+type document struct {
+	data          []byte
+	xref          map[int]xrefEntry
+	trailer       dict
+	objects       map[int]any
+	objectStreams map[int]*objectStream
+	resolving     map[int]bool
+}
+
+func newDocument(data []byte) *document {
+	return &document{
+		data:          data,
+		xref:          map[int]xrefEntry{},
+		trailer:       dict{},
+		objects:       map[int]any{},
+		objectStreams: map[int]*objectStream{},
+		resolving:     map[int]bool{},
+	}
+}
+
+// Reads the cross-reference sections starting from the last startxref, following /Prev to older sections
+func (d *document) loadXref() error {
+	startXrefIndex := bytes.LastIndex(d.data, []byte("startxref"))
+	if startXrefIndex == -1 {
+		return ErrInvalidXref
+	}
+
+	l := &lexer{data: d.data, pos: startXrefIndex + len("startxref")}
+	offset, err := l.parseObject(0)
+	if err != nil {
+		return ErrInvalidXref
+	}
+
+	visitedOffsets := map[int64]bool{}
+	next, ok := offset.(int64)
+
+	for ok {
+		if visitedOffsets[next] || len(visitedOffsets) >= maxXrefSections {
+			return fmt.Errorf("%w: cross-reference sections loop", ErrInvalidXref)
+		}
+		visitedOffsets[next] = true
+
+		sectionTrailer, err := d.loadXrefSection(next)
+		if err != nil {
+			return err
+		}
+
+		// A hybrid file has a cross-reference stream for the compressed objects in addition to the table
+		if xrefStreamOffset, ok := sectionTrailer["XRefStm"].(int64); ok && !visitedOffsets[xrefStreamOffset] {
+			visitedOffsets[xrefStreamOffset] = true
+			if _, err := d.loadXrefSection(xrefStreamOffset); err != nil {
+				return err
+			}
+		}
+
+		next, ok = sectionTrailer["Prev"].(int64)
+	}
+
+	if _, ok := d.trailer["Root"]; !ok {
+		return errors.New("missing document catalog")
+	}
+
+	return nil
+}
+
+// Newer sections are loaded first, so existing entries (and trailer keys) take precedence
+func (d *document) loadXrefSection(offset int64) (dict, error) {
+	if offset <= 0 || offset >= int64(len(d.data)) {
+		return nil, ErrInvalidXref
+	}
+
+	l := &lexer{data: d.data, pos: int(offset)}
+	l.skipSpace()
+
+	var sectionTrailer dict
+	var err error
+	if bytes.HasPrefix(d.data[l.pos:], []byte("xref")) {
+		l.pos += len("xref")
+		sectionTrailer, err = d.loadXrefTable(l)
+	} else {
+		sectionTrailer, err = d.loadXrefStream(offset)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d.mergeTrailer(sectionTrailer)
+
+	return sectionTrailer, nil
+}
+
+func (d *document) mergeTrailer(trailer dict) {
+	for key, value := range trailer {
+		if _, exists := d.trailer[key]; !exists && value != nil {
+			d.trailer[key] = value
+		}
+	}
+}
+
+func (d *document) loadXrefTable(l *lexer) (dict, error) {
+	for {
+		first, err := l.parseObject(0)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidXref, err)
+		}
+		if first == keyword("trailer") {
+			break
+		}
+
+		count, err := l.parseObject(0)
+		start, startOk := first.(int64)
+		entryCount, countOk := count.(int64)
+		if err != nil || !startOk || !countOk || start < 0 || entryCount < 0 || entryCount > int64(len(d.data)/18) {
+			return nil, fmt.Errorf("%w: invalid subsection", ErrInvalidXref)
+		}
+
+		for i := range entryCount {
+			offset, _ := l.parseObject(0)
+			_, _ = l.parseObject(0)
+			kind, err := l.parseObject(0)
+			entryOffset, ok := offset.(int64)
+			if err != nil || !ok || (kind != keyword("n") && kind != keyword("f")) {
+				return nil, fmt.Errorf("%w: invalid entry", ErrInvalidXref)
+			}
+
+			id := int(start + i)
+			if _, exists := d.xref[id]; exists || kind != keyword("n") {
+				continue
+			}
+			d.xref[id] = xrefEntry{offset: entryOffset}
+		}
+	}
+
+	trailer, err := l.parseObject(0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid trailer: %v", ErrInvalidXref, err)
+	}
+	trailerDict, ok := trailer.(dict)
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid trailer", ErrInvalidXref)
+	}
+
+	return trailerDict, nil
+}
+
+func (d *document) loadXrefStream(offset int64) (dict, error) {
+	_, object, err := d.parseIndirectObject(d.data, int(offset))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidXref, err)
+	}
+	xrefStream, ok := object.(stream)
+	if !ok || xrefStream.dict["Type"] != name("XRef") {
+		return nil, ErrInvalidXref
+	}
+
+	data, err := d.decodeStream(xrefStream)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidXref, err)
+	}
+
+	widthsArray, _ := xrefStream.dict["W"].(array)
+	widths := make([]int, 0, 3)
+	entrySize := 0
+	for _, width := range widthsArray {
+		value, ok := width.(int64)
+		if !ok || value < 0 || value > 8 {
+			return nil, fmt.Errorf("%w: invalid field widths", ErrInvalidXref)
+		}
+		widths = append(widths, int(value))
+		entrySize += int(value)
+	}
+	if len(widths) != 3 || entrySize == 0 {
+		return nil, fmt.Errorf("%w: invalid field widths", ErrInvalidXref)
+	}
+
+	index, ok := xrefStream.dict["Index"].(array)
+	if !ok {
+		size, _ := xrefStream.dict["Size"].(int64)
+		index = array{int64(0), size}
+	}
+
+	position := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		start, startOk := index[i].(int64)
+		count, countOk := index[i+1].(int64)
+		if !startOk || !countOk || start < 0 || count < 0 {
+			return nil, fmt.Errorf("%w: invalid index", ErrInvalidXref)
+		}
+
+		for j := range count {
+			if position+entrySize > len(data) {
+				return nil, fmt.Errorf("%w: cross-reference stream is too short", ErrInvalidXref)
+			}
+
+			fields := [3]int64{1, 0, 0}
+			for k, width := range widths {
+				if width == 0 {
+					continue
+				}
+				fields[k] = 0
+				for _, b := range data[position : position+width] {
+					fields[k] = fields[k]<<8 | int64(b)
+				}
+				position += width
+			}
+
+			id := int(start + j)
+			if _, exists := d.xref[id]; exists {
+				continue
+			}
+
+			switch fields[0] {
+			case 1:
+				d.xref[id] = xrefEntry{offset: fields[1]}
+			case 2:
+				d.xref[id] = xrefEntry{compressed: true, streamId: int(fields[1]), index: int(fields[2])}
+			}
+		}
+	}
+
+	return xrefStream.dict, nil
+}
+
+// Rebuilds the cross-reference table by scanning the file for objects, like readers do for damaged files
+func (d *document) reconstructXref() error {
+	d.xref = map[int]xrefEntry{}
+	d.trailer = dict{}
+	d.objects = map[int]any{}
+	d.objectStreams = map[int]*objectStream{}
+
+	for _, match := range objectHeaderRegexp.FindAllSubmatchIndex(d.data, -1) {
+		if match[0] > 0 && !isWhitespace(d.data[match[0]-1]) && !isDelimiter(d.data[match[0]-1]) {
+			continue
+		}
+
+		id, err := strconv.Atoi(string(d.data[match[2]:match[3]]))
+		if err != nil {
+			continue
+		}
+
+		// Later objects are newer (incremental updates)
+		d.xref[id] = xrefEntry{offset: int64(match[0])}
+	}
+
+	directIds := make([]int, 0, len(d.xref))
+	for id := range d.xref {
+		directIds = append(directIds, id)
+	}
+
+	for _, id := range directIds {
+		objectStreamObject, ok := d.getObject(id).(stream)
+		if !ok {
+			continue
+		}
+
+		switch objectStreamObject.dict["Type"] {
+		case name("ObjStm"):
+			objectStream, err := d.loadObjectStream(id)
+			if err != nil {
+				continue
+			}
+			for compressedId, index := range objectStream.offsets {
+				if _, exists := d.xref[compressedId]; !exists {
+					d.xref[compressedId] = xrefEntry{compressed: true, streamId: id, index: index}
+				}
+			}
+		case name("XRef"):
+			d.mergeTrailer(objectStreamObject.dict)
+		}
+	}
+
+	for trailerIndex := bytes.LastIndex(d.data, []byte("trailer")); trailerIndex != -1; trailerIndex = bytes.LastIndex(d.data[:trailerIndex], []byte("trailer")) {
+		l := &lexer{data: d.data, pos: trailerIndex + len("trailer")}
+		if trailer, err := l.parseObject(0); err == nil {
+			if trailerDict, ok := trailer.(dict); ok && trailerDict["Root"] != nil {
+				d.mergeTrailer(trailerDict)
+				break
+			}
+		}
+	}
+
+	if d.trailer["Root"] == nil {
+		for id := range d.xref {
+			if catalog, ok := d.getObject(id).(dict); ok && catalog["Type"] == name("Catalog") {
+				d.trailer["Root"] = ref{id: id}
+				break
+			}
+		}
+	}
+
+	if d.trailer["Root"] == nil {
+		return errors.New("missing document catalog")
+	}
+
+	return nil
+}
+
+// Returns nil for missing and broken objects, as the specification treats references to missing objects as null
+func (d *document) getObject(id int) any {
+	if object, ok := d.objects[id]; ok {
+		return object
+	}
+
+	entry, ok := d.xref[id]
+	if !ok || d.resolving[id] {
+		return nil
+	}
+	d.resolving[id] = true
+	defer delete(d.resolving, id)
+
+	var object any
+	if entry.compressed {
+		objectStream, err := d.loadObjectStream(entry.streamId)
+		if err != nil {
+			return nil
+		}
+		offset, ok := objectStream.offsets[id]
+		if !ok {
+			return nil
+		}
+		l := &lexer{data: objectStream.data, pos: offset}
+		if object, err = l.parseObject(0); err != nil {
+			return nil
+		}
+	} else {
+		parsedId, parsedObject, err := d.parseIndirectObject(d.data, int(entry.offset))
+		if err != nil || parsedId != id {
+			return nil
+		}
+		object = parsedObject
+	}
+
+	d.objects[id] = object
+	return object
+}
+
+func (d *document) resolve(value any) any {
+	for range maxResolveDepth {
+		reference, ok := value.(ref)
+		if !ok {
+			return value
+		}
+		value = d.getObject(reference.id)
+	}
+	return nil
+}
+
+func (d *document) parseIndirectObject(data []byte, offset int) (int, any, error) {
+	if offset < 0 || offset >= len(data) {
+		return 0, nil, errInvalidObject
+	}
+
+	l := &lexer{data: data, pos: offset}
+	id, idErr := l.parseObject(0)
+	_, generationErr := l.parseObject(0)
+	objKeyword, keywordErr := l.parseObject(0)
+	objectId, ok := id.(int64)
+	if idErr != nil || generationErr != nil || keywordErr != nil || !ok || objKeyword != keyword("obj") {
+		return 0, nil, errInvalidObject
+	}
+
+	object, err := l.parseObject(0)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	streamDict, ok := object.(dict)
+	if !ok {
+		return int(objectId), object, nil
+	}
+
+	afterDict := l.pos
+	if next, err := l.parseObject(0); err != nil || next != keyword("stream") {
+		l.pos = afterDict
+		return int(objectId), object, nil
+	}
+
+	// The keyword is followed by CRLF or LF (CR alone is tolerated)
+	if l.pos < len(data) && data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(data) && data[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+
+	length, ok := d.resolve(streamDict["Length"]).(int64)
+	end := start + int(length)
+	if !ok || length < 0 || end > len(data) || !bytes.Contains(data[end:min(end+32, len(data))], []byte("endstream")) {
+		// Wrong lengths are common, the end marker is searched for instead
+		endIndex := bytes.Index(data[start:], []byte("endstream"))
+		if endIndex == -1 {
+			return 0, nil, fmt.Errorf("%w: unterminated stream", errInvalidObject)
+		}
+		end = start + len(bytes.TrimRight(data[start:start+endIndex], "\r\n"))
+	}
+
+	return int(objectId), stream{dict: streamDict, data: data[start:end]}, nil
+}
+
+func (d *document) loadObjectStream(id int) (*objectStream, error) {
+	if objectStream, ok := d.objectStreams[id]; ok {
+		return objectStream, nil
+	}
+
+	streamObject, ok := d.getObject(id).(stream)
+	if !ok || streamObject.dict["Type"] != name("ObjStm") {
+		return nil, fmt.Errorf("%w: object %d is not an object stream", errInvalidObject, id)
+	}
+
+	data, err := d.decodeStream(streamObject)
+	if err != nil {
+		return nil, err
+	}
+
+	count, countOk := d.resolve(streamObject.dict["N"]).(int64)
+	first, firstOk := d.resolve(streamObject.dict["First"]).(int64)
+	if !countOk || !firstOk || count < 0 || first < 0 || first > int64(len(data)) {
+		return nil, fmt.Errorf("%w: invalid object stream %d", errInvalidObject, id)
+	}
+
+	objectStream := &objectStream{data: data, offsets: map[int]int{}}
+	l := &lexer{data: data[:first]}
+	for range count {
+		objectId, idErr := l.parseObject(0)
+		offset, offsetErr := l.parseObject(0)
+		compressedId, idOk := objectId.(int64)
+		compressedOffset, offsetOk := offset.(int64)
+		if idErr != nil || offsetErr != nil || !idOk || !offsetOk || first+compressedOffset >= int64(len(data)) {
+			return nil, fmt.Errorf("%w: invalid object stream %d", errInvalidObject, id)
+		}
+		objectStream.offsets[int(compressedId)] = int(first + compressedOffset)
+	}
+
+	d.objectStreams[id] = objectStream
+	return objectStream, nil
+}
+
+// Only what cross-reference and object streams use: FlateDecode with the PNG predictors
+func (d *document) decodeStream(s stream) ([]byte, error) {
+	filters := []any{}
+	switch filter := d.resolve(s.dict["Filter"]).(type) {
+	case nil:
+	case name:
+		filters = append(filters, filter)
+	case array:
+		filters = filter
+	default:
+		return nil, fmt.Errorf("invalid stream filter")
+	}
+
+	decodeParams, _ := d.resolve(s.dict["DecodeParms"]).(dict)
+	if decodeParamsArray, ok := d.resolve(s.dict["DecodeParms"]).(array); ok && len(decodeParamsArray) > 0 {
+		decodeParams, _ = d.resolve(decodeParamsArray[0]).(dict)
+	}
+
+	data := s.data
+	for _, filter := range filters {
+		if d.resolve(filter) != name("FlateDecode") {
+			return nil, fmt.Errorf("unsupported stream filter: %v", filter)
+		}
+
+		reader, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode stream: %w", err)
+		}
+		decoded, err := io.ReadAll(io.LimitReader(reader, maxDecodedStreamSize+1))
+		reader.Close()
+		// Truncated streams are common, the data decoded so far is still usable
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("failed to decode stream: %w", err)
+		}
+		if len(decoded) > maxDecodedStreamSize {
+			return nil, errors.New("decoded stream is too large")
+		}
+		data = decoded
+	}
+
+	predictor, _ := d.resolve(decodeParams["Predictor"]).(int64)
+	if predictor < 10 {
+		if predictor > 1 {
+			return nil, fmt.Errorf("unsupported predictor: %d", predictor)
+		}
+		return data, nil
+	}
+
+	columns, ok := d.resolve(decodeParams["Columns"]).(int64)
+	if !ok {
+		columns = 1
+	}
+	colors, ok := d.resolve(decodeParams["Colors"]).(int64)
+	if !ok {
+		colors = 1
+	}
+	bitsPerComponent, ok := d.resolve(decodeParams["BitsPerComponent"]).(int64)
+	if !ok {
+		bitsPerComponent = 8
+	}
+
+	return unpredictPng(data, int((columns*colors*bitsPerComponent+7)/8), int(max(1, colors*bitsPerComponent/8)))
+}
+
+// Every row starts with the PNG filter type of the row
+func unpredictPng(data []byte, rowLength int, bytesPerPixel int) ([]byte, error) {
+	if rowLength <= 0 {
+		return nil, errors.New("invalid predictor parameters")
+	}
+
+	result := make([]byte, 0, len(data))
+	previousRow := make([]byte, rowLength)
+	row := make([]byte, rowLength)
+
+	for offset := 0; offset+rowLength+1 <= len(data); offset += rowLength + 1 {
+		filterType := data[offset]
+		copy(row, data[offset+1:offset+1+rowLength])
+
+		for i := range row {
+			var left, up, upLeft byte
+			if i >= bytesPerPixel {
+				left = row[i-bytesPerPixel]
+				upLeft = previousRow[i-bytesPerPixel]
+			}
+			up = previousRow[i]
+
+			switch filterType {
+			case 0:
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			default:
+				return nil, fmt.Errorf("invalid PNG filter type: %d", filterType)
+			}
+		}
+
+		result = append(result, row...)
+		copy(previousRow, row)
+	}
+
+	return result, nil
+}
+
+func paeth(a byte, b byte, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
@@ -0,0 +1,358 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Builds PDFs with correct offsets, the tests break them on purpose where needed
+type testPdf struct {
+	data    bytes.Buffer
+	offsets map[int]int
+}
+
+func newTestPdf() *testPdf {
+	p := &testPdf{offsets: map[int]int{}}
+	p.data.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	return p
+}
+
+func (p *testPdf) object(id int, body string) {
+	p.offsets[id] = p.data.Len()
+	fmt.Fprintf(&p.data, "%d 0 obj\n%s\nendobj\n", id, body)
+}
+
+func (p *testPdf) stream(id int, dictionary string, data []byte) {
+	p.offsets[id] = p.data.Len()
+	fmt.Fprintf(&p.data, "%d 0 obj\n<< %s /Length %d >>\nstream\n", id, dictionary, len(data))
+	p.data.Write(data)
+	p.data.WriteString("\nendstream\nendobj\n")
+}
+
+// A cross-reference table with the given objects, returns its offset for startxref
+func (p *testPdf) xrefTable(trailer string, ids ...int) int {
+	offset := p.data.Len()
+	p.data.WriteString("xref\n0 1\n0000000000 65535 f \n")
+	for _, id := range ids {
+		fmt.Fprintf(&p.data, "%d 1\n%010d 00000 n \n", id, p.offsets[id])
+	}
+	fmt.Fprintf(&p.data, "trailer\n%s\n", trailer)
+	return offset
+}
+
+func (p *testPdf) end(startXref int) []byte {
+	fmt.Fprintf(&p.data, "startxref\n%d\n%%%%EOF\n", startXref)
+	return p.data.Bytes()
+}
+
+func deflate(t *testing.T, data []byte) []byte {
+	t.Helper()
+	compressed := &bytes.Buffer{}
+	writer := zlib.NewWriter(compressed)
+	if _, err := writer.Write(data); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	return compressed.Bytes()
+}
+
+// The catalog (1), the page tree root (2) and the pages (3 and up)
+func writeTestPages(p *testPdf, pageCount int) []int {
+	kids := ""
+	for i := range pageCount {
+		kids += fmt.Sprintf("%d 0 R ", 3+i)
+	}
+
+	p.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	p.object(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids, pageCount))
+	ids := []int{1, 2}
+	for i := range pageCount {
+		p.object(3+i, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>")
+		ids = append(ids, 3+i)
+	}
+	return ids
+}
+
+func validTestPdf(pageCount int) []byte {
+	p := newTestPdf()
+	ids := writeTestPages(p, pageCount)
+	return p.end(p.xrefTable(fmt.Sprintf("<< /Size %d /Root 1 0 R >>", len(ids)+1), ids...))
+}
+
+// The catalog and the pages are in an object stream, located by a cross-reference stream with PNG Up prediction
+func compressedTestPdf(t *testing.T) []byte {
+	t.Helper()
+	p := newTestPdf()
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R 5 0 R] /Count 3 >>",
+		"<< /Type /Page /Parent 2 0 R >>",
+		"<< /Type /Page /Parent 2 0 R >>",
+		"<< /Type /Page /Parent 2 0 R >>",
+	}
+	header, body := "", ""
+	for i, object := range objects {
+		header += fmt.Sprintf("%d %d ", i+1, len(body))
+		body += object + " "
+	}
+	p.stream(6, fmt.Sprintf("/Type /ObjStm /N %d /First %d /Filter /FlateDecode", len(objects), len(header)), deflate(t, []byte(header+body)))
+
+	xrefOffset := p.data.Len()
+	// Type, offset or object stream id, generation or index within the object stream
+	entries := [][3]int{{0, 0, 65535}}
+	for i := range objects {
+		entries = append(entries, [3]int{2, 6, i})
+	}
+	entries = append(entries, [3]int{1, p.offsets[6], 0}, [3]int{1, xrefOffset, 0})
+
+	rows := []byte{}
+	previousRow := make([]byte, 4)
+	for _, entry := range entries {
+		row := []byte{byte(entry[0]), 0, 0, byte(entry[2])}
+		binary.BigEndian.PutUint16(row[1:], uint16(entry[1]))
+		rows = append(rows, 2)
+		for i := range row {
+			rows = append(rows, row[i]-previousRow[i])
+		}
+		previousRow = row
+	}
+
+	p.stream(
+		7,
+		fmt.Sprintf("/Type /XRef /Size %d /W [1 2 1] /Root 1 0 R /Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns 4 >>", len(entries)),
+		deflate(t, rows),
+	)
+
+	return p.end(xrefOffset)
+}
+
+// The second revision adds a page and replaces the page tree root, the first revision is left intact
+func incrementallyUpdatedTestPdf() []byte {
+	p := newTestPdf()
+	ids := writeTestPages(p, 1)
+	firstXref := p.xrefTable("<< /Size 4 /Root 1 0 R >>", ids...)
+	fmt.Fprintf(&p.data, "startxref\n%d\n%%%%EOF\n", firstXref)
+
+	p.object(2, "<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 >>")
+	p.object(4, "<< /Type /Page /Parent 2 0 R >>")
+	return p.end(p.xrefTable(fmt.Sprintf("<< /Size 5 /Root 1 0 R /Prev %d >>", firstXref), 2, 4))
+}
+
+func writeTestFile(t *testing.T, content []byte) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "test.pdf")
+	if err := os.WriteFile(filePath, content, 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	return filePath
+}
+
+func TestLoadXref(t *testing.T) {
+	document := newDocument(validTestPdf(2))
+	if err := document.loadXref(); err != nil {
+		t.Fatalf("failed to load xref: %v", err)
+	}
+
+	if len(document.xref) != 4 {
+		t.Errorf("expected 4 xref entries, got %d", len(document.xref))
+	}
+	if document.trailer["Root"] != (ref{id: 1}) {
+		t.Errorf("expected root 1 0 R, got %v", document.trailer["Root"])
+	}
+	if page, ok := document.getObject(3).(dict); !ok || page["Type"] != name("Page") {
+		t.Errorf("expected object 3 to be a page, got %v", document.getObject(3))
+	}
+	if object := document.getObject(99); object != nil {
+		t.Errorf("expected missing object to be nil, got %v", object)
+	}
+}
+
+func TestLoadXrefStream(t *testing.T) {
+	document := newDocument(compressedTestPdf(t))
+	if err := document.loadXref(); err != nil {
+		t.Fatalf("failed to load xref: %v", err)
+	}
+
+	if entry := document.xref[3]; !entry.compressed || entry.streamId != 6 || entry.index != 2 {
+		t.Errorf("expected object 3 to be the third object of stream 6, got %+v", entry)
+	}
+	if catalog, ok := document.resolve(document.trailer["Root"]).(dict); !ok || catalog["Type"] != name("Catalog") {
+		t.Errorf("expected the catalog from the object stream, got %v", document.resolve(document.trailer["Root"]))
+	}
+}
+
+func TestLoadXrefIncrementalUpdate(t *testing.T) {
+	document := newDocument(incrementallyUpdatedTestPdf())
+	if err := document.loadXref(); err != nil {
+		t.Fatalf("failed to load xref: %v", err)
+	}
+
+	// The newer section wins
+	pages, ok := document.getObject(2).(dict)
+	if !ok || len(pages["Kids"].(array)) != 2 {
+		t.Errorf("expected the page tree root of the update, got %v", document.getObject(2))
+	}
+	if _, ok := document.trailer["Prev"]; !ok {
+		t.Errorf("expected the trailer of the update")
+	}
+}
+
+func TestLoadXrefErrors(t *testing.T) {
+	loop := newTestPdf()
+	ids := writeTestPages(loop, 1)
+	loopOffset := loop.data.Len()
+	loop.xrefTable(fmt.Sprintf("<< /Size 4 /Root 1 0 R /Prev %d >>", loopOffset), ids...)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"no startxref", []byte("%PDF-1.7\n1 0 obj\n<< >>\nendobj\n%%EOF\n")},
+		{"startxref beyond the end", []byte("%PDF-1.7\nstartxref\n999999\n%%EOF\n")},
+		{"startxref to an object", []byte("%PDF-1.7\n1 0 obj\n<< /Type /Catalog >>\nendobj\nstartxref\n9\n%%EOF\n")},
+		{"sections loop", loop.end(loopOffset)},
+		{"invalid entry", []byte("%PDF-1.7\nxref\n0 1\nfoo bar x\ntrailer\n<< /Root 1 0 R >>\nstartxref\n9\n%%EOF\n")},
+		{"no catalog", []byte("%PDF-1.7\nxref\n0 1\n0000000000 65535 f \ntrailer\n<< /Size 1 >>\nstartxref\n9\n%%EOF\n")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := newDocument(test.data).loadXref(); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestReconstructXref(t *testing.T) {
+	// Every offset is off, like after a producer rewrote the file without updating the table
+	valid := validTestPdf(2)
+	shifted := append([]byte("%junk\n"), valid...)
+
+	document := newDocument(shifted)
+	if err := document.reconstructXref(); err != nil {
+		t.Fatalf("failed to reconstruct xref: %v", err)
+	}
+	if pageCount, err := document.countPages(); err != nil || pageCount != 2 {
+		t.Errorf("expected 2 pages, got %d (%v)", pageCount, err)
+	}
+
+	// Without a trailer the catalog is found by its type
+	noTrailer := newTestPdf()
+	writeTestPages(noTrailer, 1)
+	document = newDocument(noTrailer.data.Bytes())
+	if err := document.reconstructXref(); err != nil {
+		t.Fatalf("failed to reconstruct xref without trailer: %v", err)
+	}
+	if document.trailer["Root"] != (ref{id: 1}) {
+		t.Errorf("expected root 1 0 R, got %v", document.trailer["Root"])
+	}
+
+	if err := newDocument([]byte("<html><body>Bad Gateway</body></html>")).reconstructXref(); err == nil {
+		t.Errorf("expected an error without objects")
+	}
+}
+
+func TestParseIndirectObjectStreamLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected string
+	}{
+		{"direct length", "1 0 obj\n<< /Length 5 >>\nstream\nhello\nendstream\nendobj\n", "hello"},
+		{"indirect length", "1 0 obj\n<< /Length 2 0 R >>\nstream\nhello\nendstream\nendobj\n2 0 obj\n5\nendobj\n", "hello"},
+		{"too long length", "1 0 obj\n<< /Length 500 >>\nstream\r\nhello\r\nendstream\nendobj\n", "hello"},
+		// Lengths that end close to the end marker are trusted
+		{"too short length", "1 0 obj\n<< /Length 3 >>\nstream\n" + strings.Repeat("hello", 10) + "\nendstream\nendobj\n", strings.Repeat("hello", 10)},
+		{"missing length", "1 0 obj\n<< >>\nstream\nhello\nendstream\nendobj\n", "hello"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			document := newDocument([]byte(test.data))
+			if err := document.reconstructXref(); err == nil {
+				t.Fatalf("expected no catalog")
+			}
+
+			id, object, err := document.parseIndirectObject(document.data, 0)
+			if err != nil {
+				t.Fatalf("failed to parse object: %v", err)
+			}
+			s, ok := object.(stream)
+			if id != 1 || !ok || string(s.data) != test.expected {
+				t.Errorf("expected stream %q of object 1, got %d %v", test.expected, id, object)
+			}
+		})
+	}
+
+	if _, _, err := newDocument(nil).parseIndirectObject([]byte("1 0 obj\n<< >>\nstream\nhello"), 0); err == nil {
+		t.Errorf("expected an error for an unterminated stream")
+	}
+}
+
+func TestUnpredictPng(t *testing.T) {
+	// Rows of 2 bytes: None, Sub, Up, Average and Paeth
+	data := []byte{
+		0, 10, 20,
+		1, 5, 1,
+		2, 1, 1,
+		3, 4, 4,
+		4, 1, 1,
+	}
+	expected := []byte{
+		10, 20,
+		5, 6,
+		6, 7,
+		7, 11,
+		8, 12,
+	}
+
+	decoded, err := unpredictPng(data, 2, 1)
+	if err != nil {
+		t.Fatalf("failed to unpredict: %v", err)
+	}
+	if !bytes.Equal(decoded, expected) {
+		t.Errorf("expected %v, got %v", expected, decoded)
+	}
+
+	if _, err := unpredictPng([]byte{5, 1, 1}, 2, 1); err == nil {
+		t.Errorf("expected an error for an invalid filter type")
+	}
+}
+
+func TestIsEncryptedFile(t *testing.T) {
+	p := newTestPdf()
+	ids := writeTestPages(p, 1)
+	p.object(10, "<< /Filter /Standard /V 2 /R 3 >>")
+	encrypted := p.end(p.xrefTable("<< /Size 11 /Root 1 0 R /Encrypt 10 0 R >>", append(ids, 10)...))
+
+	tests := []struct {
+		name      string
+		data      []byte
+		encrypted bool
+	}{
+		{"plain", validTestPdf(1), false},
+		{"encrypted", encrypted, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			isEncrypted, err := IsEncryptedFile(writeTestFile(t, test.data))
+			if err != nil {
+				t.Fatalf("failed to check encryption: %v", err)
+			}
+			if isEncrypted != test.encrypted {
+				t.Errorf("expected encrypted %t, got %t", test.encrypted, isEncrypted)
+			}
+		})
+	}
+}
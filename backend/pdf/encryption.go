@@ -0,0 +1,24 @@
+package pdf
+
+import (
+	"fmt"
+	"os"
+)
+
+// Encrypted files have /Encrypt in the trailer. Their strings and streams (including object streams) can't be
+// read without decrypting, even when only an owner password is set.
+func IsEncryptedFile(filePath string) (bool, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	document := newDocument(content)
+	if err := document.loadXref(); err != nil {
+		if reconstructErr := document.reconstructXref(); reconstructErr != nil {
+			return false, fmt.Errorf("failed to read cross-reference sections: %w", err)
+		}
+	}
+
+	return document.trailer["Encrypt"] != nil, nil
+}
@@ -0,0 +1,264 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Nested arrays and dictionaries deeper than this are rejected, the files can come from users
+const maxObjectDepth = 100
+
+var errUnexpectedEnd = errors.New("unexpected end of data")
+
+// Objects as parsed from the file: int64, float64, bool, nil, name, string, dict, array, ref, keyword and stream
+type (
+	name    string
+	keyword string
+	dict    map[name]any
+	array   []any
+)
+
+type ref struct {
+	id         int
+	generation int
+}
+
+// The data is not decoded, see document.decodeStream
+type stream struct {
+	dict dict
+	data []byte
+}
+
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func isWhitespace(b byte) bool {
+	return b == 0 || b == '\t' || b == '\n' || b == '\f' || b == '\r' || b == ' '
+}
+
+func isDelimiter(b byte) bool {
+	switch b {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		b := l.data[l.pos]
+		if isWhitespace(b) {
+			l.pos++
+		} else if b == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		} else {
+			return
+		}
+	}
+}
+
+func (l *lexer) readRegular() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isWhitespace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+func (l *lexer) parseObject(depth int) (any, error) {
+	if depth > maxObjectDepth {
+		return nil, errors.New("objects are nested too deep")
+	}
+
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, errUnexpectedEnd
+	}
+
+	b := l.data[l.pos]
+	switch {
+	case b == '/':
+		return l.parseName()
+	case b == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		return l.parseDict(depth)
+	case b == '<':
+		return l.parseHexString()
+	case b == '(':
+		return l.parseLiteralString()
+	case b == '[':
+		l.pos++
+		return l.parseArray(depth)
+	case b == '+' || b == '-' || b == '.' || isDigit(b):
+		return l.parseNumberOrRef()
+	}
+
+	word := l.readRegular()
+	switch word {
+	case "":
+		return nil, fmt.Errorf("unexpected character %q at %d", b, l.pos)
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	return keyword(word), nil
+}
+
+func (l *lexer) parseName() (name, error) {
+	l.pos++
+	raw := l.readRegular()
+
+	decoded := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) {
+			if value, err := strconv.ParseUint(raw[i+1:i+3], 16, 8); err == nil {
+				decoded = append(decoded, byte(value))
+				i += 2
+				continue
+			}
+		}
+		decoded = append(decoded, raw[i])
+	}
+
+	return name(decoded), nil
+}
+
+func (l *lexer) parseDict(depth int) (dict, error) {
+	result := dict{}
+
+	for {
+		l.skipSpace()
+		if l.pos+1 < len(l.data) && l.data[l.pos] == '>' && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return result, nil
+		}
+
+		key, err := l.parseObject(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		keyName, ok := key.(name)
+		if !ok {
+			return nil, fmt.Errorf("dictionary key is not a name at %d", l.pos)
+		}
+
+		value, err := l.parseObject(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := value.(keyword); ok {
+			return nil, fmt.Errorf("unexpected keyword %s in dictionary at %d", value, l.pos)
+		}
+
+		result[keyName] = value
+	}
+}
+
+func (l *lexer) parseArray(depth int) (array, error) {
+	result := array{}
+
+	for {
+		l.skipSpace()
+		if l.pos < len(l.data) && l.data[l.pos] == ']' {
+			l.pos++
+			return result, nil
+		}
+
+		value, err := l.parseObject(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := value.(keyword); ok {
+			return nil, fmt.Errorf("unexpected keyword %s in array at %d", value, l.pos)
+		}
+
+		result = append(result, value)
+	}
+}
+
+// The content of strings is not needed, they are only skipped correctly
+func (l *lexer) parseHexString() (string, error) {
+	start := l.pos
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		l.pos++
+	}
+	if l.pos >= len(l.data) {
+		return "", errUnexpectedEnd
+	}
+	l.pos++
+
+	return string(l.data[start:l.pos]), nil
+}
+
+func (l *lexer) parseLiteralString() (string, error) {
+	start := l.pos
+	nesting := 0
+
+	for l.pos < len(l.data) {
+		switch l.data[l.pos] {
+		case '\\':
+			l.pos++
+		case '(':
+			nesting++
+		case ')':
+			nesting--
+			if nesting == 0 {
+				l.pos++
+				return string(l.data[start:l.pos]), nil
+			}
+		}
+		l.pos++
+	}
+
+	return "", errUnexpectedEnd
+}
+
+// "12 0 R" is a reference, a lookahead is needed to tell it apart from two numbers
+func (l *lexer) parseNumberOrRef() (any, error) {
+	start := l.pos
+	for l.pos < len(l.data) && (isDigit(l.data[l.pos]) || l.data[l.pos] == '+' || l.data[l.pos] == '-' || l.data[l.pos] == '.') {
+		l.pos++
+	}
+	token := string(l.data[start:l.pos])
+
+	id, err := strconv.ParseInt(token, 10, 64)
+	if err != nil {
+		value, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", token, start)
+		}
+		return value, nil
+	}
+
+	afterNumber := l.pos
+	l.skipSpace()
+	generationStart := l.pos
+	for l.pos < len(l.data) && isDigit(l.data[l.pos]) {
+		l.pos++
+	}
+	if l.pos > generationStart {
+		generation, err := strconv.Atoi(string(l.data[generationStart:l.pos]))
+		l.skipSpace()
+		if err == nil && l.pos < len(l.data) && l.data[l.pos] == 'R' &&
+			(l.pos+1 == len(l.data) || isWhitespace(l.data[l.pos+1]) || isDelimiter(l.data[l.pos+1])) {
+			l.pos++
+			return ref{id: int(id), generation: generation}, nil
+		}
+	}
+
+	l.pos = afterNumber
+	return id, nil
+}
@@ -0,0 +1,95 @@
+package pdf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseObject(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"42", int64(42)},
+		{"-7", int64(-7)},
+		{"+3", int64(3)},
+		{"3.5", 3.5},
+		{"-.25", -0.25},
+		{"true", true},
+		{"false", false},
+		{"null", nil},
+		{"/Type", name("Type")},
+		{"/A#20B", name("A B")},
+		{"/Odd#2", name("Odd#2")},
+		{"obj", keyword("obj")},
+		{"12 0 R", ref{id: 12}},
+		{"12 3 R", ref{id: 12, generation: 3}},
+		{"12 0 obj", int64(12)},
+		{"12 0 Rx", int64(12)},
+		{"(a (nested) \\) string)", "(a (nested) \\) string)"},
+		{"<48656C6C6F>", "<48656C6C6F>"},
+		{"% a comment\n  7", int64(7)},
+		{"[1 2.5 /N (s) [true] 3 0 R]", array{int64(1), 2.5, name("N"), "(s)", array{true}, ref{id: 3}}},
+		{"<< /A 1 /B << /C [null] >> /D 5 0 R >>", dict{"A": int64(1), "B": dict{"C": array{nil}}, "D": ref{id: 5}}},
+		{"<</Type/Page/Parent 2 0 R>>", dict{"Type": name("Page"), "Parent": ref{id: 2}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			l := &lexer{data: []byte(test.input)}
+			object, err := l.parseObject(0)
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+			if !reflect.DeepEqual(object, test.expected) {
+				t.Errorf("expected %#v, got %#v", test.expected, object)
+			}
+		})
+	}
+}
+
+func TestParseObjectErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"   % only a comment",
+		"(unterminated",
+		"<48656C",
+		"[1 2",
+		"<< /A 1",
+		"<< 1 2 >>",
+		"<< /A obj >>",
+		"[1 endobj]",
+		"1.2.3",
+		")",
+		strings.Repeat("[", maxObjectDepth+2) + strings.Repeat("]", maxObjectDepth+2),
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			l := &lexer{data: []byte(input)}
+			if object, err := l.parseObject(0); err == nil {
+				t.Errorf("expected an error, got %#v", object)
+			}
+		})
+	}
+}
+
+func TestParseObjectSequence(t *testing.T) {
+	l := &lexer{data: []byte("1 0 obj\n<< /Length 3 >>\nstream")}
+
+	expected := []any{int64(1), int64(0), keyword("obj"), dict{"Length": int64(3)}, keyword("stream")}
+	for _, expectedObject := range expected {
+		object, err := l.parseObject(0)
+		if err != nil {
+			t.Fatalf("failed to parse: %v", err)
+		}
+		if !reflect.DeepEqual(object, expectedObject) {
+			t.Errorf("expected %#v, got %#v", expectedObject, object)
+		}
+	}
+
+	if _, err := l.parseObject(0); err != errUnexpectedEnd {
+		t.Errorf("expected errUnexpectedEnd, got %v", err)
+	}
+}
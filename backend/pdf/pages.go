@@ -0,0 +1,93 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+const maxPageTreeDepth = 64
+
+var ErrNoPages = errors.New("no pages in page tree")
+
+// Counts pages by walking the page tree from the document catalog, so pages inside compressed object streams
+// are counted too. Files with wrong cross-reference offsets are read by scanning for objects, like readers do.
+func CountPages(data []byte) (int, error) {
+	document := newDocument(data)
+
+	var pageCount int
+	err := document.loadXref()
+	if err == nil {
+		pageCount, err = document.countPages()
+	}
+	if err != nil {
+		if reconstructErr := document.reconstructXref(); reconstructErr != nil {
+			return 0, fmt.Errorf("failed to read cross-reference sections: %w", err)
+		}
+		if pageCount, err = document.countPages(); err != nil {
+			return 0, err
+		}
+	}
+
+	if pageCount == 0 {
+		return 0, ErrNoPages
+	}
+
+	return pageCount, nil
+}
+
+func CountPagesInFile(filePath string) (int, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	return CountPages(content)
+}
+
+func (d *document) countPages() (int, error) {
+	catalog, ok := d.resolve(d.trailer["Root"]).(dict)
+	if !ok {
+		return 0, errors.New("missing document catalog")
+	}
+
+	return d.countPageTreeNode(catalog["Pages"], map[int]bool{}, 0)
+}
+
+func (d *document) countPageTreeNode(node any, visited map[int]bool, depth int) (int, error) {
+	if depth > maxPageTreeDepth {
+		return 0, errors.New("page tree is too deep")
+	}
+
+	if reference, ok := node.(ref); ok {
+		if visited[reference.id] {
+			return 0, errors.New("page tree has a cycle")
+		}
+		visited[reference.id] = true
+	}
+
+	nodeDict, ok := d.resolve(node).(dict)
+	if !ok {
+		return 0, errors.New("invalid page tree node")
+	}
+
+	if nodeDict["Type"] == name("Page") {
+		return 1, nil
+	}
+
+	kids, ok := d.resolve(nodeDict["Kids"]).(array)
+	if !ok {
+		return 0, errors.New("page tree node without kids")
+	}
+
+	pageCount := 0
+	for _, kid := range kids {
+		kidPageCount, err := d.countPageTreeNode(kid, visited, depth+1)
+		if err != nil {
+			return 0, err
+		}
+		pageCount += kidPageCount
+	}
+
+	return pageCount, nil
+}
@@ -0,0 +1,128 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCountPages(t *testing.T) {
+	valid := validTestPdf(2)
+
+	nested := newTestPdf()
+	nested.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	nested.object(2, "<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 3 >>")
+	nested.object(3, "<< /Type /Pages /Kids [5 0 R 6 0 R] /Count 2 >>")
+	nested.object(4, "<< /Type /Page >>")
+	nested.object(5, "<< /Type /Page >>")
+	nested.object(6, "<< /Type /Page >>")
+
+	// startxref points into the middle of an object
+	brokenStartXref := bytes.Replace(valid, []byte(fmt.Sprintf("startxref\n%d", bytes.Index(valid, []byte("xref\n")))), []byte("startxref\n20"), 1)
+
+	// The offsets in the table point before the objects
+	brokenOffsets := bytes.Replace(valid, []byte("%PDF-1.7\n"), []byte("%PDF-1.7\n% a comment that shifts every object\n"), 1)
+
+	loop := newTestPdf()
+	ids := writeTestPages(loop, 3)
+	loopOffset := loop.data.Len()
+	loop.xrefTable(fmt.Sprintf("<< /Size 6 /Root 1 0 R /Prev %d >>", loopOffset), ids...)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		pageCount int
+	}{
+		{"valid", valid, 2},
+		{"single page", validTestPdf(1), 1},
+		{"nested page tree", nested.end(nested.xrefTable("<< /Size 7 /Root 1 0 R >>", 1, 2, 3, 4, 5, 6)), 3},
+		{"object and cross-reference streams", compressedTestPdf(t), 3},
+		{"incremental update", incrementallyUpdatedTestPdf(), 2},
+		{"broken startxref", brokenStartXref, 2},
+		{"broken xref offsets", brokenOffsets, 2},
+		{"cross-reference sections loop", loop.end(loopOffset), 3},
+		{"no cross-reference section", nested.data.Bytes()[:bytes.Index(nested.data.Bytes(), []byte("xref\n"))], 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pageCount, err := CountPages(test.data)
+			if err != nil {
+				t.Fatalf("failed to count pages: %v", err)
+			}
+			if pageCount != test.pageCount {
+				t.Errorf("expected %d pages, got %d", test.pageCount, pageCount)
+			}
+		})
+	}
+}
+
+func TestCountPagesErrors(t *testing.T) {
+	valid := validTestPdf(2)
+
+	zeroPages := validTestPdf(0)
+
+	cycle := newTestPdf()
+	cycle.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	cycle.object(2, "<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	cycle.object(3, "<< /Type /Pages /Kids [2 0 R] /Count 1 >>")
+
+	noKids := newTestPdf()
+	noKids.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	noKids.object(2, "<< /Type /Pages /Count 1 >>")
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", []byte{}, nil},
+		{"HTML error page", []byte("<html><head><title>502 Bad Gateway</title></head><body><h1>502 Bad Gateway</h1></body></html>"), nil},
+		{"header only", []byte("%PDF-1.7\n"), nil},
+		// Cut in the middle of the second page, which is referenced by the page tree
+		{"truncated", valid[:bytes.Index(valid, []byte("4 0 obj"))+10], nil},
+		{"zero pages", zeroPages, ErrNoPages},
+		{"page tree cycle", cycle.end(cycle.xrefTable("<< /Size 4 /Root 1 0 R >>", 1, 2, 3)), nil},
+		{"page tree node without kids", noKids.end(noKids.xrefTable("<< /Size 3 /Root 1 0 R >>", 1, 2)), nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pageCount, err := CountPages(test.data)
+			if err == nil {
+				t.Fatalf("expected an error, got %d pages", pageCount)
+			}
+			if test.err != nil && !errors.Is(err, test.err) {
+				t.Errorf("expected %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestCountPagesTooDeep(t *testing.T) {
+	p := newTestPdf()
+	p.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	ids := []int{1}
+	for id := 2; id < maxPageTreeDepth+4; id++ {
+		p.object(id, fmt.Sprintf("<< /Type /Pages /Kids [%d 0 R] /Count 1 >>", id+1))
+		ids = append(ids, id)
+	}
+	p.object(maxPageTreeDepth+4, "<< /Type /Page >>")
+	ids = append(ids, maxPageTreeDepth+4)
+
+	if _, err := CountPages(p.end(p.xrefTable(fmt.Sprintf("<< /Size %d /Root 1 0 R >>", len(ids)+1), ids...))); err == nil {
+		t.Errorf("expected an error for a too deep page tree")
+	}
+}
+
+func TestCountPagesInFile(t *testing.T) {
+	pageCount, err := CountPagesInFile(writeTestFile(t, validTestPdf(3)))
+	if err != nil || pageCount != 3 {
+		t.Errorf("expected 3 pages, got %d (%v)", pageCount, err)
+	}
+
+	if _, err := CountPagesInFile(t.TempDir() + "/missing.pdf"); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,81 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// How far from the beginning and the end of the file the markers are looked for, some producers add junk around
+const markerSearchWindow = 1024
+
+var (
+	ErrMissingHeader  = errors.New("missing %PDF header")
+	ErrMissingTrailer = errors.New("missing %%EOF trailer")
+	ErrInvalidXref    = errors.New("invalid startxref")
+
+	startXrefRegexp = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF`)
+	xrefStartRegexp = regexp.MustCompile(`^(xref|\d+\s+\d+\s+obj)`)
+)
+
+// Checks the structure of the PDF: the header, the trailer and that startxref points to a cross-reference section
+func ValidateFile(filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open PDF: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat PDF: %w", err)
+	}
+
+	return Validate(file, info.Size())
+}
+
+func Validate(reader io.ReaderAt, size int64) error {
+	head := make([]byte, min(markerSearchWindow, size))
+	if _, err := reader.ReadAt(head, 0); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	if !bytes.Contains(head, []byte("%PDF-")) {
+		return ErrMissingHeader
+	}
+
+	tailOffset := max(0, size-markerSearchWindow)
+	tail := make([]byte, size-tailOffset)
+	if _, err := reader.ReadAt(tail, tailOffset); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	// Incremental updates append sections, the last one is the effective one
+	matches := startXrefRegexp.FindAllSubmatch(tail, -1)
+	if len(matches) == 0 {
+		if !bytes.Contains(tail, []byte("%%EOF")) {
+			return ErrMissingTrailer
+		}
+		return ErrInvalidXref
+	}
+
+	xrefOffset, err := strconv.ParseInt(string(matches[len(matches)-1][1]), 10, 64)
+	if err != nil || xrefOffset <= 0 || xrefOffset >= size {
+		return ErrInvalidXref
+	}
+
+	xrefHead := make([]byte, min(32, size-xrefOffset))
+	if _, err := reader.ReadAt(xrefHead, xrefOffset); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	if !xrefStartRegexp.Match(bytes.TrimLeft(xrefHead, " \r\n\t")) {
+		return ErrInvalidXref
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	valid := validTestPdf(2)
+	xrefOffset := bytes.Index(valid, []byte("xref\n"))
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"valid", valid, nil},
+		{"object and cross-reference streams", compressedTestPdf(t), nil},
+		{"incremental update", incrementallyUpdatedTestPdf(), nil},
+		{"junk after EOF marker", append(bytes.Clone(valid), "\n\x00\x00 junk"...), nil},
+		{"empty", []byte{}, ErrMissingHeader},
+		{"HTML error page", []byte("<!DOCTYPE html><html><body><h1>500 Internal Server Error</h1></body></html>"), ErrMissingHeader},
+		{"header too far", append([]byte(strings.Repeat(" ", markerSearchWindow)), valid...), ErrMissingHeader},
+		{"truncated", valid[:len(valid)/2], ErrMissingTrailer},
+		{"truncated before EOF marker", valid[:len(valid)-len("%%EOF\n")], ErrMissingTrailer},
+		{"no startxref", []byte("%PDF-1.7\n1 0 obj\n<< >>\nendobj\n%%EOF\n"), ErrInvalidXref},
+		{"startxref beyond the end", bytes.Replace(valid, []byte(fmt.Sprintf("startxref\n%d", xrefOffset)), []byte("startxref\n99999"), 1), ErrInvalidXref},
+		{"startxref to zero", bytes.Replace(valid, []byte(fmt.Sprintf("startxref\n%d", xrefOffset)), []byte("startxref\n0"), 1), ErrInvalidXref},
+		{"broken xref", bytes.Replace(valid, []byte(fmt.Sprintf("startxref\n%d", xrefOffset)), []byte(fmt.Sprintf("startxref\n%d", xrefOffset+3)), 1), ErrInvalidXref},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(bytes.NewReader(test.data), int64(len(test.data)))
+			if test.err == nil && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			if test.err != nil && !errors.Is(err, test.err) {
+				t.Errorf("expected %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+// Updates append a new section, only the last startxref counts
+func TestValidateUsesLastStartXref(t *testing.T) {
+	updated := incrementallyUpdatedTestPdf()
+	lastStartXref := bytes.LastIndex(updated, []byte("startxref"))
+
+	broken := append(bytes.Clone(updated[:lastStartXref]), "startxref\n12\n%%EOF\n"...)
+	if err := Validate(bytes.NewReader(broken), int64(len(broken))); !errors.Is(err, ErrInvalidXref) {
+		t.Errorf("expected the last startxref to be checked, got %v", err)
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	if err := ValidateFile(writeTestFile(t, validTestPdf(1))); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	if err := ValidateFile(writeTestFile(t, []byte("<html></html>"))); !errors.Is(err, ErrMissingHeader) {
+		t.Errorf("expected ErrMissingHeader, got %v", err)
+	}
+
+	if err := ValidateFile(t.TempDir() + "/missing.pdf"); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,96 @@
+package pdf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Minimal PDF writer, enough to produce documents out of pre-encoded objects (e.g. images)
+type Writer struct {
+	writer  *bufio.Writer
+	offset  int64
+	offsets map[int]int64
+	lastId  int
+}
+
+func NewWriter(w io.Writer) (*Writer, error) {
+	writer := &Writer{
+		writer:  bufio.NewWriter(w),
+		offsets: map[int]int64{},
+	}
+
+	// The binary comment marks the file as binary for transfer tools
+	if err := writer.write("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n"); err != nil {
+		return nil, err
+	}
+
+	return writer, nil
+}
+
+func (w *Writer) write(content string) error {
+	n, err := w.writer.WriteString(content)
+	w.offset += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write PDF content: %w", err)
+	}
+	return nil
+}
+
+// Allocates an object id, so it can be referenced before the object itself is written
+func (w *Writer) ReserveObject() int {
+	w.lastId++
+	return w.lastId
+}
+
+func (w *Writer) WriteObject(id int, body string) error {
+	w.offsets[id] = w.offset
+	return w.write(fmt.Sprintf("%d 0 obj\n%s\nendobj\n", id, body))
+}
+
+// The dictionary must not contain /Length, it is added automatically
+func (w *Writer) WriteStream(id int, dictionary string, data []byte) error {
+	w.offsets[id] = w.offset
+
+	if err := w.write(fmt.Sprintf("%d 0 obj\n<< %s /Length %d >>\nstream\n", id, dictionary, len(data))); err != nil {
+		return err
+	}
+
+	n, err := w.writer.Write(data)
+	w.offset += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write PDF stream: %w", err)
+	}
+
+	return w.write("\nendstream\nendobj\n")
+}
+
+// Writes the cross-reference table and the trailer, all reserved objects must be written by then
+func (w *Writer) Close(rootId int) error {
+	xrefOffset := w.offset
+
+	if err := w.write(fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", w.lastId+1)); err != nil {
+		return err
+	}
+
+	for id := 1; id <= w.lastId; id++ {
+		offset, ok := w.offsets[id]
+		if !ok {
+			return fmt.Errorf("object %d is reserved but not written", id)
+		}
+
+		if err := w.write(fmt.Sprintf("%010d 00000 n \n", offset)); err != nil {
+			return err
+		}
+	}
+
+	if err := w.write(fmt.Sprintf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", w.lastId+1, rootId, xrefOffset)); err != nil {
+		return err
+	}
+
+	if err := w.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush PDF: %w", err)
+	}
+
+	return nil
+}
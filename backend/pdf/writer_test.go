@@ -0,0 +1,73 @@
+package pdf
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	output := &bytes.Buffer{}
+	writer, err := NewWriter(output)
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	catalogId := writer.ReserveObject()
+	pagesId := writer.ReserveObject()
+	pageIds := []int{writer.ReserveObject(), writer.ReserveObject()}
+	contentId := writer.ReserveObject()
+
+	steps := []func() error{
+		func() error { return writer.WriteObject(catalogId, "<< /Type /Catalog /Pages 2 0 R >>") },
+		func() error { return writer.WriteObject(pagesId, "<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 >>") },
+		func() error {
+			return writer.WriteStream(contentId, "", []byte("q 1 0 0 1 0 0 cm Q\nendstream in content"))
+		},
+		func() error { return writer.WriteObject(pageIds[0], "<< /Type /Page /Parent 2 0 R /Contents 5 0 R >>") },
+		func() error { return writer.WriteObject(pageIds[1], "<< /Type /Page /Parent 2 0 R >>") },
+		func() error { return writer.Close(catalogId) },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("failed to write PDF: %v", err)
+		}
+	}
+
+	data := output.Bytes()
+	if err := Validate(bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Errorf("expected a valid PDF, got %v", err)
+	}
+
+	// The cross-reference table must be exact, otherwise the pages would be found by reconstruction only
+	document := newDocument(data)
+	if err := document.loadXref(); err != nil {
+		t.Fatalf("failed to load xref: %v", err)
+	}
+	pageCount, err := document.countPages()
+	if err != nil || pageCount != 2 {
+		t.Errorf("expected 2 pages, got %d (%v)", pageCount, err)
+	}
+
+	content, ok := document.getObject(contentId).(stream)
+	if !ok || string(content.data) != "q 1 0 0 1 0 0 cm Q\nendstream in content" {
+		t.Errorf("expected the content stream, got %#v", document.getObject(contentId))
+	}
+}
+
+func TestWriterReservedObjectNotWritten(t *testing.T) {
+	writer, err := NewWriter(io.Discard)
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	catalogId := writer.ReserveObject()
+	writer.ReserveObject()
+	if err := writer.WriteObject(catalogId, "<< /Type /Catalog >>"); err != nil {
+		t.Fatalf("failed to write object: %v", err)
+	}
+
+	if err := writer.Close(catalogId); err == nil {
+		t.Errorf("expected an error for a reserved object that is not written")
+	}
+}
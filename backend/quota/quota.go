@@ -0,0 +1,212 @@
+package quota
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+)
+
+type Period string
+
+const (
+	PeriodDay   Period = "day"
+	PeriodMonth Period = "month"
+)
+
+var periods = []Period{PeriodDay, PeriodMonth}
+
+// Counted against the quotas of a plan
+type Usage struct {
+	Conversions   int   `db:"conversions" json:"conversions"`
+	UploadedBytes int64 `db:"uploaded_bytes" json:"uploadedBytes"`
+	Batches       int   `db:"batches" json:"batches"`
+}
+
+type ExceededError struct {
+	// E.g. "dailyConversions", the name of the limit in config.Plan
+	Quota string
+	Limit int64
+	// Nil for the retained output, it's freed as converted files are deleted
+	ResetsAt *time.Time
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s quota of %d is exceeded", e.Quota, e.Limit)
+}
+
+func periodStart(period Period, now time.Time) time.Time {
+	now = now.UTC()
+	if period == PeriodMonth {
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func periodEnd(period Period, now time.Time) time.Time {
+	if period == PeriodMonth {
+		return periodStart(period, now).AddDate(0, 1, 0)
+	}
+	return periodStart(period, now).AddDate(0, 0, 1)
+}
+
+func PlanOf(db sqlx.Queryer, userId string) (string, config.Plan, error) {
+	var planName string
+	err := sqlx.Get(db, &planName, "SELECT plan FROM user_plans WHERE user_id = $1", userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		planName = config.Config.DefaultPlan
+	} else if err != nil {
+		return "", config.Plan{}, fmt.Errorf("failed to fetch plan of user: %w", err)
+	}
+
+	plan, ok := config.Config.Plans[planName]
+	if !ok {
+		// Plans removed from PLANS fall back to the default one
+		planName = config.Config.DefaultPlan
+		plan = config.Config.Plans[planName]
+	}
+
+	return planName, plan, nil
+}
+
+// Counts the usage in the transaction of the requests that use it, nothing is counted when the transaction is rolled
+// back. The counters of the user are locked until then, so concurrent requests can't both take the last unit.
+// Returns ExceededError when the usage doesn't fit, only the quotas the usage counts against are checked.
+func Consume(tx *sqlx.Tx, userId string, usage Usage) error {
+	_, plan, err := PlanOf(tx, userId)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, period := range periods {
+		var total Usage
+		err := tx.Get(
+			&total,
+			`
+        INSERT INTO usage_counters (user_id, period, period_start, conversions, uploaded_bytes, batches)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (user_id, period, period_start) DO UPDATE SET
+          conversions = usage_counters.conversions + EXCLUDED.conversions,
+          uploaded_bytes = usage_counters.uploaded_bytes + EXCLUDED.uploaded_bytes,
+          batches = usage_counters.batches + EXCLUDED.batches
+        RETURNING conversions, uploaded_bytes, batches
+      `,
+			userId,
+			period,
+			periodStart(period, now),
+			usage.Conversions,
+			usage.UploadedBytes,
+			usage.Batches,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to count %s usage: %w", period, err)
+		}
+
+		if err := checkPeriod(plan, period, now, usage, total); err != nil {
+			return err
+		}
+	}
+
+	if plan.RetainedOutputBytes > 0 && (usage.Conversions > 0 || usage.Batches > 0) {
+		retainedOutputBytes, err := RetainedOutputBytes(tx, userId)
+		if err != nil {
+			return err
+		}
+		if retainedOutputBytes >= plan.RetainedOutputBytes {
+			return &ExceededError{Quota: "retainedOutputBytes", Limit: plan.RetainedOutputBytes}
+		}
+	}
+
+	return nil
+}
+
+func checkPeriod(plan config.Plan, period Period, now time.Time, usage Usage, total Usage) error {
+	prefix := "daily"
+	conversionsLimit, uploadBytesLimit, batchesLimit := plan.DailyConversions, plan.DailyUploadBytes, plan.DailyBatches
+	if period == PeriodMonth {
+		prefix = "monthly"
+		conversionsLimit, uploadBytesLimit, batchesLimit = plan.MonthlyConversions, plan.MonthlyUploadBytes, plan.MonthlyBatches
+	}
+
+	resetsAt := periodEnd(period, now)
+	switch {
+	case usage.Conversions > 0 && conversionsLimit > 0 && total.Conversions > conversionsLimit:
+		return &ExceededError{Quota: prefix + "Conversions", Limit: int64(conversionsLimit), ResetsAt: &resetsAt}
+	case usage.UploadedBytes > 0 && uploadBytesLimit > 0 && total.UploadedBytes > uploadBytesLimit:
+		return &ExceededError{Quota: prefix + "UploadBytes", Limit: uploadBytesLimit, ResetsAt: &resetsAt}
+	case usage.Batches > 0 && batchesLimit > 0 && total.Batches > batchesLimit:
+		return &ExceededError{Quota: prefix + "Batches", Limit: int64(batchesLimit), ResetsAt: &resetsAt}
+	}
+
+	return nil
+}
+
+// The bytes the user can still upload, for files whose size is known only once they are downloaded (files fetched
+// from source URLs). Also returns the ExceededError of the quota that leaves the fewest bytes, nil when unlimited
+// (math.MaxInt64 bytes then). Returns the ExceededError as the error when nothing is left.
+func RemainingUploadBytes(db sqlx.Queryer, userId string) (int64, *ExceededError, error) {
+	_, plan, err := PlanOf(db, userId)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	remainingUploadBytes := int64(math.MaxInt64)
+	var uploadBytesQuota *ExceededError
+	now := time.Now()
+	for _, period := range periods {
+		quota, limit := "dailyUploadBytes", plan.DailyUploadBytes
+		if period == PeriodMonth {
+			quota, limit = "monthlyUploadBytes", plan.MonthlyUploadBytes
+		}
+		if limit <= 0 {
+			continue
+		}
+
+		var uploadedBytes int64
+		err := sqlx.Get(
+			db,
+			&uploadedBytes,
+			"SELECT uploaded_bytes FROM usage_counters WHERE user_id = $1 AND period = $2 AND period_start = $3",
+			userId,
+			period,
+			periodStart(period, now),
+		)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return 0, nil, fmt.Errorf("failed to fetch %s uploaded bytes: %w", period, err)
+		}
+
+		if limit-uploadedBytes < remainingUploadBytes {
+			resetsAt := periodEnd(period, now)
+			remainingUploadBytes = limit - uploadedBytes
+			uploadBytesQuota = &ExceededError{Quota: quota, Limit: limit, ResetsAt: &resetsAt}
+		}
+	}
+
+	if remainingUploadBytes <= 0 {
+		return 0, uploadBytesQuota, uploadBytesQuota
+	}
+
+	return remainingUploadBytes, uploadBytesQuota, nil
+}
+
+func RetainedOutputBytes(db sqlx.Queryer, userId string) (int64, error) {
+	var retainedOutputBytes int64
+	err := sqlx.Get(
+		db,
+		&retainedOutputBytes,
+		"SELECT COALESCE(SUM(output_size), 0) FROM convert_requests WHERE user_id = $1 AND status = $2 AND is_file_deleted = FALSE",
+		userId,
+		models.ConvertRequestStatusDone,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum retained output bytes: %w", err)
+	}
+
+	return retainedOutputBytes, nil
+}
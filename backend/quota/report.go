@@ -0,0 +1,70 @@
+package quota
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/database"
+)
+
+type PeriodUsage struct {
+	Usage
+	ResetsAt time.Time `json:"resetsAt"`
+}
+
+func (p PeriodUsage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		Usage
+		ResetsAt int64 `json:"resetsAt"`
+	}{
+		Usage:    p.Usage,
+		ResetsAt: p.ResetsAt.Unix() * 1000,
+	})
+}
+
+type Report struct {
+	Plan                string      `json:"plan"`
+	Limits              config.Plan `json:"limits"`
+	Daily               PeriodUsage `json:"daily"`
+	Monthly             PeriodUsage `json:"monthly"`
+	RetainedOutputBytes int64       `json:"retainedOutputBytes"`
+}
+
+func ReportOf(userId string) (Report, error) {
+	planName, plan, err := PlanOf(database.Connection, userId)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{Plan: planName, Limits: plan}
+	now := time.Now()
+	for _, period := range periods {
+		periodUsage := PeriodUsage{ResetsAt: periodEnd(period, now)}
+		err := database.Connection.Get(
+			&periodUsage.Usage,
+			"SELECT conversions, uploaded_bytes, batches FROM usage_counters WHERE user_id = $1 AND period = $2 AND period_start = $3",
+			userId,
+			period,
+			periodStart(period, now),
+		)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return Report{}, fmt.Errorf("failed to fetch %s usage: %w", period, err)
+		}
+
+		if period == PeriodMonth {
+			report.Monthly = periodUsage
+		} else {
+			report.Daily = periodUsage
+		}
+	}
+
+	if report.RetainedOutputBytes, err = RetainedOutputBytes(database.Connection, userId); err != nil {
+		return Report{}, err
+	}
+
+	return report, nil
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/karpov-kir/word-to-pdf/backend/auth"
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// Limits requests of the user and of the IP separately, both must be within their rates. The per-user limit
+// is skipped before authentication (there is no user yet). Requests are let through when the store fails.
+func Middleware(name string, rateLimit config.RateLimit) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if userId, ok := c.Locals(auth.UserIdLocal).(string); ok {
+			if limited, err := isLimited(fmt.Sprintf("%s:user:%s", name, userId), rateLimit.PerUser, c); limited || err != nil {
+				return err
+			}
+		}
+
+		if limited, err := isLimited(fmt.Sprintf("%s:ip:%s", name, c.IP()), rateLimit.PerIp, c); limited || err != nil {
+			return err
+		}
+
+		return c.Next()
+	}
+}
+
+// Rejects uploads while the backlog of queued convert requests exceeds QUEUE_BACKPRESSURE_THRESHOLD
+func Backpressure() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		threshold := config.Config.QueueBackpressureThreshold
+		if threshold == 0 || metrics.ConvertQueueDepth.Value() < int64(threshold) {
+			return c.Next()
+		}
+
+		logrus.Warnf("Convert queue depth %d exceeds %d, rejecting %s", metrics.ConvertQueueDepth.Value(), threshold, c.Path())
+		metrics.BackpressuredRequests.Add(1)
+		return tooManyRequests(c, config.Config.QueueBackpressureRetryAfter, "The conversion queue is full, try again later")
+	}
+}
+
+// Responds with 429 when the key is over the rate
+func isLimited(key string, rate config.Rate, c *fiber.Ctx) (bool, error) {
+	if rate.Count == 0 {
+		return false, nil
+	}
+
+	count, windowEnd, err := store.Increment(key, rate.Window)
+	if err != nil {
+		logrus.Errorf("Failed to check rate limit of %s, letting the request through: %v", key, err)
+		return false, nil
+	}
+	if count <= rate.Count {
+		return false, nil
+	}
+
+	logrus.Infof("Rate limit of %s exceeded: %d requests per %s", key, rate.Count, rate.Window)
+	metrics.RateLimitedRequests.Add(1)
+	return true, tooManyRequests(c, time.Until(windowEnd), "Too many requests, try again later")
+}
+
+// The body is the error format of the extension (ServerErrorDto)
+func tooManyRequests(c *fiber.Ctx, retryAfter time.Duration, message string) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(max(1, int(math.Ceil(retryAfter.Seconds())))))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"message": message,
+		"type":    "tooManyRequestsError",
+	})
+}
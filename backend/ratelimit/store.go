@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/database"
+	"github.com/sirupsen/logrus"
+)
+
+// Counts requests in fixed windows (e.g. the current minute). Returns the count of the key in the current window
+// including this request and when the window ends.
+type Store interface {
+	Increment(key string, window time.Duration) (int, time.Time, error)
+}
+
+var store Store
+
+func Init() {
+	switch config.Config.RateLimitStore {
+	case "postgres":
+		store = &postgresStore{}
+	default:
+		store = newMemoryStore()
+	}
+
+	logrus.Infof("Rate limits are counted in %s", config.Config.RateLimitStore)
+}
+
+// Limits are per replica
+type memoryStore struct {
+	mu       sync.Mutex
+	counters map[string]*memoryCounter
+	// Expired counters are swept at most once a minute
+	sweptAt time.Time
+}
+
+type memoryCounter struct {
+	count     int
+	expiresAt time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{counters: map[string]*memoryCounter{}, sweptAt: time.Now()}
+}
+
+func (s *memoryStore) Increment(key string, window time.Duration) (int, time.Time, error) {
+	now := time.Now()
+	windowStart := now.Truncate(window)
+	windowKey := fmt.Sprintf("%s:%d", key, windowStart.Unix())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.sweptAt) > time.Minute {
+		for counterKey, counter := range s.counters {
+			if !counter.expiresAt.After(now) {
+				delete(s.counters, counterKey)
+			}
+		}
+		s.sweptAt = now
+	}
+
+	counter, ok := s.counters[windowKey]
+	if !ok {
+		counter = &memoryCounter{expiresAt: windowStart.Add(window)}
+		s.counters[windowKey] = counter
+	}
+	counter.count++
+
+	return counter.count, counter.expiresAt, nil
+}
+
+// Limits are shared by all replicas, expired counters are deleted by background.StartDeletingExpiredRateLimitCounters
+type postgresStore struct{}
+
+func (s *postgresStore) Increment(key string, window time.Duration) (int, time.Time, error) {
+	windowStart := time.Now().UTC().Truncate(window)
+	expiresAt := windowStart.Add(window)
+
+	var count int
+	err := database.Connection.Get(
+		&count,
+		`
+      INSERT INTO rate_limit_counters (key, window_start, count, expires_at) VALUES ($1, $2, 1, $3)
+      ON CONFLICT (key, window_start) DO UPDATE SET count = rate_limit_counters.count + 1
+      RETURNING count
+    `,
+		key,
+		windowStart,
+		expiresAt,
+	)
+	if err != nil {
+		return 0, expiresAt, fmt.Errorf("failed to increment rate limit counter: %w", err)
+	}
+
+	return count, expiresAt, nil
+}
@@ -0,0 +1,227 @@
+package remote
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/karpov-kir/word-to-pdf/backend/config"
+	"github.com/karpov-kir/word-to-pdf/backend/converters"
+	"github.com/karpov-kir/word-to-pdf/backend/models"
+)
+
+var (
+	ErrBlockedAddress = errors.New("address is not allowed")
+	ErrFileTooLarge   = errors.New("file is too large")
+)
+
+// Content types that servers use for any file, the extension decides then
+var genericContentTypes = []string{
+	"application/octet-stream",
+	"binary/octet-stream",
+	"application/download",
+	"application/x-download",
+	"application/force-download",
+}
+
+// Besides the type itself, e.g. some servers don't know .docx and send it as a zip
+var contentTypeAliases = map[string][]string{
+	converters.MimeTypeDoc:      {"application/vnd.ms-word"},
+	converters.MimeTypeDocx:     {"application/zip"},
+	converters.MimeTypeHtml:     {"application/xhtml+xml"},
+	converters.MimeTypeMarkdown: {"text/plain", "text/x-markdown"},
+	converters.MimeTypeJpeg:     {"image/jpg", "image/pjpeg"},
+	converters.MimeTypeEmail:    {"text/plain"},
+	converters.MimeTypePdf:      {"application/x-pdf"},
+}
+
+// Ranges that are not private but not public either (RFC 6890), blocked along with private, loopback, link-local, etc.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+type FetchedFile struct {
+	Size int64
+	// SHA-256, same as for uploads
+	ContentHash string
+}
+
+// Only absolute HTTP(S) URLs are accepted. Credentials are rejected, they would be stored along with the convert request.
+func ValidateUrl(sourceUrl string) error {
+	if len(sourceUrl) > 2000 {
+		return errors.New("URL is too long")
+	}
+
+	parsedUrl, err := url.Parse(sourceUrl)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	if parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https" {
+		return errors.New("only http and https URLs are supported")
+	}
+	if parsedUrl.Hostname() == "" {
+		return errors.New("URL has no host")
+	}
+	if parsedUrl.User != nil {
+		return errors.New("credentials in URL are not supported")
+	}
+
+	return nil
+}
+
+// Downloads the URL to the file path, up to maxFileSize bytes (e.g. SOURCE_URL_MAX_FILE_SIZE or less, when less is
+// left of the upload quota). Addresses are checked after DNS resolution on every connection (including redirects),
+// so host names resolving to internal addresses are blocked too. The file is written under a temporary name and moved
+// in place only when complete.
+func Fetch(ctx context.Context, sourceUrl string, expectedMimeType string, filePath string, maxFileSize int64) (FetchedFile, error) {
+	if err := ValidateUrl(sourceUrl); err != nil {
+		return FetchedFile{}, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceUrl, nil)
+	if err != nil {
+		return FetchedFile{}, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	response, err := newHttpClient().Do(request)
+	if err != nil {
+		return FetchedFile{}, fmt.Errorf("failed to fetch: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return FetchedFile{}, fmt.Errorf("failed to fetch: unexpected status %d", response.StatusCode)
+	}
+
+	if err := checkContentType(response.Header.Get("Content-Type"), expectedMimeType); err != nil {
+		return FetchedFile{}, err
+	}
+
+	if response.ContentLength > maxFileSize {
+		return FetchedFile{}, fmt.Errorf("%w, max %d bytes", ErrFileTooLarge, maxFileSize)
+	}
+
+	temporaryFilePath := filePath + ".download"
+	localFileWriter, err := os.Create(temporaryFilePath)
+	if err != nil {
+		return FetchedFile{}, fmt.Errorf("failed to create file on server: %w", err)
+	}
+	defer os.Remove(temporaryFilePath)
+	defer localFileWriter.Close()
+
+	// The declared length can't be trusted, so the actual amount of bytes is limited too
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(localFileWriter, hash), io.LimitReader(response.Body, maxFileSize+1))
+	if err != nil {
+		return FetchedFile{}, fmt.Errorf("failed to download: %w", err)
+	}
+	if size > maxFileSize {
+		return FetchedFile{}, fmt.Errorf("%w, max %d bytes", ErrFileTooLarge, maxFileSize)
+	}
+
+	if err := localFileWriter.Close(); err != nil {
+		return FetchedFile{}, fmt.Errorf("failed to save file: %w", err)
+	}
+	if err := os.Rename(temporaryFilePath, filePath); err != nil {
+		return FetchedFile{}, fmt.Errorf("failed to save file: %w", err)
+	}
+
+	return FetchedFile{Size: size, ContentHash: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+func newHttpClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			addressPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+			}
+			if !IsAllowedAddress(addressPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, addressPort.Addr())
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: config.Config.SourceUrlTimeout,
+		Transport: &http.Transport{
+			// Proxies from the environment would connect on our behalf, bypassing the address checks
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+			DisableKeepAlives:     true,
+		},
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			if len(via) > config.Config.SourceUrlMaxRedirects {
+				return fmt.Errorf("too many redirects, max %d", config.Config.SourceUrlMaxRedirects)
+			}
+			if request.URL.Scheme != "http" && request.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme: %s", request.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// Only public unicast addresses are allowed, unless the address is in SOURCE_URL_ALLOWED_NETWORKS
+func IsAllowedAddress(address netip.Addr) bool {
+	address = address.Unmap()
+
+	for _, prefix := range config.Config.SourceUrlAllowedNetworks {
+		if prefix.Contains(address) {
+			return true
+		}
+	}
+
+	if !address.IsGlobalUnicast() || address.IsPrivate() {
+		return false
+	}
+
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(address) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func checkContentType(contentType string, expectedMimeType string) error {
+	if contentType == "" {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid content type: %s", contentType)
+	}
+
+	if mediaType == expectedMimeType || slices.Contains(genericContentTypes, mediaType) || slices.Contains(contentTypeAliases[expectedMimeType], mediaType) {
+		return nil
+	}
+
+	return converters.NewConversionError(
+		models.ConvertRequestErrorCodeUnsupportedFormat,
+		fmt.Errorf("unexpected content type %s, expected %s", mediaType, expectedMimeType),
+	)
+}
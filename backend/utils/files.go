@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Hard links are preferred to save disk space. A linked file shares its content with the source, so files that
+// may be linked must never be written in place, only replaced with WriteFileAtomically.
+func LinkOrCopyFile(sourcePath string, destinationPath string) error {
+	os.Remove(destinationPath)
+
+	if err := os.Link(sourcePath, destinationPath); err == nil {
+		return nil
+	}
+
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer source.Close()
+
+	return WriteFileAtomically(destinationPath, func(destination io.Writer) error {
+		if _, err := io.Copy(destination, source); err != nil {
+			return fmt.Errorf("failed to copy file: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// Writes to a temporary file that is renamed to the path when write succeeds, so the file at the path (and the
+// files linked to it) is never truncated or left partially written. The error of write is returned as is.
+func WriteFileAtomically(path string, write func(io.Writer) error) error {
+	temporaryFilePath := path + ".tmp"
+	temporaryFile, err := os.Create(temporaryFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(temporaryFilePath)
+	defer temporaryFile.Close()
+
+	if err := write(temporaryFile); err != nil {
+		return err
+	}
+
+	if err := temporaryFile.Close(); err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+	if err := os.Rename(temporaryFilePath, path); err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+
+	return nil
+}
@@ -2,7 +2,9 @@ package utils
 
 import (
 	"context"
+	"slices"
 	"sync"
+	"time"
 )
 
 type Task func(ctx context.Context)
@@ -15,22 +17,42 @@ type TaskPool struct {
 	cancel   context.CancelFunc
 	tokens   map[string]struct{}
 	mu       sync.Mutex
+	// At most limit (up to maxTasks) tasks run at the same time, workers above it wait for running tasks to finish
+	limit   int
+	running int
+	// The weights of running tasks are within the budget (0 is unlimited), except for a single task that is heavier
+	// than the whole budget. Tasks that wait longer than starvationTimeout are not overtaken by lighter ones anymore.
+	weightBudget      int
+	usedWeight        int
+	starvationTimeout time.Duration
+	// In the order of arrival
+	waiting      []*waitingTask
+	slotsChanged *sync.Cond
 }
 
 type taskWithToken struct {
-	task  Task
-	token string
+	task   Task
+	token  string
+	weight int
+}
+
+type waitingTask struct {
+	weight int
+	since  time.Time
 }
 
 func NewTaskPool(ctx context.Context, maxTasks int) *TaskPool {
 	ctx, cancel := context.WithCancel(ctx)
-	return &TaskPool{
+	tp := &TaskPool{
 		maxTasks: maxTasks,
 		tasks:    make(chan taskWithToken, maxTasks),
 		ctx:      ctx,
 		cancel:   cancel,
 		tokens:   make(map[string]struct{}),
+		limit:    maxTasks,
 	}
+	tp.slotsChanged = sync.NewCond(&tp.mu)
+	return tp
 }
 
 func (tp *TaskPool) Start() {
@@ -48,9 +70,14 @@ func (tp *TaskPool) worker() {
 			if !ok {
 				return
 			}
-			taskWithToken.task(tp.ctx)
+			if tp.acquireRunSlot(taskWithToken.weight) {
+				taskWithToken.task(tp.ctx)
+			}
 			tp.mu.Lock()
+			tp.running--
+			tp.usedWeight -= taskWithToken.weight
 			delete(tp.tokens, taskWithToken.token)
+			tp.slotsChanged.Broadcast()
 			tp.mu.Unlock()
 		case <-tp.ctx.Done():
 			return
@@ -58,7 +85,92 @@ func (tp *TaskPool) worker() {
 	}
 }
 
+// Returns false when the pool is stopped while waiting, the slot is taken either way
+func (tp *TaskPool) acquireRunSlot(weight int) bool {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	waiter := &waitingTask{weight: weight, since: time.Now()}
+	tp.waiting = append(tp.waiting, waiter)
+
+	for !tp.canRun(waiter) && tp.ctx.Err() == nil {
+		tp.slotsChanged.Wait()
+	}
+
+	tp.waiting = slices.DeleteFunc(tp.waiting, func(waitingTask *waitingTask) bool {
+		return waitingTask == waiter
+	})
+	tp.running++
+	tp.usedWeight += weight
+
+	return tp.ctx.Err() == nil
+}
+
+// Must be called with the mutex locked
+func (tp *TaskPool) canRun(waiter *waitingTask) bool {
+	if tp.running >= tp.limit {
+		return false
+	}
+
+	if tp.weightBudget <= 0 {
+		return true
+	}
+
+	// The oldest starving task goes first, the others wait until it fits
+	if tp.starvationTimeout > 0 {
+		for _, waitingTask := range tp.waiting {
+			if waitingTask == waiter || time.Since(waitingTask.since) < tp.starvationTimeout {
+				continue
+			}
+			if waitingTask.since.Before(waiter.since) {
+				return false
+			}
+		}
+	}
+
+	return tp.usedWeight == 0 || tp.usedWeight+waiter.weight <= tp.weightBudget
+}
+
+// Changes how many tasks run at the same time, clamped to 1..maxTasks. Running tasks are not interrupted
+// when the limit goes down.
+func (tp *TaskPool) SetLimit(limit int) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	tp.limit = max(1, min(limit, tp.maxTasks))
+	tp.slotsChanged.Broadcast()
+}
+
+// Limits the total weight of running tasks, see AddWeightedTask
+func (tp *TaskPool) SetWeightBudget(weightBudget int, starvationTimeout time.Duration) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	tp.weightBudget = weightBudget
+	tp.starvationTimeout = starvationTimeout
+	tp.slotsChanged.Broadcast()
+}
+
+func (tp *TaskPool) UsedWeight() int {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	return tp.usedWeight
+}
+
+func (tp *TaskPool) Limit() int {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	return tp.limit
+}
+
 func (tp *TaskPool) AddTask(task Task, token string) bool {
+	return tp.AddWeightedTask(task, token, 1)
+}
+
+// Heavier tasks take more of the weight budget, e.g. conversions of large files
+func (tp *TaskPool) AddWeightedTask(task Task, token string, weight int) bool {
 	tp.mu.Lock()
 	defer tp.mu.Unlock()
 
@@ -67,7 +179,7 @@ func (tp *TaskPool) AddTask(task Task, token string) bool {
 	}
 
 	select {
-	case tp.tasks <- taskWithToken{task: task, token: token}:
+	case tp.tasks <- taskWithToken{task: task, token: token, weight: max(1, weight)}:
 		tp.tokens[token] = struct{}{}
 		return true
 	default:
@@ -75,8 +187,12 @@ func (tp *TaskPool) AddTask(task Task, token string) bool {
 	}
 }
 
+// Up to the limit of tasks run, as many again wait in the buffer to take freed slots right away
 func (tp *TaskPool) LeftSlots() int {
-	return tp.maxTasks - len(tp.tasks)
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	return max(0, min(tp.maxTasks-len(tp.tasks), 2*tp.limit-len(tp.tokens)))
 }
 
 func (tp *TaskPool) OccupiedTokens() map[string]struct{} {
@@ -101,5 +217,10 @@ func (tp *TaskPool) IsOccupied(token string) bool {
 func (tp *TaskPool) Stop() {
 	close(tp.tasks)
 	tp.cancel()
+
+	tp.mu.Lock()
+	tp.slotsChanged.Broadcast()
+	tp.mu.Unlock()
+
 	tp.wg.Wait()
 }
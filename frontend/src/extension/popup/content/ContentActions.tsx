@@ -69,7 +69,7 @@ export function ContentActions(props: {
     }
 
     if (batchRequestValue) {
-      return !batchRequestValue.error && ['queued', 'batching'].includes(batchRequestValue.status);
+      return !batchRequestValue.error && ['waiting', 'queued', 'batching'].includes(batchRequestValue.status);
     }
 
     return false;
@@ -54,6 +54,7 @@ function getBatchRequestErrorType(error: unknown) {
   if (error instanceof ServerErrorResponse) {
     const errorTypeMap: Record<string, BatchRequestErrorType> = {
       [ServerErrorType.TooManyRequestsError]: BatchRequestErrorType.QuotaExceeded,
+      [ServerErrorType.QuotaExceededError]: BatchRequestErrorType.QuotaExceeded,
     };
 
     return errorTypeMap[error.serverError.type] ?? BatchRequestErrorType.UnknownError;
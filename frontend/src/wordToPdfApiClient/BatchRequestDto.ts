@@ -1,8 +1,29 @@
+import { ConvertRequestErrorCode, Priority } from './ConvertRequestDto';
+
+export interface BatchRequestMemberDto {
+  convertRequestId: string;
+  fileName: string;
+  entryName?: string;
+  status: 'queued' | 'converting' | 'done' | 'error' | 'cancelled';
+  error?: string;
+  errorCode?: ConvertRequestErrorCode;
+  pageCount?: number;
+  outputSize?: number;
+  crc32?: number;
+  included: boolean;
+}
+
 export interface BatchRequestDto {
   id: string;
-  status: 'queued' | 'batching' | 'done' | 'error';
+  status: 'waiting' | 'queued' | 'batching' | 'done' | 'error';
   error?: string;
   batchedFileCount?: number;
   createdAt: number;
   batchedAt?: number;
+  archiveFormat?: 'zip' | 'tar.gz' | 'zip-aes';
+  streamed?: boolean;
+  members?: BatchRequestMemberDto[];
+  priority: Priority;
+  neededBy?: number;
+  notBefore?: number;
 }
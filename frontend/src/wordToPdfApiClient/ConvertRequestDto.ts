@@ -1,9 +1,27 @@
+export type ConvertRequestErrorCode =
+  | 'corrupt_input'
+  | 'encrypted_input'
+  | 'unsupported_format'
+  | 'engine_unavailable'
+  | 'timeout'
+  | 'output_invalid'
+  | 'internal';
+
+export type Priority = 'low' | 'normal' | 'high';
+
 export interface ConvertRequestDto {
   id: string;
   status: 'queued' | 'converting' | 'done' | 'error';
   error?: string;
+  errorCode?: ConvertRequestErrorCode;
   fileName: string;
   fileSize: number;
   createdAt: number;
   convertedAt?: number;
+  pageCount?: number;
+  outputSize?: number;
+  priority: Priority;
+  neededBy?: number;
+  notBefore?: number;
+  tags: string[];
 }
@@ -9,6 +9,7 @@ export enum ServerErrorType {
   UnauthorizedError = 'unauthorizedError',
   NotFoundError = 'notFoundError',
   TooManyRequestsError = 'tooManyRequestsError',
+  QuotaExceededError = 'quotaExceededError',
   PayloadTooLargeError = 'payloadTooLargeError',
 }
 
@@ -116,6 +117,12 @@ class HttpClient {
 
   private async processJsonResponse<T>(response: Response): Promise<T> {
     if (response.status === 429) {
+      // Rate limits and quotas describe themselves, e.g. the exceeded quota in `reason`
+      const responseBody = await response.json().catch(() => undefined);
+      if (isServerErrorDto(responseBody)) {
+        throw new ServerErrorResponse(responseBody, response.status);
+      }
+
       throw new ServerErrorResponse(
         {
           message: 'Too many requests',